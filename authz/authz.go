@@ -72,14 +72,19 @@ func Can(role, dom, obj, act string) bool {
 }
 
 // Require はルート/グループ用のミドルウェア。SetRoleResolver で取り出したロールが
-// obj/act を許可されていなければ 403 で止める。リソース実体に依存しない行為
+// obj/act を許可されていなければ 403 で止める。SetRoleResolver が無い場合は
+// gw_web.TenantResolver が確定した所属（ロール・対象テナント）を使う。リソース実体に依存しない行為
 // （create や管理系 API）のゲートに使う。実体依存の判定（own/any）は FindEditable を使うこと。
 func Require(obj, act string) gw_web.WebHandler {
 	return func(c *gw_web.WebCtx) error {
-		if roleResolver == nil {
+		resolve := roleResolver
+		if resolve == nil {
+			resolve = membershipRole
+		}
+		role, tenantId, ok := resolve(c)
+		if !ok && roleResolver == nil {
 			return c.Status(http.StatusInternalServerError).SendString("authz role resolver is not configured")
 		}
-		role, tenantId, ok := roleResolver(c)
 		if !ok || !Can(role, tenantId, obj, act) {
 			return c.Status(http.StatusForbidden).SendString("Forbidden")
 		}
@@ -87,6 +92,15 @@ func Require(obj, act string) gw_web.WebHandler {
 	}
 }
 
+// membershipRole は gw_web.TenantResolver が確定した所属からロールとテナントを取り出す。
+func membershipRole(c *gw_web.WebCtx) (string, string, bool) {
+	membership := gw_web.TenantMembershipOf(c)
+	if membership == nil {
+		return "", "", false
+	}
+	return membership.Role, membership.TenantId, true
+}
+
 // AddPolicy は p ルール（role, dom, obj, act）を追加する（DB へ自動保存・重複は無視）。
 func AddPolicy(role, dom, obj, act string) error {
 	if enforcer == nil {
@@ -1,8 +1,12 @@
 package gw_authz
 
 import (
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
+	gw_web "github.com/generalworksinc/goutil/webframework"
+	"github.com/gofiber/fiber/v3"
 	"gorm.io/gorm"
 	"gorm.io/gorm/utils/tests"
 )
@@ -114,3 +118,44 @@ func TestCanBeforeInitIsDenied(t *testing.T) {
 		t.Error("Init前は常にfalse")
 	}
 }
+
+// SetRoleResolver 未登録なら gw_web.TenantResolver の所属（ロール・対象テナント）で判定する
+func TestRequireFallsBackToTenantMembership(t *testing.T) {
+	setupEnforcer(t)
+	orig := roleResolver
+	roleResolver = nil
+	t.Cleanup(func() { roleResolver = orig })
+
+	app := gw_web.NewApp(func(c *gw_web.WebCtx, err error) error {
+		return c.Status(http.StatusInternalServerError).SendString(err.Error())
+	})
+	tenants := app.Group("/t", gw_web.TenantResolver(gw_web.TenantConfig{
+		UserId: func(c *gw_web.WebCtx) string { return c.Get("X-User") },
+		Loader: func(c *gw_web.WebCtx, userId, tenantId string) (*gw_web.TenantMembership, error) {
+			return &gw_web.TenantMembership{TenantId: "tenant-a", Role: c.Get("X-Role")}, nil
+		},
+	}))
+	tenants.Get("/users", Require("user", "manage"), func(c *gw_web.WebCtx) error { return c.SendString("ok") })
+	app.Get("/open", Require("user", "manage"), func(c *gw_web.WebCtx) error { return c.SendString("ok") })
+
+	for _, tc := range []struct {
+		path, role string
+		want       int
+	}{
+		{"/t/users", "system_admin", http.StatusOK},
+		{"/t/users", "user", http.StatusForbidden},
+		// TenantResolver を通らないルートは設定不備として 500
+		{"/open", "system_admin", http.StatusInternalServerError},
+	} {
+		req := httptest.NewRequest(http.MethodGet, tc.path, http.NoBody)
+		req.Header.Set("X-User", "u1")
+		req.Header.Set("X-Role", tc.role)
+		resp, err := app.App.(*fiber.App).Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		if resp.StatusCode != tc.want {
+			t.Fatalf("%s as %s: status=%d want=%d", tc.path, tc.role, resp.StatusCode, tc.want)
+		}
+	}
+}
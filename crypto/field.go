@@ -0,0 +1,146 @@
+package gw_crypto
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// EncryptedString は DB・Mongo には暗号化して保存し、読み込むと平文に戻る文字列。
+// 電話番号・マイナンバーなどの個人情報のフィールドに使う（JSON には平文で出る）。
+//
+//	type Customer struct {
+//	    Phone      gw_crypto.EncryptedString
+//	    PhoneIndex string `gorm:"type:char(64);index" blindindex:"phone"` // 等価検索が必要なら
+//	}
+//
+// 暗号文は毎回変わるため、Where で値を直接比較しても一致しない。検索は BlindIndex のカラムで行う。
+// 空文字は暗号化せず空文字のまま保存する。
+type EncryptedString string
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	if s == "" {
+		return "", nil
+	}
+	return EncryptField([]byte(s))
+}
+
+func (s *EncryptedString) Scan(src any) error {
+	value, ok, err := scanCiphertext(src)
+	if err != nil || !ok {
+		*s = ""
+		return err
+	}
+	plaintext, err := DecryptField(value)
+	if err != nil {
+		return err
+	}
+	*s = EncryptedString(plaintext)
+	return nil
+}
+
+// GormDataType は gorm のマイグレーションでのカラム型。
+func (EncryptedString) GormDataType() string { return "text" }
+
+func (s EncryptedString) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	value, err := s.Value()
+	if err != nil {
+		return 0, nil, err
+	}
+	return bsontype.String, bsoncore.AppendString(nil, value.(string)), nil
+}
+
+func (s *EncryptedString) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value, err := bsonString(t, data)
+	if err != nil {
+		return err
+	}
+	return s.Scan(value)
+}
+
+// EncryptedJSON は Data を JSON にして暗号化して保存する。住所・口座など複数の項目をまとめて暗号化する場合に使う。
+// NULL・空文字は Data のゼロ値になる。
+type EncryptedJSON[T any] struct {
+	Data T
+}
+
+func (e EncryptedJSON[T]) Value() (driver.Value, error) {
+	plaintext, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil, gw_errors.Wrap(err)
+	}
+	return EncryptField(plaintext)
+}
+
+func (e *EncryptedJSON[T]) Scan(src any) error {
+	var zero T
+	e.Data = zero
+	value, ok, err := scanCiphertext(src)
+	if err != nil || !ok {
+		return err
+	}
+	plaintext, err := DecryptField(value)
+	if err != nil {
+		return err
+	}
+	return gw_errors.Wrap(json.Unmarshal(plaintext, &e.Data))
+}
+
+func (EncryptedJSON[T]) GormDataType() string { return "text" }
+
+// MarshalJSON は API のレスポンス等で Data をそのまま出す。
+func (e EncryptedJSON[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(e.Data)
+}
+
+func (e *EncryptedJSON[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &e.Data)
+}
+
+func (e EncryptedJSON[T]) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	value, err := e.Value()
+	if err != nil {
+		return 0, nil, err
+	}
+	return bsontype.String, bsoncore.AppendString(nil, value.(string)), nil
+}
+
+func (e *EncryptedJSON[T]) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	value, err := bsonString(t, data)
+	if err != nil {
+		return err
+	}
+	return e.Scan(value)
+}
+
+// scanCiphertext は DB から読んだ値を文字列にする。NULL・空文字なら ok=false。
+func scanCiphertext(src any) (string, bool, error) {
+	switch v := src.(type) {
+	case nil:
+		return "", false, nil
+	case string:
+		return v, v != "", nil
+	case []byte:
+		return string(v), len(v) > 0, nil
+	default:
+		return "", false, gw_errors.Errorf("cannot scan %T into an encrypted field", src)
+	}
+}
+
+func bsonString(t bsontype.Type, data []byte) (any, error) {
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		return nil, nil
+	case bsontype.String:
+		value, _, ok := bsoncore.ReadString(data)
+		if !ok {
+			return nil, gw_errors.Wrap(ErrInvalidCiphertext)
+		}
+		return value, nil
+	default:
+		return nil, gw_errors.Errorf("cannot decode bson %s into an encrypted field", t)
+	}
+}
@@ -0,0 +1,138 @@
+package gw_crypto
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type address struct {
+	Zip  string `json:"zip"`
+	City string `json:"city"`
+}
+
+func useTestKeys(t *testing.T, currentId string) {
+	t.Helper()
+	ring, err := NewKeyRing(currentId, map[string][]byte{
+		"k1": []byte("0123456789abcdef0123456789abcdef"),
+		"k2": []byte("fedcba9876543210fedcba9876543210"),
+	}, []byte("blind-index-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetKeyProvider(ring)
+	t.Cleanup(func() { SetKeyProvider(nil) })
+}
+
+func TestEncryptedStringRoundTripAndRotation(t *testing.T) {
+	useTestKeys(t, "k1")
+	stored, err := EncryptedString("090-1234-5678").Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := stored.(string)
+	if strings.Contains(ciphertext, "1234") || FieldKeyId(ciphertext) != "k1" {
+		t.Fatalf("ciphertext=%s", ciphertext)
+	}
+	again, _ := EncryptedString("090-1234-5678").Value()
+	if again == stored {
+		t.Fatal("nonce must make every ciphertext different")
+	}
+
+	// 鍵を k2 に切り替えても k1 の暗号文は読める
+	useTestKeys(t, "k2")
+	var phone EncryptedString
+	if err := phone.Scan([]byte(ciphertext)); err != nil || phone != "090-1234-5678" {
+		t.Fatalf("phone=%q err=%v", phone, err)
+	}
+	rotated, _ := phone.Value()
+	if FieldKeyId(rotated.(string)) != "k2" {
+		t.Fatalf("saving again must use the current key: %s", rotated)
+	}
+
+	if empty, _ := EncryptedString("").Value(); empty != "" {
+		t.Fatalf("empty string must stay empty: %v", empty)
+	}
+	if err := phone.Scan(nil); err != nil || phone != "" {
+		t.Fatalf("NULL: %q %v", phone, err)
+	}
+}
+
+func TestEncryptedFieldErrors(t *testing.T) {
+	useTestKeys(t, "k1")
+	stored, _ := EncryptedString("secret").Value()
+	ciphertext := stored.(string)
+
+	var s EncryptedString
+	tampered := ciphertext[:len(ciphertext)-4] + "AAAA"
+	if err := s.Scan(tampered); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Fatalf("tampered: %v", err)
+	}
+	if err := s.Scan("plain text"); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Fatalf("plaintext: %v", err)
+	}
+	if err := s.Scan(strings.Replace(ciphertext, ":k1:", ":k9:", 1)); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("unknown key: %v", err)
+	}
+	SetKeyProvider(nil)
+	if _, err := EncryptedString("x").Value(); !errors.Is(err, ErrKeyProviderNotSet) {
+		t.Fatalf("no provider: %v", err)
+	}
+
+	if _, err := NewKeyRing("k1", map[string][]byte{"k1": []byte("short")}, nil); err == nil {
+		t.Fatal("short key must be rejected")
+	}
+	if _, err := NewKeyRing("a:b", map[string][]byte{"a:b": make([]byte, 32)}, nil); err == nil {
+		t.Fatal("key id with ':' must be rejected")
+	}
+}
+
+func TestEncryptedJSONAndBlindIndex(t *testing.T) {
+	useTestKeys(t, "k1")
+	stored, err := EncryptedJSON[address]{Data: address{Zip: "100-0001", City: "千代田区"}}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got EncryptedJSON[address]
+	if err := got.Scan(stored); err != nil || got.Data.City != "千代田区" {
+		t.Fatalf("got=%+v err=%v", got, err)
+	}
+
+	a, _ := BlindIndex("09012345678")
+	b, _ := BlindIndex("09012345678")
+	c, _ := BlindIndex("09087654321")
+	if a != b || a == c || len(a) != 64 {
+		t.Fatalf("blind index must be deterministic: %s %s %s", a, b, c)
+	}
+	if empty, _ := BlindIndex(""); empty != "" {
+		t.Fatal("empty value must have an empty index")
+	}
+}
+
+func TestEncryptedFieldsInBSON(t *testing.T) {
+	useTestKeys(t, "k1")
+	type customer struct {
+		Phone   EncryptedString        `bson:"phone"`
+		Address EncryptedJSON[address] `bson:"address"`
+	}
+	data, err := bson.Marshal(customer{Phone: "090-1234-5678", Address: EncryptedJSON[address]{Data: address{City: "大阪市"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw bson.M
+	if err := bson.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if phone, _ := raw["phone"].(string); FieldKeyId(phone) != "k1" {
+		t.Fatalf("phone must be stored encrypted: %v", raw["phone"])
+	}
+	var decoded customer
+	if err := bson.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Phone != "090-1234-5678" || decoded.Address.Data.City != "大阪市" {
+		t.Fatalf("decoded=%+v", decoded)
+	}
+}
@@ -0,0 +1,175 @@
+package gw_crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+)
+
+var (
+	// ErrKeyProviderNotSet は SetKeyProvider が呼ばれていないことを表す。
+	ErrKeyProviderNotSet = errors.New("key provider is not set")
+	// ErrKeyNotFound は暗号文の鍵IDに対応する鍵が無いことを表す（ローテーションで古い鍵を外した等）。
+	ErrKeyNotFound = errors.New("encryption key not found")
+	// ErrInvalidCiphertext は暗号文の形式が不正、または改ざんされていることを表す。
+	ErrInvalidCiphertext = errors.New("invalid ciphertext")
+)
+
+// ciphertextPrefix は暗号化カラムの値の先頭。形式は "enc:v1:<鍵ID>:<base64(nonce+暗号文)>"。
+const ciphertextPrefix = "enc:v1:"
+
+// KeyProvider は暗号化カラムの鍵を提供する。KMS 等から鍵を取る場合はこれを実装する。
+//   - CurrentKey は新しく暗号化するときの鍵とその ID
+//   - Key は復号時に暗号文の鍵IDから鍵を引く（ローテーション前の鍵も返せるようにしておく）
+//   - BlindIndexKey は検索用ハッシュ（BlindIndex）の鍵。暗号化の鍵とは別にし、変えると既存のインデックスは一致しなくなる
+type KeyProvider interface {
+	CurrentKey() (id string, key []byte, err error)
+	Key(id string) ([]byte, error)
+	BlindIndexKey() ([]byte, error)
+}
+
+// KeyRing は鍵をメモリに持つ KeyProvider。
+type KeyRing struct {
+	currentId string
+	keys      map[string][]byte
+	indexKey  []byte
+}
+
+var _ KeyProvider = (*KeyRing)(nil)
+
+// NewKeyRing は currentId の鍵で暗号化し、keys のどれでも復号できる KeyRing を返す。
+// 鍵は AES の 16 / 24 / 32 バイト（GenerateAESKey は 32 バイト）。鍵IDに ":" は使えない。
+// 鍵のローテーションは新しい鍵を keys に加えて currentId を切り替え、全行を読み直して保存したら古い鍵を外す。
+func NewKeyRing(currentId string, keys map[string][]byte, indexKey []byte) (*KeyRing, error) {
+	ring := &KeyRing{currentId: currentId, keys: map[string][]byte{}, indexKey: append([]byte(nil), indexKey...)}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, gw_errors.Errorf("invalid key id: %q", id)
+		}
+		if n := len(key); n != 16 && n != 24 && n != 32 {
+			return nil, gw_errors.Errorf("key %q must be 16, 24 or 32 bytes", id)
+		}
+		ring.keys[id] = append([]byte(nil), key...)
+	}
+	if _, ok := ring.keys[currentId]; !ok {
+		return nil, gw_errors.Errorf("current key %q is not in keys", currentId)
+	}
+	return ring, nil
+}
+
+func (r *KeyRing) CurrentKey() (string, []byte, error) {
+	return r.currentId, r.keys[r.currentId], nil
+}
+
+func (r *KeyRing) Key(id string) ([]byte, error) {
+	key, ok := r.keys[id]
+	if !ok {
+		return nil, gw_errors.Wrap(ErrKeyNotFound, id)
+	}
+	return key, nil
+}
+
+func (r *KeyRing) BlindIndexKey() ([]byte, error) {
+	if len(r.indexKey) == 0 {
+		return nil, gw_errors.New("blind index key is not set")
+	}
+	return r.indexKey, nil
+}
+
+var (
+	providerMu  sync.RWMutex
+	keyProvider KeyProvider
+)
+
+// SetKeyProvider は EncryptedString / EncryptedJSON が使う鍵を設定する。起動時に1回呼ぶ。
+func SetKeyProvider(provider KeyProvider) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	keyProvider = provider
+}
+
+func currentProvider() (KeyProvider, error) {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	if keyProvider == nil {
+		return nil, gw_errors.Wrap(ErrKeyProviderNotSet)
+	}
+	return keyProvider, nil
+}
+
+// EncryptField は plaintext を現在の鍵で AES-GCM 暗号化し、鍵ID付きの文字列にする。
+func EncryptField(plaintext []byte) (string, error) {
+	provider, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	id, key, err := provider.CurrentKey()
+	if err != nil {
+		return "", gw_errors.Wrap(err)
+	}
+	ciphertext, err := EncryptAESGCM(key, plaintext)
+	if err != nil {
+		return "", err
+	}
+	return ciphertextPrefix + id + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// DecryptField は EncryptField の結果を、暗号文に記録された鍵IDの鍵で復号する。
+func DecryptField(value string) ([]byte, error) {
+	id, encoded, ok := strings.Cut(strings.TrimPrefix(value, ciphertextPrefix), ":")
+	if !strings.HasPrefix(value, ciphertextPrefix) || !ok {
+		return nil, gw_errors.Wrap(ErrInvalidCiphertext)
+	}
+	provider, err := currentProvider()
+	if err != nil {
+		return nil, err
+	}
+	key, err := provider.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, gw_errors.Wrap(ErrInvalidCiphertext)
+	}
+	plaintext, err := DecryptAESGCM(key, ciphertext)
+	if err != nil {
+		return nil, gw_errors.Wrap(ErrInvalidCiphertext, err.Error())
+	}
+	return plaintext, nil
+}
+
+// FieldKeyId は暗号文の鍵IDを返す（ローテーションの残りを数える用）。暗号文でなければ空文字。
+func FieldKeyId(value string) string {
+	if !strings.HasPrefix(value, ciphertextPrefix) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, ciphertextPrefix), ":")
+	return id
+}
+
+// BlindIndex は暗号化した値を等価検索するための決定的なハッシュ（HMAC-SHA256 の hex）を返す。空文字は空文字のまま。
+// 同じ値は同じハッシュになるため、値の一致・出現頻度は分かってしまう。電話番号など値の種類が多いものに使う。
+// 表記ゆれ（ハイフン・全角）は呼び出し側で正規化してから渡す。
+func BlindIndex(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	provider, err := currentProvider()
+	if err != nil {
+		return "", err
+	}
+	key, err := provider.BlindIndexKey()
+	if err != nil {
+		return "", gw_errors.Wrap(err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
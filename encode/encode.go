@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	gw_errors "github.com/generalworksinc/goutil/errors"
+	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/japanese"
 	"golang.org/x/text/transform"
 )
@@ -91,3 +92,41 @@ func EucjpByteToUtf8Byte(str []byte) ([]byte, error) {
 	}
 	return ret, nil
 }
+
+// UTF-8 で書き込まれた内容を Shift_JIS に変換して w へ書き出す Writer を返す。
+// Shift_JIS で表せない文字を書き込むとエラーになる。最後に Close で残りを書き出すこと。
+func NewUtf8ToSjisWriter(w io.Writer) io.WriteCloser {
+	return transform.NewWriter(w, japanese.ShiftJIS.NewEncoder())
+}
+
+// UTF-8 で書き込まれた内容を EUC-JP に変換して w へ書き出す Writer を返す。
+// EUC-JP で表せない文字を書き込むとエラーになる。最後に Close で残りを書き出すこと。
+func NewUtf8ToEucjpWriter(w io.Writer) io.WriteCloser {
+	return transform.NewWriter(w, japanese.EUCJP.NewEncoder())
+}
+
+// Shift_JIS で表せない文字を replacement に置き換えた UTF-8 文字列を返す（絵文字など）。
+func ReplaceUnsupportedSjis(str string, replacement string) string {
+	return replaceUnsupported(japanese.ShiftJIS, str, replacement)
+}
+
+// EUC-JP で表せない文字を replacement に置き換えた UTF-8 文字列を返す。
+func ReplaceUnsupportedEucjp(str string, replacement string) string {
+	return replaceUnsupported(japanese.EUCJP, str, replacement)
+}
+
+func replaceUnsupported(enc encoding.Encoding, str string, replacement string) string {
+	encoder := enc.NewEncoder()
+	if _, err := encoder.String(str); err == nil {
+		return str
+	}
+	var b strings.Builder
+	for _, r := range str {
+		if _, err := encoder.String(string(r)); err != nil {
+			b.WriteString(replacement)
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
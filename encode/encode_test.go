@@ -1,6 +1,9 @@
 package gw_encode
 
-import "testing"
+import (
+	"bytes"
+	"testing"
+)
 
 func TestSjisUtf8RoundTrip(t *testing.T) {
 	const s = "あいうABC"
@@ -16,3 +19,33 @@ func TestSjisUtf8RoundTrip(t *testing.T) {
 		t.Fatalf("roundtrip mismatch: %q", utf8)
 	}
 }
+
+func TestUtf8ToSjisWriterStreamsAndReplacesUnsupported(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewUtf8ToSjisWriter(&buf)
+	// マルチバイト文字を途中で分割して書き込んでも変換できること
+	src := []byte("髙橋①")
+	if _, err := w.Write(src[:2]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := w.Write(src[2:]); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	back, err := SjisByteToUtf8Byte(buf.Bytes())
+	if err != nil || string(back) != "髙橋①" {
+		t.Fatalf("roundtrip=%q err=%v", back, err)
+	}
+
+	if got := ReplaceUnsupportedSjis("a😀b", "?"); got != "a?b" {
+		t.Fatalf("ReplaceUnsupportedSjis = %q", got)
+	}
+	if got := ReplaceUnsupportedEucjp("あいう", "?"); got != "あいう" {
+		t.Fatalf("ReplaceUnsupportedEucjp = %q", got)
+	}
+	if _, err := NewUtf8ToEucjpWriter(&buf).Write([]byte("😀")); err == nil {
+		t.Fatal("unsupported rune must fail")
+	}
+}
@@ -208,6 +208,20 @@ func Wrap(err error, objList ...interface{}) error {
 	return newError
 }
 
+// WithCode は err に code（NotFound など）を付ける。err は errors.Is / errors.As でそのまま辿れる。
+// 付けたコードは HasCode で判定する（Wrap で包み直してもコードは変わらない）。
+func WithCode(err error, code ErrorCode) error {
+	if err == nil {
+		return nil
+	}
+	return failure.Translate(err, code)
+}
+
+// HasCode は err に code が付いているかを返す。
+func HasCode(err error, code ErrorCode) bool {
+	return failure.Is(err, code)
+}
+
 func CatchPanic(errPt *error, sendLogger bool) {
 	var err error
 	if r := recover(); r != nil {
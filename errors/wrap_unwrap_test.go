@@ -41,3 +41,17 @@ func TestWrapNilIsNil(t *testing.T) {
 		t.Fatal("Wrap(nil) は nil")
 	}
 }
+
+// WithCode で付けたコードは Wrap 後も HasCode で判定でき、元エラーも errors.Is で辿れること。
+func TestWithCode(t *testing.T) {
+	err := Wrap(WithCode(sentinel, NotFound), "id-1")
+	if !HasCode(err, NotFound) || HasCode(err, Forbidden) {
+		t.Fatalf("code: %v", failure.CodeOf(err))
+	}
+	if !errors.Is(err, sentinel) {
+		t.Fatal("WithCode(err) も errors.Is を透過するべき")
+	}
+	if HasCode(Wrap(sentinel), NotFound) || WithCode(nil, NotFound) != nil {
+		t.Fatal("コードを付けていないエラー・nil")
+	}
+}
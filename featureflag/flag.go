@@ -0,0 +1,185 @@
+// Package gw_featureflag は機能フラグ（テナント・ユーザー単位の出し分けと段階的ロールアウト）を提供する。
+//
+// 判定順序:
+//   - フラグが存在しない / Enabled=false → 無効（全員）
+//   - TenantIds にテナントが含まれる、または UserIds にユーザーが含まれる → 有効
+//   - それ以外はロールアウト率（RolloutPercent）で判定。ユーザーID（無ければテナントID）とフラグ名のハッシュで
+//     0〜99 のバケットに割り当てるため、同じ人は常に同じ結果になる。全員に有効にするには RolloutPercent: 100
+//
+// テナントID・ユーザーIDは gw_log の context から取る（テナントIDは gw_web.TenantResolver が確定したもの）。
+// フラグはプロセス内にキャッシュし、TTL 経過か Invalidate で読み直す。
+package gw_featureflag
+
+import (
+	"context"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_log "github.com/generalworksinc/goutil/logging"
+)
+
+// DefaultCacheTTL はキャッシュの既定の有効期間。他プロセスでの変更はこの時間内に反映される。
+const DefaultCacheTTL = 30 * time.Second
+
+// Subject はフラグを評価する対象（テナント・ユーザー）。
+type Subject struct {
+	TenantId string
+	UserId   string
+}
+
+// SubjectFromContext は context から評価対象を取り出す。
+// テナントは gw_log.WithTenantId（gw_web.TenantResolver が載せる）、ユーザーは gw_log.WithUserId の値。
+func SubjectFromContext(ctx context.Context) Subject {
+	return Subject{
+		TenantId: gw_log.TenantIdFromContext(ctx),
+		UserId:   gw_log.UserIdFromContext(ctx),
+	}
+}
+
+// Store はフラグ定義の永続化先。
+type Store interface {
+	Load(ctx context.Context) ([]FeatureFlag, error)
+	Save(ctx context.Context, flag *FeatureFlag) error
+	Delete(ctx context.Context, name string) error
+}
+
+// Flags はキャッシュ付きのフラグ評価器。複数 goroutine から安全に使える。
+type Flags struct {
+	store Store
+	ttl   time.Duration
+	now   func() time.Time
+
+	mu       sync.RWMutex
+	flags    map[string]FeatureFlag
+	loadedAt time.Time
+	loaded   bool
+}
+
+// New は store から読み込んだフラグを ttl の間キャッシュする評価器を返す。ttl が 0 以下なら DefaultCacheTTL。
+func New(store Store, ttl time.Duration) *Flags {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Flags{store: store, ttl: ttl, now: time.Now}
+}
+
+// Enabled は context のテナント・ユーザーに対して name のフラグが有効かを返す。
+func (f *Flags) Enabled(ctx context.Context, name string) bool {
+	return f.EnabledFor(ctx, name, SubjectFromContext(ctx))
+}
+
+// EnabledFor は subject に対して name のフラグが有効かを返す（バッチ処理など context に対象が無い場合用）。
+// フラグの読み込みに失敗した場合は直前のキャッシュで判定し（ttl の間は再読み込みしない）、キャッシュも無ければ無効とする。
+func (f *Flags) EnabledFor(ctx context.Context, name string, subject Subject) bool {
+	flags, err := f.snapshot(ctx)
+	if err != nil {
+		slog.WarnContext(ctx, "feature flag load failed", slog.String("flag", name), slog.String("error", err.Error()))
+	}
+	flag, ok := flags[name]
+	if !ok {
+		return false
+	}
+	return flag.evaluate(subject)
+}
+
+// Set はフラグを保存し、このプロセスのキャッシュを破棄する。
+func (f *Flags) Set(ctx context.Context, flag *FeatureFlag) error {
+	if flag == nil || flag.Name == "" {
+		return gw_errors.New("feature flag name is required")
+	}
+	if err := f.store.Save(ctx, flag); err != nil {
+		return err
+	}
+	f.Invalidate()
+	return nil
+}
+
+// Delete はフラグを削除し、このプロセスのキャッシュを破棄する。
+func (f *Flags) Delete(ctx context.Context, name string) error {
+	if err := f.store.Delete(ctx, name); err != nil {
+		return err
+	}
+	f.Invalidate()
+	return nil
+}
+
+// Invalidate はキャッシュを破棄し、次の評価で store から読み直させる。
+// 他プロセスでの変更を即時反映したい場合は、通知（pub/sub 等）を受けてこれを呼ぶ。
+func (f *Flags) Invalidate() {
+	f.mu.Lock()
+	f.loaded = false
+	f.mu.Unlock()
+}
+
+func (f *Flags) snapshot(ctx context.Context) (map[string]FeatureFlag, error) {
+	f.mu.RLock()
+	if f.loaded && f.now().Sub(f.loadedAt) < f.ttl {
+		flags := f.flags
+		f.mu.RUnlock()
+		return flags, nil
+	}
+	f.mu.RUnlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// 他の goroutine が先に読み直していればそれを使う
+	if f.loaded && f.now().Sub(f.loadedAt) < f.ttl {
+		return f.flags, nil
+	}
+	list, err := f.store.Load(ctx)
+	if err != nil {
+		// 障害時に評価のたびに store を叩かないよう、直前の内容（初回なら空）を ttl の間使い続ける
+		f.loadedAt = f.now()
+		f.loaded = true
+		return f.flags, err
+	}
+	flags := make(map[string]FeatureFlag, len(list))
+	for _, flag := range list {
+		flags[flag.Name] = flag
+	}
+	f.flags = flags
+	f.loadedAt = f.now()
+	f.loaded = true
+	return flags, nil
+}
+
+func (flag FeatureFlag) evaluate(subject Subject) bool {
+	if !flag.Enabled {
+		return false
+	}
+	if subject.TenantId != "" && slices.Contains(flag.TenantIds, subject.TenantId) {
+		return true
+	}
+	if subject.UserId != "" && slices.Contains(flag.UserIds, subject.UserId) {
+		return true
+	}
+	if flag.RolloutPercent >= 100 {
+		return true
+	}
+	if flag.RolloutPercent <= 0 {
+		return false
+	}
+	key := subject.UserId
+	if key == "" {
+		key = subject.TenantId
+	}
+	if key == "" {
+		// 対象を特定できなければ段階的ロールアウトには含めない
+		return false
+	}
+	return rolloutBucket(flag.Name, key) < flag.RolloutPercent
+}
+
+// rolloutBucket はフラグ名と対象キーから 0〜99 のバケットを決める。
+// フラグ名を混ぜるので、フラグごとに対象の偏りが変わる。
+func rolloutBucket(name string, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return int(h.Sum32() % 100)
+}
@@ -0,0 +1,202 @@
+package gw_featureflag
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func openFlagTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	config := gw_gorm.DefaultConfig(false)
+	config.Logger = logger.Default.LogMode(logger.Silent)
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&FeatureFlag{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// countingStore は Load の呼び出し回数を数え、エラーを差し込める Store
+type countingStore struct {
+	flags []FeatureFlag
+	loads int
+	err   error
+}
+
+func (s *countingStore) Load(context.Context) ([]FeatureFlag, error) {
+	s.loads++
+	return s.flags, s.err
+}
+func (s *countingStore) Save(_ context.Context, flag *FeatureFlag) error {
+	s.flags = append(s.flags, *flag)
+	return nil
+}
+func (s *countingStore) Delete(context.Context, string) error { return nil }
+
+func TestEvaluateTargetingAndRollout(t *testing.T) {
+	flag := FeatureFlag{Name: "new-ui", Enabled: true, TenantIds: []string{"t-beta"}, UserIds: []string{"u-staff"}}
+	cases := []struct {
+		subject Subject
+		want    bool
+	}{
+		{Subject{TenantId: "t-beta"}, true},
+		{Subject{TenantId: "t-other", UserId: "u-staff"}, true},
+		{Subject{TenantId: "t-other", UserId: "u-1"}, false},
+		{Subject{}, false},
+	}
+	for _, c := range cases {
+		if got := flag.evaluate(c.subject); got != c.want {
+			t.Fatalf("subject=%+v got=%v want=%v", c.subject, got, c.want)
+		}
+	}
+
+	flag.Enabled = false
+	if flag.evaluate(Subject{TenantId: "t-beta"}) {
+		t.Fatal("disabled flag must be off even for targeted tenants")
+	}
+
+	all := FeatureFlag{Name: "all", Enabled: true, RolloutPercent: 100}
+	if !all.evaluate(Subject{}) {
+		t.Fatal("100% rollout must include anonymous subjects")
+	}
+}
+
+func TestRolloutIsStableAndRoughlyProportional(t *testing.T) {
+	flag := FeatureFlag{Name: "checkout-v2", Enabled: true, RolloutPercent: 30}
+	on := 0
+	for i := 0; i < 10000; i++ {
+		subject := Subject{UserId: "user-" + strconv.Itoa(i)}
+		first := flag.evaluate(subject)
+		if first != flag.evaluate(subject) {
+			t.Fatalf("rollout must be deterministic for %v", subject)
+		}
+		if first {
+			on++
+		}
+	}
+	if on < 2700 || on > 3300 {
+		t.Fatalf("30%% rollout enabled %d / 10000", on)
+	}
+	// ユーザーが無ければテナントでバケットを決める
+	tenantOnly := Subject{TenantId: "tenant-x"}
+	if flag.evaluate(tenantOnly) != (rolloutBucket(flag.Name, "tenant-x") < 30) {
+		t.Fatal("tenant id must be used as rollout key when user id is absent")
+	}
+}
+
+func TestFlagsReadSubjectFromContext(t *testing.T) {
+	store := &countingStore{flags: []FeatureFlag{
+		{Name: "tenant-feature", Enabled: true, TenantIds: []string{"t1"}},
+		{Name: "user-feature", Enabled: true, UserIds: []string{"u1"}},
+	}}
+	flags := New(store, time.Minute)
+
+	ctx := gw_log.WithTenantId(context.Background(), "t1")
+	ctx = gw_log.WithUserId(ctx, "u1")
+	if !flags.Enabled(ctx, "tenant-feature") || !flags.Enabled(ctx, "user-feature") {
+		t.Fatal("tenant/user from context must be used")
+	}
+	// Scope だけでは対象にしない（テナントは TenantResolver が確定したものを使う）
+	scoped := gw_gorm.WithScopeContext(context.Background(), &gw_gorm.Scope{TenantIds: []string{"t1"}})
+	if flags.Enabled(scoped, "tenant-feature") {
+		t.Fatal("scope must not be used as the targeting key")
+	}
+	if flags.Enabled(ctx, "unknown") {
+		t.Fatal("unknown flag must be off")
+	}
+	if store.loads != 1 {
+		t.Fatalf("flags must be cached, loads=%d", store.loads)
+	}
+}
+
+func TestFlagsCacheTTLAndInvalidation(t *testing.T) {
+	store := &countingStore{}
+	flags := New(store, time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	flags.now = func() time.Time { return now }
+	subject := Subject{UserId: "u1"}
+
+	if flags.EnabledFor(context.Background(), "f", subject) {
+		t.Fatal("flag must be off before it exists")
+	}
+	// 別プロセスが保存したケース: TTL 内はキャッシュのまま
+	store.flags = []FeatureFlag{{Name: "f", Enabled: true, RolloutPercent: 100}}
+	if flags.EnabledFor(context.Background(), "f", subject) {
+		t.Fatal("cached value must be used within ttl")
+	}
+	now = now.Add(time.Minute)
+	if !flags.EnabledFor(context.Background(), "f", subject) {
+		t.Fatal("flag must be reloaded after ttl")
+	}
+
+	// Set は自プロセスのキャッシュを即時破棄する
+	if err := flags.Set(context.Background(), &FeatureFlag{Name: "g", Enabled: true, RolloutPercent: 100}); err != nil {
+		t.Fatal(err)
+	}
+	if !flags.EnabledFor(context.Background(), "g", subject) {
+		t.Fatal("Set must invalidate the cache")
+	}
+	if err := flags.Set(context.Background(), &FeatureFlag{}); err == nil {
+		t.Fatal("flag without name must be rejected")
+	}
+
+	// 読み込み失敗時は直前のキャッシュで判定し、TTL の間は store を叩かない
+	loads := store.loads
+	store.err = errors.New("db down")
+	flags.Invalidate()
+	for i := 0; i < 3; i++ {
+		if !flags.EnabledFor(context.Background(), "f", subject) {
+			t.Fatal("stale cache must be used while the store is failing")
+		}
+	}
+	if store.loads != loads+1 {
+		t.Fatalf("failing store must be retried only after ttl, loads=%d", store.loads-loads)
+	}
+}
+
+func TestGormStoreRoundTrip(t *testing.T) {
+	db := openFlagTestDB(t)
+	if !db.Migrator().HasTable("feature_flag") {
+		t.Fatal("table name must be feature_flag")
+	}
+	flags := New(NewGormStore(db), time.Minute)
+	ctx := context.Background()
+
+	if err := flags.Set(ctx, &FeatureFlag{Name: "beta", Enabled: true, TenantIds: []string{"t1"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !flags.EnabledFor(ctx, "beta", Subject{TenantId: "t1"}) || flags.EnabledFor(ctx, "beta", Subject{TenantId: "t2"}) {
+		t.Fatal("stored tenant targeting must be applied")
+	}
+	// 同名で保存すると上書きされる
+	if err := flags.Set(ctx, &FeatureFlag{Name: "beta", Enabled: true, TenantIds: []string{"t2"}}); err != nil {
+		t.Fatal(err)
+	}
+	if flags.EnabledFor(ctx, "beta", Subject{TenantId: "t1"}) || !flags.EnabledFor(ctx, "beta", Subject{TenantId: "t2"}) {
+		t.Fatal("upsert must replace the targeting")
+	}
+	var count int64
+	db.Model(&FeatureFlag{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("rows=%d, want 1", count)
+	}
+
+	if err := flags.Delete(ctx, "beta"); err != nil {
+		t.Fatal(err)
+	}
+	if flags.EnabledFor(ctx, "beta", Subject{TenantId: "t2"}) {
+		t.Fatal("deleted flag must be off")
+	}
+}
@@ -0,0 +1,59 @@
+package gw_featureflag
+
+import (
+	"context"
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FeatureFlag はフラグ定義の永続化テーブル。マイグレーションで AutoMigrate に渡す。
+// SingularTable 命名でテーブル名は feature_flag になる。
+// テナント横断の設定テーブルなのでテナントガードのマーカーは実装しない。
+type FeatureFlag struct {
+	Name        string `gorm:"primaryKey;type:varchar(128)"`
+	Description string `gorm:"type:varchar(512)"`
+	// Enabled はフラグ全体のスイッチ（false なら対象指定・ロールアウト率に関わらず無効）
+	Enabled bool
+	// TenantIds / UserIds は個別に有効にする対象
+	TenantIds []string `gorm:"type:text;serializer:json"`
+	UserIds   []string `gorm:"type:text;serializer:json"`
+	// RolloutPercent は上記以外の対象に有効にする割合（0〜100）
+	RolloutPercent int
+	UpdatedAt      time.Time
+}
+
+// GormStore は FeatureFlag テーブルを使う Store。
+type GormStore struct {
+	db *gorm.DB
+}
+
+var _ Store = (*GormStore)(nil)
+
+// NewGormStore は db の feature_flag テーブルを使う Store を返す。
+func NewGormStore(db *gorm.DB) *GormStore {
+	return &GormStore{db: db}
+}
+
+func (s *GormStore) Load(ctx context.Context) ([]FeatureFlag, error) {
+	var flags []FeatureFlag
+	if err := s.db.WithContext(ctx).Order("name").Find(&flags).Error; err != nil {
+		return nil, gw_errors.Wrap(err)
+	}
+	return flags, nil
+}
+
+// Save は name をキーにフラグを作成または上書きする。
+func (s *GormStore) Save(ctx context.Context, flag *FeatureFlag) error {
+	err := s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		UpdateAll: true,
+	}).Create(flag).Error
+	return gw_errors.Wrap(err)
+}
+
+func (s *GormStore) Delete(ctx context.Context, name string) error {
+	return gw_errors.Wrap(s.db.WithContext(ctx).Where("name = ?", name).Delete(&FeatureFlag{}).Error)
+}
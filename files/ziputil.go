@@ -2,6 +2,7 @@ package gw_files
 
 import (
 	"bytes"
+	"io"
 
 	gw_errors "github.com/generalworksinc/goutil/errors"
 	"github.com/yeka/zip"
@@ -33,3 +34,38 @@ func CreateZipBuffer(fileName string, content []byte, password string) (*bytes.B
 
 	return buf, nil
 }
+
+// ZipWriter は複数のファイルを順に w へ書き出す zip。CreateZipBuffer と違い内容をメモリに溜めない。
+// password が空でなければ CreateZipBuffer と同じく各ファイルを AES-256 で暗号化する。
+type ZipWriter struct {
+	w        *zip.Writer
+	password string
+}
+
+// NewZipWriter は w へ書き出す ZipWriter を返す。password が空なら暗号化しない。書き終えたら Close を呼ぶ。
+func NewZipWriter(w io.Writer, password string) *ZipWriter {
+	return &ZipWriter{w: zip.NewWriter(w), password: password}
+}
+
+// Create は fileName のファイルを追加し、その内容の書き込み先を返す。次の Create / Close までに書き終えること。
+func (z *ZipWriter) Create(fileName string) (io.Writer, error) {
+	var f io.Writer
+	var err error
+	if z.password != "" {
+		f, err = z.w.Encrypt(fileName, z.password, zip.AES256Encryption)
+	} else {
+		f, err = z.w.Create(fileName)
+	}
+	if err != nil {
+		return nil, gw_errors.Wrap(err)
+	}
+	return f, nil
+}
+
+// Close は zip の末尾（セントラルディレクトリ）を書き出す。元の w は閉じない。
+func (z *ZipWriter) Close() error {
+	if err := z.w.Close(); err != nil {
+		return gw_errors.Wrap(err)
+	}
+	return nil
+}
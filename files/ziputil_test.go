@@ -0,0 +1,58 @@
+package gw_files
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/yeka/zip"
+)
+
+func readZip(t *testing.T, data []byte, password string) map[string]string {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range r.File {
+		if f.IsEncrypted() {
+			f.SetPassword(password)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestZipWriter(t *testing.T) {
+	for _, password := range []string{"", "long-long-password"} {
+		var buf bytes.Buffer
+		z := NewZipWriter(&buf, password)
+		for name, content := range map[string]string{"a.jsonl": "{\"id\":1}\n", "b.jsonl": ""} {
+			f, err := z.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			io.WriteString(f, content)
+		}
+		if err := z.Close(); err != nil {
+			t.Fatal(err)
+		}
+		files := readZip(t, buf.Bytes(), password)
+		if len(files) != 2 || files["a.jsonl"] != "{\"id\":1}\n" {
+			t.Fatalf("password=%q files=%v", password, files)
+		}
+		if password != "" && bytes.Contains(buf.Bytes(), []byte("{\"id\":1}")) {
+			t.Fatal("content must be encrypted")
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package gw_gorm
+
+// このファイルは作成者・更新者・削除者（CreatedBy / UpdatedBy / DeletedBy）を持つベースモデルと、
+// リクエスト context のユーザーIDでそれらを埋めるコールバック（UseActorStamp）を置く。
+
+import (
+	"fmt"
+	"reflect"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"gorm.io/gorm"
+)
+
+// Actors は作成者・更新者。BaseModelByManualId などと組み合わせて埋め込む。
+type Actors struct {
+	CreatedBy string `gorm:"type:varchar(64)" json:"createdBy"`
+	UpdatedBy string `gorm:"type:varchar(64)" json:"updatedBy"`
+}
+
+// ActorsLogicalDel は Actors に論理削除の実行者を加えたもの。DeletedAt を持つモデルと組み合わせる。
+type ActorsLogicalDel struct {
+	Actors
+	DeletedBy string `gorm:"type:varchar(64)" json:"deletedBy"`
+}
+
+type BaseModelWithActors struct {
+	BaseModel
+	Actors
+}
+
+type BaseModelLogicalDelWithActors struct {
+	BaseModelLogicalDel
+	ActorsLogicalDel
+}
+
+type BaseModelUlidWithActors struct {
+	BaseModelUlid
+	Actors
+}
+
+type BaseModelLogicalDelUlidWithActors struct {
+	BaseModelLogicalDelUlid
+	ActorsLogicalDel
+}
+
+// UseActorStamp は created_by / updated_by / deleted_by カラムを持つモデルに、gw_log.UserIdFromContext のユーザーIDを埋める。
+//   - Create: created_by / updated_by が空ならセット（シード等で明示した値は上書きしない）
+//   - Update: updated_by を常に上書き（Select で列を絞った struct の Update では対象外になる）
+//   - 論理削除: 同じ条件で deleted_by を更新してから deleted_at をセットする（Unscoped の物理削除では何もしない）
+//
+// ユーザーIDが context に無い操作（バッチ等）では何もしない。
+// UseAuditLog と併用する場合は UseAuditLog を先に登録すると、soft_delete の差分に deleted_by も含まれる。
+func UseActorStamp(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if callbacks.Create().Get("gw_gorm:actor_create") == nil {
+		if err := callbacks.Create().Before("gorm:create").Register("gw_gorm:actor_create", actorStampCreate); err != nil {
+			return err
+		}
+	}
+	if callbacks.Update().Get("gw_gorm:actor_update") == nil {
+		if err := callbacks.Update().Before("gorm:update").Register("gw_gorm:actor_update", actorStampUpdate); err != nil {
+			return err
+		}
+	}
+	if callbacks.Delete().Get("gw_gorm:actor_delete") == nil {
+		if err := callbacks.Delete().Before("gorm:delete").Register("gw_gorm:actor_delete", actorStampDelete); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func actorUserId(db *gorm.DB, column string) string {
+	if db.Error != nil || db.Statement == nil || db.Statement.Schema == nil || db.Statement.Schema.LookUpField(column) == nil || isInternalWrite(db) {
+		return ""
+	}
+	return gw_log.UserIdFromContext(db.Statement.Context)
+}
+
+func actorStampCreate(db *gorm.DB) {
+	userId := actorUserId(db, "created_by")
+	if userId == "" {
+		return
+	}
+	applyToReflectValues(db.Statement, func(v reflect.Value) {
+		setStringIfEmpty(db, v, "created_by", userId)
+		setStringIfEmpty(db, v, "updated_by", userId)
+	})
+}
+
+func actorStampUpdate(db *gorm.DB) {
+	if userId := actorUserId(db, "updated_by"); userId != "" {
+		db.Statement.SetColumn("updated_by", userId, true)
+	}
+}
+
+func actorStampDelete(db *gorm.DB) {
+	userId := actorUserId(db, "deleted_by")
+	if userId == "" || db.Statement.Unscoped || !hasSoftDelete(db.Statement.Schema) || db.DryRun {
+		return
+	}
+	if !db.AllowGlobalUpdate && !hasMutationCallerCondition(db.Statement) {
+		return
+	}
+	// 論理削除の UPDATE は GORM が SET 句を組み立てるため、同じトランザクション内で先に deleted_by を更新する
+	if err := markInternalWrite(mutationTargets(db)).UpdateColumn("deleted_by", userId).Error; err != nil {
+		db.AddError(fmt.Errorf("stamp deleted_by: %w", err))
+	}
+}
+
+const internalWriteKey = "gw_gorm:internal_write"
+
+// markInternalWrite は gw_gorm のコールバック自身が発行する補助的な更新に印を付け、
+// UpdatedBy の上書きや監査ログの二重記録の対象から外す。
+func markInternalWrite(db *gorm.DB) *gorm.DB {
+	return db.Set(internalWriteKey, true)
+}
+
+func isInternalWrite(db *gorm.DB) bool {
+	v, ok := db.Get(internalWriteKey)
+	internal, _ := v.(bool)
+	return ok && internal
+}
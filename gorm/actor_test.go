@@ -0,0 +1,137 @@
+package gw_gorm
+
+import (
+	"context"
+	"testing"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"gorm.io/gorm"
+)
+
+type actorNote struct {
+	BaseModelLogicalDelUlidWithActors
+	Title string
+}
+
+type actorTag struct {
+	BaseModelWithActors
+	Name string
+}
+
+func openActorTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTransactionTestDB(t)
+	if err := UseActorStamp(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&actorNote{}, &actorTag{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestActorStampCreateAndUpdate(t *testing.T) {
+	db := openActorTestDB(t)
+	alice := db.WithContext(gw_log.WithUserId(context.Background(), "alice"))
+	bob := db.WithContext(gw_log.WithUserId(context.Background(), "bob"))
+
+	note := actorNote{Title: "draft"}
+	if err := alice.Create(&note).Error; err != nil {
+		t.Fatal(err)
+	}
+	if note.Id == "" || note.CreatedBy != "alice" || note.UpdatedBy != "alice" {
+		t.Fatalf("created note=%+v", note)
+	}
+	// 明示した作成者は上書きしない（シード・移行データ）
+	seeded := actorTag{Name: "seed"}
+	seeded.CreatedBy = "system"
+	if err := alice.Create(&seeded).Error; err != nil || seeded.CreatedBy != "system" || seeded.UpdatedBy != "alice" {
+		t.Fatalf("seeded=%+v err=%v", seeded, err)
+	}
+
+	if err := bob.Model(&note).Update("title", "final").Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := bob.Model(&actorTag{}).Where("name = ?", "seed").Updates(map[string]any{"name": "renamed"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var stored actorNote
+	db.First(&stored, "id = ?", note.Id)
+	if stored.CreatedBy != "alice" || stored.UpdatedBy != "bob" || stored.Title != "final" {
+		t.Fatalf("stored note=%+v", stored)
+	}
+	var tag actorTag
+	db.First(&tag, "id = ?", seeded.Id)
+	if tag.UpdatedBy != "bob" {
+		t.Fatalf("map update must stamp updated_by: %+v", tag)
+	}
+
+	// ユーザーの無い context（バッチ）では触らない
+	if err := db.Model(&stored).Update("title", "batch").Error; err != nil {
+		t.Fatal(err)
+	}
+	db.First(&stored, "id = ?", note.Id)
+	if stored.UpdatedBy != "bob" {
+		t.Fatalf("batch update must keep updated_by: %+v", stored)
+	}
+}
+
+func TestActorStampSoftDelete(t *testing.T) {
+	db := openActorTestDB(t)
+	ctx := gw_log.WithUserId(context.Background(), "alice")
+	notes := []actorNote{{Title: "a"}, {Title: "b"}}
+	if err := db.WithContext(ctx).Create(&notes).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.WithContext(gw_log.WithUserId(context.Background(), "carol")).Delete(&notes[0]).Error; err != nil {
+		t.Fatal(err)
+	}
+	var deleted actorNote
+	if err := db.Unscoped().First(&deleted, "id = ?", notes[0].Id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if deleted.DeletedBy != "carol" || !deleted.DeletedAt.Valid || deleted.UpdatedBy != "alice" {
+		t.Fatalf("deleted=%+v", deleted)
+	}
+	var other actorNote
+	db.First(&other, "id = ?", notes[1].Id)
+	if other.DeletedBy != "" {
+		t.Fatalf("other rows must not be stamped: %+v", other)
+	}
+}
+
+func TestActorStampWithAuditLog(t *testing.T) {
+	db := openTransactionTestDB(t)
+	if err := UseAuditLog(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := UseActorStamp(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&auditedActorNote{}, &AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := gw_log.WithUserId(context.Background(), "alice")
+	note := auditedActorNote{Title: "a"}
+	if err := db.WithContext(ctx).Create(&note).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.WithContext(ctx).Delete(&note).Error; err != nil {
+		t.Fatal(err)
+	}
+	logs := auditLogsOf(t, db, AuditActionSoftDelete)
+	if len(logs) != 1 || string(logs[0].Changes["deleted_by"].New) != `"alice"` {
+		t.Fatalf("soft delete log must include deleted_by: %+v", logs)
+	}
+	if updates := auditLogsOf(t, db, AuditActionUpdate); len(updates) != 0 {
+		t.Fatalf("stamping deleted_by must not be audited as an update: %+v", updates)
+	}
+}
+
+type auditedActorNote struct {
+	BaseModelLogicalDelWithActors
+	Title string
+}
+
+func (auditedActorNote) Audited() {}
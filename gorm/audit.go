@@ -0,0 +1,324 @@
+package gw_gorm
+
+// このファイルは監査ログ（誰が・いつ・何を変更したか）を GORM のコールバックで自動記録する。
+// AuditedModel を実装したモデルの Create / Update / Delete ごとに audit_log へ1行ずつ書き込む。
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+	gw_uuid "github.com/generalworksinc/goutil/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// AuditedModel は監査ログ対象のマーカー。モデルに `func (Todo) Audited() {}` を1行書くと対象になる。
+// パスワード等の値を残したくないフィールドには `audit:"-"` タグを付ける（変更があったことだけを記録する）。
+type AuditedModel interface{ Audited() }
+
+// 監査ログの操作種別。
+const (
+	AuditActionCreate     = "create"
+	AuditActionUpdate     = "update"
+	AuditActionDelete     = "delete"
+	AuditActionSoftDelete = "soft_delete"
+)
+
+// AuditRedacted は `audit:"-"` フィールドの値の代わりに記録する文字列。
+const AuditRedacted = "[REDACTED]"
+
+// AuditChange は1カラムの変更前後の値（JSON）。作成時は Old、物理削除時は New が無い。
+type AuditChange struct {
+	Old json.RawMessage `json:"old,omitempty"`
+	New json.RawMessage `json:"new,omitempty"`
+}
+
+// AuditLog は監査ログのテーブル（audit_log）。マイグレーションで作成する。
+// テナントの管理者が自テナントの履歴を参照できるよう TenantScopedModel にしている（書き込みはガードを外して行う）。
+type AuditLog struct {
+	Id          string                 `gorm:"type:varchar(46);primaryKey" json:"id"`
+	TenantId    string                 `gorm:"type:varchar(64);index" json:"tenantId"`
+	ActorId     string                 `gorm:"type:varchar(64)" json:"actorId"`
+	RequestId   string                 `gorm:"type:varchar(64)" json:"requestId"`
+	Action      string                 `gorm:"type:varchar(16)" json:"action"`
+	TargetTable string                 `gorm:"type:varchar(128);index:idx_audit_log_target" json:"targetTable"`
+	TargetId    string                 `gorm:"type:varchar(255);index:idx_audit_log_target" json:"targetId"`
+	Changes     map[string]AuditChange `gorm:"type:text;serializer:json" json:"changes"`
+	CreatedAt   time.Time              `json:"createdAt"`
+}
+
+func (AuditLog) TableName() string { return "audit_log" }
+func (AuditLog) TenantScoped()     {}
+
+const auditBeforeKey = "gw_gorm:audit_before"
+
+// UseAuditLog は AuditedModel への Create / Update / Delete を audit_log へ記録するコールバックを登録する。
+//   - 操作者は gw_log.UserIdFromContext、リクエストIDは gw_log.RequestIdFromContext
+//   - テナントは行の tenant_id（無ければ単一テナントの Scope）
+//   - Update / Delete は実行前に対象行を読み、変更されたカラムだけを記録する（UpdatedAt の自動更新は除く）
+//   - 論理削除（gorm.DeletedAt）は soft_delete として deleted_at の変化を記録し、Unscoped の削除は delete になる
+//
+// 監査ログは操作と同じトランザクションで書き込むため、操作がロールバックされれば監査ログも残らない
+// （SkipDefaultTransaction の場合は同一トランザクションにならない）。Raw()/Exec() の生 SQL は記録されない。
+func UseAuditLog(db *gorm.DB) error {
+	const commit = "gorm:commit_or_rollback_transaction"
+	callbacks := db.Callback()
+	if callbacks.Create().Get("gw_gorm:audit_create") == nil {
+		if err := callbacks.Create().After("gorm:after_create").Before(commit).Register("gw_gorm:audit_create", auditAfterCreate); err != nil {
+			return err
+		}
+	}
+	if callbacks.Update().Get("gw_gorm:audit_update_before") == nil {
+		if err := callbacks.Update().After("gw_gorm:tenant_guard_update").Before("gorm:update").Register("gw_gorm:audit_update_before", auditBefore); err != nil {
+			return err
+		}
+	}
+	if callbacks.Update().Get("gw_gorm:audit_update") == nil {
+		if err := callbacks.Update().After("gorm:after_update").Before(commit).Register("gw_gorm:audit_update", auditAfterUpdate); err != nil {
+			return err
+		}
+	}
+	if callbacks.Delete().Get("gw_gorm:audit_delete_before") == nil {
+		if err := callbacks.Delete().After("gw_gorm:tenant_guard_delete").Before("gorm:delete").Register("gw_gorm:audit_delete_before", auditBefore); err != nil {
+			return err
+		}
+	}
+	if callbacks.Delete().Get("gw_gorm:audit_delete") == nil {
+		if err := callbacks.Delete().After("gorm:after_delete").Before(commit).Register("gw_gorm:audit_delete", auditAfterDelete); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isAudited(db *gorm.DB) bool {
+	return db.Error == nil && !db.DryRun && db.Statement != nil && db.Statement.Schema != nil && !isInternalWrite(db) &&
+		implements[AuditedModel](db.Statement.Schema)
+}
+
+func auditAfterCreate(db *gorm.DB) {
+	if !isAudited(db) {
+		return
+	}
+	var logs []AuditLog
+	applyToReflectValues(db.Statement, func(v reflect.Value) {
+		logs = append(logs, newAuditLog(db, AuditActionCreate, v, auditChanges(db, reflect.Value{}, v)))
+	})
+	writeAuditLogs(db, logs)
+}
+
+// auditBefore は Update / Delete の対象行を実行前に読んでおく。
+func auditBefore(db *gorm.DB) {
+	if !isAudited(db) {
+		return
+	}
+	stmt := db.Statement
+	if !db.AllowGlobalUpdate && !hasMutationCallerCondition(stmt) {
+		// 条件なしの Update / Delete は GORM が ErrMissingWhereClause で拒否する
+		return
+	}
+	tx := mutationTargets(db)
+	before := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if err := tx.Find(before.Interface()).Error; err != nil {
+		db.AddError(fmt.Errorf("audit log: %w", err))
+		return
+	}
+	db.InstanceSet(auditBeforeKey, before.Elem())
+}
+
+func auditAfterUpdate(db *gorm.DB) {
+	if !isAudited(db) {
+		return
+	}
+	writeAuditLogs(db, auditDiffs(db, AuditActionUpdate))
+}
+
+func auditAfterDelete(db *gorm.DB) {
+	if !isAudited(db) {
+		return
+	}
+	if !db.Statement.Unscoped && hasSoftDelete(db.Statement.Schema) {
+		writeAuditLogs(db, auditDiffs(db, AuditActionSoftDelete))
+		return
+	}
+	before, ok := auditBeforeRows(db)
+	if !ok {
+		return
+	}
+	var logs []AuditLog
+	for i := 0; i < before.Len(); i++ {
+		row := before.Index(i)
+		logs = append(logs, newAuditLog(db, AuditActionDelete, row, auditChanges(db, row, reflect.Value{})))
+	}
+	writeAuditLogs(db, logs)
+}
+
+// auditDiffs は実行前に読んだ行を読み直し、変更のあった行だけを返す。
+func auditDiffs(db *gorm.DB, action string) []AuditLog {
+	before, ok := auditBeforeRows(db)
+	if !ok || before.Len() == 0 {
+		return nil
+	}
+	s := db.Statement.Schema
+	keys := make([]string, 0, before.Len())
+	for i := 0; i < before.Len(); i++ {
+		keys = append(keys, auditPrimaryKey(db, before.Index(i)))
+	}
+	after := reflect.New(reflect.SliceOf(s.ModelType))
+	_, values := schema.GetIdentityFieldValuesMap(db.Statement.Context, before, s.PrimaryFields)
+	column, queryValues := schema.ToQueryValues(clause.CurrentTable, s.PrimaryFieldDBNames, values)
+	if err := auditSession(db).Unscoped().Where(clause.IN{Column: column, Values: queryValues}).Find(after.Interface()).Error; err != nil {
+		db.AddError(fmt.Errorf("audit log: %w", err))
+		return nil
+	}
+	afterByKey := map[string]reflect.Value{}
+	for i := 0; i < after.Elem().Len(); i++ {
+		row := after.Elem().Index(i)
+		afterByKey[auditPrimaryKey(db, row)] = row
+	}
+	var logs []AuditLog
+	for i := 0; i < before.Len(); i++ {
+		row, found := afterByKey[keys[i]]
+		if !found {
+			continue
+		}
+		if changes := auditChanges(db, before.Index(i), row); len(changes) > 0 {
+			logs = append(logs, newAuditLog(db, action, row, changes))
+		}
+	}
+	return logs
+}
+
+func auditBeforeRows(db *gorm.DB) (reflect.Value, bool) {
+	v, ok := db.InstanceGet(auditBeforeKey)
+	if !ok {
+		return reflect.Value{}, false
+	}
+	rows, ok := v.(reflect.Value)
+	return rows, ok
+}
+
+// mutationTargets は実行中の Update / Delete と同じ条件（WHERE・主キー・論理削除の有無）で対象行を絞ったセッションを返す。
+func mutationTargets(db *gorm.DB) *gorm.DB {
+	stmt := db.Statement
+	tx := auditSession(db).Model(reflect.New(stmt.Schema.ModelType).Interface())
+	if stmt.Unscoped {
+		tx = tx.Unscoped()
+	}
+	if where, ok := stmt.Clauses["WHERE"].Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+		tx.Statement.AddClause(clause.Where{Exprs: append([]clause.Expression(nil), where.Exprs...)})
+	}
+	for _, source := range []reflect.Value{stmt.ReflectValue, reflect.ValueOf(stmt.Model)} {
+		if !source.IsValid() {
+			continue
+		}
+		_, values := schema.GetIdentityFieldValuesMap(stmt.Context, source, stmt.Schema.PrimaryFields)
+		if column, queryValues := schema.ToQueryValues(clause.CurrentTable, stmt.Schema.PrimaryFieldDBNames, values); len(queryValues) > 0 {
+			tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.IN{Column: column, Values: queryValues}}})
+		}
+	}
+	return tx
+}
+
+// auditSession は同じトランザクション・context で監査用の読み書きをするセッションを返す。
+// 監査は Scope とは独立に記録する必要があるため、呼び出し元が BypassTenantGuard / BypassRLS していればそれを引き継ぐ。
+func auditSession(db *gorm.DB) *gorm.DB {
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true})
+	if shouldSkip(db) {
+		tx = BypassTenantGuard(tx)
+	}
+	if bypassesRLS(db) {
+		tx = BypassRLS(tx)
+	}
+	return tx
+}
+
+func writeAuditLogs(db *gorm.DB, logs []AuditLog) {
+	if db.Error != nil || len(logs) == 0 {
+		return
+	}
+	// audit_log は TenantScopedModel だが、行の tenant_id は記録対象から決めるためガードを外して書く
+	tx := BypassTenantGuard(db.Session(&gorm.Session{NewDB: true, SkipHooks: true}))
+	if bypassesRLS(db) {
+		tx = BypassRLS(tx)
+	}
+	if err := tx.Create(&logs).Error; err != nil {
+		db.AddError(fmt.Errorf("audit log: %w", err))
+	}
+}
+
+func newAuditLog(db *gorm.DB, action string, row reflect.Value, changes map[string]AuditChange) AuditLog {
+	ctx := db.Statement.Context
+	tenantId := getStringValue(db, row, "tenant_id")
+	if tenantId == "" {
+		tenantId, _ = tenantIdFromContext(ctx)
+	}
+	return AuditLog{
+		Id:          gw_uuid.GetUlid(),
+		TenantId:    tenantId,
+		ActorId:     gw_log.UserIdFromContext(ctx),
+		RequestId:   gw_log.RequestIdFromContext(ctx),
+		Action:      action,
+		TargetTable: db.Statement.Table,
+		TargetId:    auditPrimaryKey(db, row),
+		Changes:     changes,
+		CreatedAt:   db.NowFunc(),
+	}
+}
+
+// auditChanges は before → after で値が変わったカラムを返す。before / after の片方が無効なら全カラムを記録する。
+func auditChanges(db *gorm.DB, before reflect.Value, after reflect.Value) map[string]AuditChange {
+	changes := map[string]AuditChange{}
+	for _, field := range db.Statement.Schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		oldValue := auditValue(db, field, before)
+		newValue := auditValue(db, field, after)
+		if before.IsValid() && after.IsValid() && (field.AutoUpdateTime > 0 || string(oldValue) == string(newValue)) {
+			continue
+		}
+		if field.Tag.Get("audit") == "-" {
+			redacted, _ := json.Marshal(AuditRedacted)
+			if oldValue != nil {
+				oldValue = redacted
+			}
+			if newValue != nil {
+				newValue = redacted
+			}
+		}
+		changes[field.DBName] = AuditChange{Old: oldValue, New: newValue}
+	}
+	return changes
+}
+
+func auditValue(db *gorm.DB, field *schema.Field, row reflect.Value) json.RawMessage {
+	if !row.IsValid() {
+		return nil
+	}
+	value, _ := field.ValueOf(db.Statement.Context, row)
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		encoded, _ = json.Marshal(fmt.Sprint(value))
+	}
+	return encoded
+}
+
+// auditPrimaryKey は主キーの値を文字列にする（複合主キーはカンマ区切り）。
+func auditPrimaryKey(db *gorm.DB, row reflect.Value) string {
+	keys := make([]string, 0, len(db.Statement.Schema.PrimaryFields))
+	for _, field := range db.Statement.Schema.PrimaryFields {
+		value, _ := field.ValueOf(db.Statement.Context, row)
+		keys = append(keys, fmt.Sprint(value))
+	}
+	return strings.Join(keys, ",")
+}
+
+func hasSoftDelete(s *schema.Schema) bool {
+	return findSoftDeleteField(s) != nil
+}
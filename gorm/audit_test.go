@@ -0,0 +1,141 @@
+package gw_gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"gorm.io/gorm"
+)
+
+type auditedNote struct {
+	Id        string
+	TenantId  string
+	Title     string
+	Secret    string `audit:"-"`
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt
+}
+
+func (auditedNote) TenantScoped() {}
+func (auditedNote) Audited()      {}
+
+func openAuditTestDB(t *testing.T) (*gorm.DB, context.Context) {
+	t.Helper()
+	db := openTransactionTestDB(t)
+	if err := UseAuditLog(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&auditedNote{}, &AuditLog{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithScopeContext(context.Background(), singleScope())
+	ctx = gw_log.WithUserId(gw_log.WithRequestId(ctx, "req-1"), "u1")
+	return db, ctx
+}
+
+func auditLogsOf(t *testing.T, db *gorm.DB, action string) []AuditLog {
+	t.Helper()
+	var logs []AuditLog
+	if err := BypassTenantGuard(db).Where("action = ?", action).Order("target_id").Find(&logs).Error; err != nil {
+		t.Fatal(err)
+	}
+	return logs
+}
+
+func TestAuditLogCreateAndUpdate(t *testing.T) {
+	db, ctx := openAuditTestDB(t)
+	scoped := db.WithContext(ctx)
+
+	if err := scoped.Create(&[]auditedNote{{Id: "n1", Title: "draft", Secret: "s1"}, {Id: "n2", Title: "draft"}}).Error; err != nil {
+		t.Fatal(err)
+	}
+	created := auditLogsOf(t, db, AuditActionCreate)
+	if len(created) != 2 {
+		t.Fatalf("created logs=%+v", created)
+	}
+	log := created[0]
+	if log.TenantId != "t1" || log.ActorId != "u1" || log.RequestId != "req-1" || log.TargetTable != "audited_notes" || log.TargetId != "n1" {
+		t.Fatalf("create log=%+v", log)
+	}
+	if string(log.Changes["title"].New) != `"draft"` || log.Changes["title"].Old != nil || string(log.Changes["secret"].New) != `"[REDACTED]"` {
+		t.Fatalf("create changes=%v", log.Changes)
+	}
+
+	if err := scoped.Model(&auditedNote{Id: "n1"}).Updates(map[string]any{"title": "final", "secret": "s2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	// 値が変わらない更新は記録しない
+	if err := scoped.Model(&auditedNote{Id: "n2"}).Update("title", "draft").Error; err != nil {
+		t.Fatal(err)
+	}
+	updated := auditLogsOf(t, db, AuditActionUpdate)
+	if len(updated) != 1 || updated[0].TargetId != "n1" {
+		t.Fatalf("updated logs=%+v", updated)
+	}
+	changes := updated[0].Changes
+	if len(changes) != 2 || string(changes["title"].Old) != `"draft"` || string(changes["title"].New) != `"final"` ||
+		string(changes["secret"].Old) != `"[REDACTED]"` {
+		t.Fatalf("update changes=%v", changes)
+	}
+
+	// 条件による一括更新は行ごとに記録する（他テナントの行はガードで対象外）
+	if err := BypassTenantGuard(db).Create(&auditedNote{Id: "x1", TenantId: "t2", Title: "draft"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := scoped.Model(&auditedNote{}).Where("title = ?", "draft").Update("title", "bulk").Error; err != nil {
+		t.Fatal(err)
+	}
+	if updated := auditLogsOf(t, db, AuditActionUpdate); len(updated) != 2 || updated[1].TargetId != "n2" {
+		t.Fatalf("bulk updated logs=%+v", updated)
+	}
+}
+
+func TestAuditLogSoftAndHardDelete(t *testing.T) {
+	db, ctx := openAuditTestDB(t)
+	scoped := db.WithContext(ctx)
+	if err := scoped.Create(&auditedNote{Id: "n1", Title: "draft"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := scoped.Delete(&auditedNote{Id: "n1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	soft := auditLogsOf(t, db, AuditActionSoftDelete)
+	if len(soft) != 1 || len(soft[0].Changes) != 1 || string(soft[0].Changes["deleted_at"].Old) != "null" || soft[0].Changes["deleted_at"].New == nil {
+		t.Fatalf("soft delete logs=%+v", soft)
+	}
+
+	if err := scoped.Unscoped().Delete(&auditedNote{Id: "n1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	hard := auditLogsOf(t, db, AuditActionDelete)
+	if len(hard) != 1 || string(hard[0].Changes["title"].Old) != `"draft"` || hard[0].Changes["title"].New != nil {
+		t.Fatalf("hard delete logs=%+v", hard)
+	}
+}
+
+func TestAuditLogFollowsTransaction(t *testing.T) {
+	db, ctx := openAuditTestDB(t)
+	rollback := errors.New("rollback")
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&auditedNote{Id: "n1", Title: "draft"}).Error; err != nil {
+			return err
+		}
+		return rollback
+	})
+	if !errors.Is(err, rollback) {
+		t.Fatal(err)
+	}
+	// 監査対象でないモデルは記録しない
+	if err := db.WithContext(ctx).Create(&guardedTodo{Id: "todo", OrganizationId: "o1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	BypassTenantGuard(db).Model(&AuditLog{}).Count(&count)
+	if count != 0 {
+		t.Fatalf("audit logs=%d", count)
+	}
+}
@@ -0,0 +1,131 @@
+package gw_gorm
+
+// このファイルは暗号化カラム（gw_crypto.EncryptedString）の等価検索用ハッシュを保存時に埋めるコールバック（UseBlindIndex）を置く。
+
+import (
+	"fmt"
+	"reflect"
+
+	gw_crypto "github.com/generalworksinc/goutil/crypto"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// UseBlindIndex は `blindindex:"<元のカラム>"` タグのフィールドに、元のカラムの値の gw_crypto.BlindIndex を保存時に埋める。
+//
+//	type Customer struct {
+//	    Phone      gw_crypto.EncryptedString
+//	    PhoneIndex string `gorm:"type:char(64);index" blindindex:"phone"`
+//	}
+//
+//	idx, _ := gw_crypto.BlindIndex("09012345678")
+//	db.Where("phone_index = ?", idx).First(&customer)
+//
+// 埋めるタイミングは次のとおり。
+//   - Create: 元のカラムの値から常に計算する
+//   - Update: struct なら元のフィールドから、map（Update / Updates(map)）なら元のカラムが含まれるときだけ計算する
+//
+// UpdateColumn(s) はコールバックを通るが、Raw()/Exec() の生 SQL では更新されない。
+func UseBlindIndex(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if callbacks.Create().Get("gw_gorm:blind_index_create") == nil {
+		if err := callbacks.Create().Before("gorm:create").Register("gw_gorm:blind_index_create", blindIndexCreate); err != nil {
+			return err
+		}
+	}
+	if callbacks.Update().Get("gw_gorm:blind_index_update") == nil {
+		if err := callbacks.Update().Before("gorm:update").Register("gw_gorm:blind_index_update", blindIndexUpdate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blindIndexFields は blindindex タグのフィールドと元のフィールドの組を返す。
+func blindIndexFields(db *gorm.DB) map[*schema.Field]*schema.Field {
+	if db.Error != nil || db.Statement == nil || db.Statement.Schema == nil {
+		return nil
+	}
+	fields := map[*schema.Field]*schema.Field{}
+	for _, field := range db.Statement.Schema.Fields {
+		name := field.Tag.Get("blindindex")
+		if name == "" || field.DBName == "" {
+			continue
+		}
+		source := db.Statement.Schema.LookUpField(name)
+		if source == nil {
+			db.AddError(fmt.Errorf("blind index: unknown source field %q on %s", name, field.Name))
+			return nil
+		}
+		fields[field] = source
+	}
+	return fields
+}
+
+func blindIndexCreate(db *gorm.DB) {
+	fields := blindIndexFields(db)
+	if len(fields) == 0 {
+		return
+	}
+	applyToReflectValues(db.Statement, func(v reflect.Value) {
+		for field, source := range fields {
+			value, _ := source.ValueOf(db.Statement.Context, v)
+			index, err := blindIndexOf(value)
+			if err != nil {
+				db.AddError(err)
+				return
+			}
+			db.AddError(field.Set(db.Statement.Context, v, index))
+		}
+	})
+}
+
+func blindIndexUpdate(db *gorm.DB) {
+	fields := blindIndexFields(db)
+	if len(fields) == 0 {
+		return
+	}
+	stmt := db.Statement
+	for field, source := range fields {
+		var value any
+		if updates, ok := stmt.Dest.(map[string]any); ok {
+			v, found := updates[source.DBName]
+			if !found {
+				if v, found = updates[source.Name]; !found {
+					continue
+				}
+			}
+			value = v
+		} else {
+			dest := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+			if dest.Kind() != reflect.Struct || dest.Type() != stmt.Schema.ModelType {
+				continue
+			}
+			value, _ = source.ValueOf(stmt.Context, dest)
+		}
+		index, err := blindIndexOf(value)
+		if err != nil {
+			db.AddError(err)
+			return
+		}
+		stmt.SetColumn(field.DBName, index, true)
+	}
+}
+
+// blindIndexOf は文字列（EncryptedString を含む）・そのポインタの値のハッシュを返す。
+func blindIndexOf(value any) (string, error) {
+	v := reflect.ValueOf(value)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", nil
+	}
+	if v.Kind() != reflect.String {
+		return "", fmt.Errorf("blind index: source must be a string, got %s", v.Type())
+	}
+	return gw_crypto.BlindIndex(v.String())
+}
@@ -0,0 +1,99 @@
+package gw_gorm
+
+import (
+	"testing"
+
+	gw_crypto "github.com/generalworksinc/goutil/crypto"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type piiCustomer struct {
+	Id         string
+	Name       string
+	Phone      gw_crypto.EncryptedString
+	PhoneIndex string `gorm:"type:char(64);index" blindindex:"phone"`
+	Address    gw_crypto.EncryptedJSON[map[string]string]
+}
+
+func openBlindIndexTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	ring, err := gw_crypto.NewKeyRing("k1", map[string][]byte{"k1": []byte("0123456789abcdef0123456789abcdef")}, []byte("index-key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw_crypto.SetKeyProvider(ring)
+	t.Cleanup(func() { gw_crypto.SetKeyProvider(nil) })
+
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UseBlindIndex(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&piiCustomer{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func findByPhone(t *testing.T, db *gorm.DB, phone string) []piiCustomer {
+	t.Helper()
+	index, err := gw_crypto.BlindIndex(phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var customers []piiCustomer
+	if err := db.Where("phone_index = ?", index).Find(&customers).Error; err != nil {
+		t.Fatal(err)
+	}
+	return customers
+}
+
+func TestEncryptedColumnsWithBlindIndex(t *testing.T) {
+	db := openBlindIndexTestDB(t)
+	customers := []piiCustomer{
+		{Id: "c1", Phone: "09011112222", Address: gw_crypto.EncryptedJSON[map[string]string]{Data: map[string]string{"city": "札幌市"}}},
+		{Id: "c2", Phone: "09033334444"},
+	}
+	if err := db.Create(&customers).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var stored string
+	db.Raw("SELECT phone FROM pii_customers WHERE id = ?", "c1").Scan(&stored)
+	if stored == "09011112222" || gw_crypto.FieldKeyId(stored) != "k1" {
+		t.Fatalf("phone must be stored encrypted: %s", stored)
+	}
+	found := findByPhone(t, db, "09011112222")
+	if len(found) != 1 || found[0].Id != "c1" || found[0].Phone != "09011112222" || found[0].Address.Data["city"] != "札幌市" {
+		t.Fatalf("found=%+v", found)
+	}
+
+	// map の Update は元のカラムが含まれるときだけインデックスを更新する
+	if err := db.Model(&piiCustomer{}).Where("id = ?", "c2").Update("phone", gw_crypto.EncryptedString("09055556666")).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&piiCustomer{}).Where("id = ?", "c2").Update("name", "renamed").Error; err != nil {
+		t.Fatal(err)
+	}
+	updated := findByPhone(t, db, "09055556666")
+	if len(updated) != 1 || updated[0].Name != "renamed" {
+		t.Fatalf("map update: %+v", updated)
+	}
+	if found := findByPhone(t, db, "09033334444"); len(found) != 0 {
+		t.Fatalf("old index must not match: %+v", found)
+	}
+
+	// struct の Save も追従する
+	customer := updated[0]
+	customer.Phone = "09077778888"
+	if err := db.Save(&customer).Error; err != nil {
+		t.Fatal(err)
+	}
+	if found := findByPhone(t, db, "09077778888"); len(found) != 1 || found[0].Id != "c2" {
+		t.Fatalf("save: %+v", found)
+	}
+}
@@ -0,0 +1,190 @@
+package gw_gorm
+
+// このファイルは大量の行をチャンクに分けて INSERT / UPSERT する BulkInsert / BulkUpsert を置く。
+
+import (
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultBulkBatchSize は BulkInsert / BulkUpsert の1回の INSERT の行数の上限の既定値。
+// カラムが多いモデルでは、ドライバのパラメータ数の上限に収まるようにさらに小さくする。
+const DefaultBulkBatchSize = 1000
+
+// bulkParameterLimits は1つの SQL に渡せるプレースホルダ数の上限（ドライバ・DB の制約）。
+// 知らない Dialector は SQLite の古い既定値（999）に合わせる。
+var bulkParameterLimits = map[string]int{
+	"postgres":  65535,
+	"mysql":     65535,
+	"sqlite":    32766,
+	"sqlserver": 2100,
+}
+
+const defaultBulkParameterLimit = 999
+
+// BulkOptions は BulkInsert / BulkUpsert の設定。nil なら既定値。
+type BulkOptions struct {
+	// BatchSize は1回の INSERT の行数（0 以下なら DefaultBulkBatchSize）。パラメータ数の上限を超える値は切り詰める
+	BatchSize int
+	// ConflictColumns は BulkUpsert の衝突先（カラム名またはフィールド名。空なら主キー）
+	ConflictColumns []string
+	// UpdateColumns は BulkUpsert で衝突したときに更新するカラム
+	// （空なら主キー・ConflictColumns・created_at・tenant_id / organization_id / created_by / version 以外の全カラム）
+	UpdateColumns []string
+	// ContinueOnError が true なら失敗したチャンクを飛ばして残りを続ける。
+	// PostgreSQL のトランザクション内では失敗した時点でトランザクションが中断されるため使えない
+	ContinueOnError bool
+	// OnProgress はチャンクを1つ処理するたびに（失敗したときも）呼ばれる
+	OnProgress func(BulkProgress)
+}
+
+// BulkProgress は1チャンクの処理結果。
+type BulkProgress struct {
+	// Chunk は0始まりのチャンクの番号、Chunks はチャンクの数
+	Chunk  int
+	Chunks int
+	// Offset はチャンクの先頭の rows での位置、Rows はチャンクの行数
+	Offset int
+	Rows   int
+	// Done はここまでに処理した（失敗したチャンクを含む）行数、Total は全体の行数
+	Done  int
+	Total int
+	// RowsAffected はチャンクの INSERT の件数（MySQL の UPSERT は更新した行を2と数える）
+	RowsAffected int64
+	Err          error
+}
+
+// BulkResult は BulkInsert / BulkUpsert の結果。
+type BulkResult struct {
+	RowsAffected int64
+	Chunks       int
+	// Failed は ContinueOnError で飛ばしたチャンク
+	Failed []*BulkChunkError
+}
+
+// BulkChunkError は失敗したチャンクの位置と原因。errors.As で取り出せる。
+type BulkChunkError struct {
+	Chunk  int
+	Offset int
+	Rows   int
+	Err    error
+}
+
+func (e *BulkChunkError) Error() string {
+	return fmt.Sprintf("bulk chunk %d (rows %d-%d): %v", e.Chunk, e.Offset, e.Offset+e.Rows-1, e.Err)
+}
+
+func (e *BulkChunkError) Unwrap() error { return e.Err }
+
+// BulkInsert は rows をチャンクごとの複数行 INSERT で挿入する。
+// 1チャンクは1つの Create なので、Tenant Guard・監査ログ・UseActorStamp などのコールバックはチャンクごとに1回通る。
+// チャンクは独立した INSERT で、途中で失敗してもそれまでのチャンクは取り消さない。全体を取り消したい場合は WithTx の中で呼ぶ。
+//
+//	result, err := gw_gorm.BulkInsert(db.WithContext(ctx), rows, &gw_gorm.BulkOptions{
+//	    OnProgress: func(p gw_gorm.BulkProgress) { slog.Info("import", "done", p.Done, "total", p.Total) },
+//	})
+func BulkInsert[T any](db *gorm.DB, rows []T, opts *BulkOptions) (*BulkResult, error) {
+	s, err := bulkSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	return bulkCreate(db, s, rows, opts)
+}
+
+// BulkUpsert は BulkInsert と同じくチャンクに分けて挿入し、ConflictColumns が重複する行は UpdateColumns を更新する
+// （PostgreSQL / SQLite は ON CONFLICT、MySQL は ON DUPLICATE KEY UPDATE）。
+// ConflictColumns にはそれらのカラムの一意インデックスが必要（PostgreSQL / SQLite）。
+// TenantScopedModel は tenant_id、OrgScopedModel は organization_id を ConflictColumns に含める必要がある。
+//
+// tenant_id / organization_id / created_by / version は衝突した行では更新しない（UpdateColumns に指定するとエラー。version は +1 する）。
+// MySQL の ON DUPLICATE KEY UPDATE は ConflictColumns に関係なくどの一意キーの重複でも更新するため、
+// Scope のあるモデルでは既存の行の tenant_id / organization_id が一致するときだけ値を書き換え、一致しない行はそのまま残す。
+func BulkUpsert[T any](db *gorm.DB, rows []T, opts *BulkOptions) (*BulkResult, error) {
+	if opts == nil {
+		opts = &BulkOptions{}
+	}
+	s, err := bulkSchema[T](db)
+	if err != nil {
+		return nil, err
+	}
+	onConflict, err := upsertClause(s, db.Dialector.Name(), opts.ConflictColumns, opts.UpdateColumns)
+	if err != nil {
+		return nil, err
+	}
+	return bulkCreate(db.Clauses(onConflict), s, rows, opts)
+}
+
+func bulkSchema[T any](db *gorm.DB) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+func bulkCreate[T any](db *gorm.DB, s *schema.Schema, rows []T, opts *BulkOptions) (*BulkResult, error) {
+	if opts == nil {
+		opts = &BulkOptions{}
+	}
+	size := bulkChunkSize(db, s, opts.BatchSize)
+	chunks := (len(rows) + size - 1) / size
+	result := &BulkResult{Chunks: chunks}
+	ctx := contextFromDB(db)
+	for chunk := 0; chunk < chunks; chunk++ {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		offset := chunk * size
+		end := min(offset+size, len(rows))
+		batch := rows[offset:end]
+		created := db.Session(&gorm.Session{}).Create(&batch)
+		result.RowsAffected += created.RowsAffected
+		progress := BulkProgress{
+			Chunk: chunk, Chunks: chunks, Offset: offset, Rows: len(batch),
+			Done: end, Total: len(rows), RowsAffected: created.RowsAffected, Err: created.Error,
+		}
+		if opts.OnProgress != nil {
+			opts.OnProgress(progress)
+		}
+		if created.Error != nil {
+			chunkErr := &BulkChunkError{Chunk: chunk, Offset: offset, Rows: len(batch), Err: created.Error}
+			if !opts.ContinueOnError {
+				return result, chunkErr
+			}
+			result.Failed = append(result.Failed, chunkErr)
+		}
+	}
+	if len(result.Failed) > 0 {
+		errs := make([]error, len(result.Failed))
+		for i, failed := range result.Failed {
+			errs[i] = failed
+		}
+		return result, errors.Join(errs...)
+	}
+	return result, nil
+}
+
+// bulkChunkSize は batchSize（0 以下なら DefaultBulkBatchSize）を、1つの INSERT のパラメータ数が
+// Dialector の上限に収まる行数に切り詰めて返す。
+func bulkChunkSize(db *gorm.DB, s *schema.Schema, batchSize int) int {
+	if batchSize <= 0 {
+		batchSize = DefaultBulkBatchSize
+	}
+	limit, ok := bulkParameterLimits[db.Dialector.Name()]
+	if !ok {
+		limit = defaultBulkParameterLimit
+	}
+	columns := 0
+	for _, field := range s.Fields {
+		if field.DBName != "" && field.Creatable {
+			columns++
+		}
+	}
+	if columns > 0 && limit/columns < batchSize {
+		batchSize = limit / columns
+	}
+	return max(batchSize, 1)
+}
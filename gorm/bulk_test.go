@@ -0,0 +1,211 @@
+package gw_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type bulkItem struct {
+	Id       string
+	TenantId string `gorm:"uniqueIndex:ux_bulk_item_code"`
+	Code     string `gorm:"uniqueIndex:ux_bulk_item_code"`
+	Price    int
+}
+
+func (bulkItem) TenantScoped() {}
+
+func openBulkTestDB(t *testing.T) (*gorm.DB, context.Context) {
+	t.Helper()
+	return migrateAndSeed(t, &bulkItem{}, nil)
+}
+
+func bulkItems(from, to int, price int) []bulkItem {
+	items := make([]bulkItem, 0, to-from)
+	for i := from; i < to; i++ {
+		items = append(items, bulkItem{Id: fmt.Sprintf("i%03d", i), Code: fmt.Sprintf("C%03d", i), Price: price})
+	}
+	return items
+}
+
+func TestBulkInsertChunksAndReportsProgress(t *testing.T) {
+	db, ctx := openBulkTestDB(t)
+	scoped := db.WithContext(ctx)
+
+	var progress []BulkProgress
+	result, err := BulkInsert(scoped, bulkItems(0, 25, 1), &BulkOptions{
+		BatchSize:  10,
+		OnProgress: func(p BulkProgress) { progress = append(progress, p) },
+	})
+	if err != nil || result.RowsAffected != 25 || result.Chunks != 3 {
+		t.Fatalf("result=%+v err=%v", result, err)
+	}
+	if len(progress) != 3 || progress[2].Offset != 20 || progress[2].Rows != 5 || progress[2].Done != 25 || progress[2].Total != 25 {
+		t.Fatalf("progress=%+v", progress)
+	}
+	var owned int64
+	BypassTenantGuard(db).Model(&bulkItem{}).Where("tenant_id = ?", "t1").Count(&owned)
+	if owned != 25 {
+		t.Fatalf("tenant guard must fill tenant_id for every row: %d", owned)
+	}
+
+	// 2つ目のチャンクだけ重複で失敗させる
+	rows := append(bulkItems(100, 110, 1), bulkItems(5, 6, 1)...)
+	rows = append(rows, bulkItems(110, 120, 1)...)
+	var failed []int
+	result, err = BulkInsert(scoped, rows, &BulkOptions{
+		BatchSize:       10,
+		ContinueOnError: true,
+		OnProgress: func(p BulkProgress) {
+			if p.Err != nil {
+				failed = append(failed, p.Chunk)
+			}
+		},
+	})
+	var chunkErr *BulkChunkError
+	if !errors.As(err, &chunkErr) || chunkErr.Chunk != 1 || chunkErr.Offset != 10 || len(result.Failed) != 1 || len(failed) != 1 {
+		t.Fatalf("result=%+v err=%v", result, err)
+	}
+	if result.RowsAffected != 11 {
+		t.Fatalf("chunks 0 (10 rows) and 2 (1 row) must be inserted: %d", result.RowsAffected)
+	}
+
+	// 既定では最初の失敗で止まる
+	result, err = BulkInsert(scoped, bulkItems(0, 30, 1), &BulkOptions{BatchSize: 10})
+	if !errors.As(err, &chunkErr) || chunkErr.Chunk != 0 || result.RowsAffected != 0 {
+		t.Fatalf("result=%+v err=%v", result, err)
+	}
+
+	// Tenant Guard はチャンクごとに効く
+	other := bulkItems(200, 201, 1)
+	other[0].TenantId = "t2"
+	if _, err := BulkInsert(scoped, other, nil); err == nil {
+		t.Fatal("rows of other tenants must be rejected")
+	}
+}
+
+func TestBulkUpsertUpdatesSelectedColumns(t *testing.T) {
+	db, ctx := openBulkTestDB(t)
+	scoped := db.WithContext(ctx)
+	if _, err := BulkInsert(scoped, bulkItems(0, 5, 100), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := bulkItems(3, 8, 200)
+	for i := range changed {
+		changed[i].Id = "new-" + changed[i].Id
+	}
+	result, err := BulkUpsert(scoped, changed, &BulkOptions{BatchSize: 2, ConflictColumns: []string{"tenant_id", "Code"}, UpdateColumns: []string{"price"}})
+	if err != nil || result.Chunks != 3 {
+		t.Fatalf("result=%+v err=%v", result, err)
+	}
+	var items []bulkItem
+	scoped.Order("code").Find(&items)
+	if len(items) != 8 || items[2].Price != 100 || items[3].Price != 200 || items[3].Id != "i003" || items[7].Id != "new-i007" {
+		t.Fatalf("items=%+v", items)
+	}
+
+	for _, opts := range []*BulkOptions{
+		{},
+		{ConflictColumns: []string{"tenant_id", "code"}, UpdateColumns: []string{"code"}},
+		{ConflictColumns: []string{"tenant_id", "code"}, UpdateColumns: []string{"nope"}},
+	} {
+		if _, err := BulkUpsert(scoped, changed, opts); err == nil {
+			t.Fatalf("invalid options must be rejected: %+v", opts)
+		}
+	}
+}
+
+func TestBulkChunkSizeFollowsParameterLimit(t *testing.T) {
+	db, _ := openBulkTestDB(t)
+	s, err := bulkSchema[bulkItem](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := bulkChunkSize(db, s, 0); size != DefaultBulkBatchSize {
+		t.Fatalf("size=%d", size)
+	}
+	if size := bulkChunkSize(db, s, 100000); size != 32766/4 {
+		t.Fatalf("4 columns on sqlite: size=%d", size)
+	}
+	mssql := &gorm.DB{Config: &gorm.Config{Dialector: namedDialector{Dialector: db.Dialector, name: "sqlserver"}}}
+	if size := bulkChunkSize(mssql, s, 0); size != 2100/4 {
+		t.Fatalf("4 columns on sql server: size=%d", size)
+	}
+}
+
+type namedDialector struct {
+	gorm.Dialector
+	name string
+}
+
+func (d namedDialector) Name() string { return d.name }
+
+type stampedBulkItem struct {
+	Id        string
+	TenantId  string `gorm:"uniqueIndex:ux_stamped_bulk_item_code"`
+	Code      string `gorm:"uniqueIndex:ux_stamped_bulk_item_code"`
+	Price     int
+	CreatedBy string
+	Versioned
+}
+
+func (stampedBulkItem) TenantScoped() {}
+
+func TestBulkUpsertKeepsProtectedColumns(t *testing.T) {
+	db, ctx := openBulkTestDB(t)
+	if err := db.AutoMigrate(&stampedBulkItem{}); err != nil {
+		t.Fatal(err)
+	}
+	scoped := db.WithContext(ctx)
+	if _, err := BulkInsert(scoped, []stampedBulkItem{{Id: "a", Code: "A", Price: 1, CreatedBy: "u1"}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BulkUpsert(scoped, []stampedBulkItem{{Id: "b", Code: "A", Price: 2, CreatedBy: "u2"}}, &BulkOptions{ConflictColumns: []string{"tenant_id", "code"}}); err != nil {
+		t.Fatal(err)
+	}
+	var item stampedBulkItem
+	scoped.First(&item)
+	if item.Id != "a" || item.Price != 2 || item.CreatedBy != "u1" || item.Version != 2 {
+		t.Fatalf("item=%+v", item)
+	}
+	for _, column := range []string{"tenant_id", "created_by", "version"} {
+		if _, err := BulkUpsert(scoped, []stampedBulkItem{{Id: "c", Code: "A"}}, &BulkOptions{ConflictColumns: []string{"code", "tenant_id"}, UpdateColumns: []string{"price", column}}); err == nil {
+			t.Fatalf("%s must not be updated by upsert", column)
+		}
+	}
+}
+
+func TestUpsertClauseGuardsScopeOnMySQL(t *testing.T) {
+	db, ctx := openBulkTestDB(t)
+	s, err := bulkSchema[stampedBulkItem](db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	onConflict, err := upsertClause(s, "mysql", []string{"tenant_id", "code"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	created := db.WithContext(ctx).Session(&gorm.Session{DryRun: true}).Clauses(onConflict).Create(&stampedBulkItem{Id: "a", Code: "A"})
+	if created.Error != nil {
+		t.Fatal(created.Error)
+	}
+	sql := created.Statement.SQL.String()
+	for _, want := range []string{
+		"`price`=IF(`tenant_id` = VALUES(`tenant_id`), VALUES(`price`), `price`)",
+		"`version`=IF(`tenant_id` = VALUES(`tenant_id`), `version` + 1, `version`)",
+	} {
+		if !strings.Contains(sql, want) {
+			t.Fatalf("sql=%s\nmust contain %s", sql, want)
+		}
+	}
+	for _, column := range []string{"`tenant_id`=", "`created_by`=", "`id`="} {
+		if strings.Contains(sql, column) {
+			t.Fatalf("sql=%s\nmust not update %s", sql, column)
+		}
+	}
+}
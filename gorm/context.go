@@ -2,12 +2,15 @@ package gw_gorm
 
 import (
 	"context"
+	"errors"
 
 	"gorm.io/gorm"
 )
 
 type scopeContextKey struct{}
 
+type dbContextKey struct{}
+
 // WithScopeContextは、認証・認可で確定したScopeをcontextへ保存します。
 // 呼び出し後に元のScopeが変更されても影響を受けないよう、値を複製して保存します。
 func WithScopeContext(ctx context.Context, scope *Scope) context.Context {
@@ -33,6 +36,41 @@ func scopeFromContext(ctx context.Context) (*Scope, bool) {
 	return cloneScope(scope), true
 }
 
+// tenantIdFromContextは、WithScopeContextで保存したScopeが単一テナントの場合にそのtenant idを返します。
+// 監査ログの tenant_id の補完に使います。複数テナント・AllTenantsのScopeではfalseを返します。
+func tenantIdFromContext(ctx context.Context) (string, bool) {
+	scope, ok := scopeFromContext(ctx)
+	if !ok || scope.AllTenants || len(scope.TenantIds) != 1 {
+		return "", false
+	}
+	return scope.TenantIds[0], true
+}
+
+// WithDBは、dbをcontextへ保存します。リクエスト開始時のミドルウェア（gw_web.Databases）で呼び出し、
+// ハンドラではDBFromContext（gw_web.WebCtx.DB、Repository）で取り出すことで、リクエストのdeadline・キャンセル・Scopeが自動的にSQLへ伝搬します。
+func WithDB(ctx context.Context, db *gorm.DB) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if db == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, dbContextKey{}, db)
+}
+
+// DBFromContextは、WithDBで保存したdbをctx付き（db.WithContext(ctx)）で返します。
+// ctxのdeadlineを過ぎたSQLはドライバ側で中断され、context.DeadlineExceededを返します。
+func DBFromContext(ctx context.Context) (*gorm.DB, error) {
+	if ctx == nil {
+		return nil, errors.New("gorm db is not set in context")
+	}
+	db, ok := ctx.Value(dbContextKey{}).(*gorm.DB)
+	if !ok || db == nil {
+		return nil, errors.New("gorm db is not set in context")
+	}
+	return db.WithContext(ctx), nil
+}
+
 func contextFromDB(db *gorm.DB) context.Context {
 	if db != nil && db.Statement != nil && db.Statement.Context != nil {
 		return db.Statement.Context
@@ -111,3 +111,69 @@ func openTransactionTestDB(t *testing.T) *gorm.DB {
 	}
 	return db
 }
+
+// migrateAndSeed は openTransactionTestDB の DB に model のテーブルを作り、rows（nil なら投入しない）を Tenant Guard を外して入れる。
+// DB と singleScope() の context を返す。
+func migrateAndSeed(t *testing.T, model any, rows any) (*gorm.DB, context.Context) {
+	t.Helper()
+	db := openTransactionTestDB(t)
+	if err := db.AutoMigrate(model); err != nil {
+		t.Fatal(err)
+	}
+	if rows != nil {
+		if err := BypassTenantGuard(db).Model(model).Create(rows).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, WithScopeContext(context.Background(), singleScope())
+}
+
+func TestDBFromContextCarriesScopeAndDeadline(t *testing.T) {
+	db := openTransactionTestDB(t)
+	if err := db.Session(&gorm.Session{SkipHooks: true}).Exec(
+		"INSERT INTO guarded_todos (id, tenant_id, organization_id, title) VALUES ('a', 't1', 'o1', 'mine'), ('b', 't2', 'o2', 'other')").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := DBFromContext(context.Background()); err == nil {
+		t.Fatal("missing db must be an error")
+	}
+
+	ctx := WithScopeContext(WithDB(context.Background(), db), singleScope())
+	scoped, err := DBFromContext(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var todos []guardedTodo
+	if err := scoped.Find(&todos).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 1 || todos[0].Id != "a" {
+		t.Fatalf("scope from context must be applied: %+v", todos)
+	}
+
+	expired, cancel := context.WithTimeout(ctx, -1)
+	defer cancel()
+	scoped, err = DBFromContext(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := scoped.Find(&todos).Error; !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expired deadline must abort the query, err=%v", err)
+	}
+}
+
+func TestTenantIdFromContextOnlyForSingleTenant(t *testing.T) {
+	if id, ok := tenantIdFromContext(WithScopeContext(context.Background(), singleScope())); !ok || id != "t1" {
+		t.Fatalf("single tenant id=%q ok=%v", id, ok)
+	}
+	for _, scope := range []*Scope{
+		nil,
+		{TenantIds: []string{"t1", "t2"}},
+		{AllTenants: true, TenantIds: []string{"t1"}},
+	} {
+		if id, ok := tenantIdFromContext(WithScopeContext(context.Background(), scope)); ok {
+			t.Fatalf("scope=%+v must not expose tenant id, got %q", scope, id)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 // - SQL ログは slog（SlogLogger）で構造化出力。debug 時は全クエリ、非 debug 時はスロークエリ+エラーのみ
 // DB ドライバ（Dialector）と DSN の組み立てはアプリ側の責務。goutil は特定の DB に依存しない。
 // テナントガード（UseTenantGuard）も用途ごとのライフサイクルに合わせて呼び出し側で登録する。
+// 接続プールは ConfigurePool、リードレプリカへの振り分けは UseReadReplicas、EXPLAIN・N+1 の検知は UseQueryAnalysis で設定する。
 func DefaultConfig(debug bool) *gorm.Config {
 	return &gorm.Config{
 		NamingStrategy:                           schema.NamingStrategy{SingularTable: true},
@@ -26,6 +27,7 @@ func DefaultConfig(debug bool) *gorm.Config {
 }
 
 // ReCreateTable は開発・デモ用の破壊的なテーブル再作成ユーティリティ。
+// 本番のスキーマ変更は Migrator（バージョン管理されたマイグレーション）で行うこと。
 func ReCreateTable(db *gorm.DB, models ...any) error {
 	if err := db.Migrator().DropTable(models...); err != nil {
 		return err
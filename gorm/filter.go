@@ -0,0 +1,307 @@
+package gw_gorm
+
+// このファイルは一覧APIのクエリ文字列（?status=open&created_at[gte]=...&sort=-createdAt）を
+// 許可したカラムだけの gorm 条件に変換する QueryFilter を置く。
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrInvalidFilter はクエリ文字列のフィールド・演算子・値が不正なことを表す（400 として返す想定）。
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// FilterOp はクエリ文字列の演算子（created_at[gte]=... の gte）。
+type FilterOp string
+
+const (
+	FilterEq    FilterOp = "eq"
+	FilterNe    FilterOp = "ne"
+	FilterIn    FilterOp = "in"
+	FilterNotIn FilterOp = "nin"
+	FilterGt    FilterOp = "gt"
+	FilterGte   FilterOp = "gte"
+	FilterLt    FilterOp = "lt"
+	FilterLte   FilterOp = "lte"
+	FilterLike  FilterOp = "like"
+	FilterNull  FilterOp = "null"
+)
+
+// filterTagGroups はモデルの filter タグに書く許可の単位と、それで使える演算子。
+var filterTagGroups = map[string][]FilterOp{
+	"eq":    {FilterEq, FilterNe},
+	"in":    {FilterIn, FilterNotIn},
+	"range": {FilterGt, FilterGte, FilterLt, FilterLte},
+	"like":  {FilterLike},
+	"null":  {FilterNull},
+}
+
+// filterReservedKeys はフィルタとして扱わないクエリのキー。
+var filterReservedKeys = map[string]bool{"sort": true, "cursor": true, "limit": true, "offset": true, "page": true}
+
+// maxFilterInValues は in / nin に渡せる値の上限。
+const maxFilterInValues = 100
+
+// FilterCondition は検証・型変換済みの1条件。
+type FilterCondition struct {
+	Column string
+	Op     FilterOp
+	Values []any
+}
+
+// QueryFilter はクエリ文字列から作った条件とソート順。Sort はそのまま gw_pagination.PageRequest に渡せる。
+type QueryFilter struct {
+	Conditions []FilterCondition
+	Sort       []gw_pagination.SortField
+}
+
+// ParseQueryFilter は query を T の filter タグで許可したカラムだけの条件にする。
+// 許可はフィールドごとに filter タグで宣言し、タグの無いフィールドは検索・ソートできない。
+//
+//	type Task struct {
+//	    Status    string    `filter:"eq,in,sort"`
+//	    Title     string    `filter:"like"`
+//	    CreatedAt time.Time `json:"createdAt" filter:"range,sort"`
+//	}
+//
+// 書式は field=value（eq）、field[op]=value、sort=-createdAt,id（- は降順）。
+// field はカラム名・Go のフィールド名・json 名のいずれでもよい。in / nin はカンマ区切り、null は true / false。
+// sort / cursor / limit / offset / page のキーは無視する。
+// 未知・未許可のフィールド、許可していない演算子、カラムの型に変換できない値は ErrInvalidFilter。
+func ParseQueryFilter[T any](db *gorm.DB, query url.Values) (*QueryFilter, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	fields := filterableFields(stmt.Schema)
+
+	filter := &QueryFilter{}
+	// SQL が毎回同じになるようにキー順で処理する
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		values := query[key]
+		if filterReservedKeys[key] {
+			continue
+		}
+		name, op, err := splitFilterKey(key)
+		if err != nil {
+			return nil, err
+		}
+		field, ok := fields[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, name)
+		}
+		if !filterAllows(field, op) {
+			return nil, fmt.Errorf("%w: %s is not allowed on %q", ErrInvalidFilter, op, name)
+		}
+		for _, value := range values {
+			condition, err := newFilterCondition(field, op, value)
+			if err != nil {
+				return nil, err
+			}
+			filter.Conditions = append(filter.Conditions, condition)
+		}
+	}
+	for _, sort := range query["sort"] {
+		for _, name := range strings.Split(sort, ",") {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			desc := strings.HasPrefix(name, "-")
+			name = strings.TrimPrefix(name, "-")
+			field, ok := fields[name]
+			if !ok || !filterTagHas(field, "sort") {
+				return nil, fmt.Errorf("%w: cannot sort by %q", ErrInvalidFilter, name)
+			}
+			filter.Sort = append(filter.Sort, gw_pagination.SortField{Column: field.DBName, Desc: desc})
+		}
+	}
+	return filter, nil
+}
+
+// Where は条件だけを db に付ける（ソートは Paginate 側で行う場合）。
+func (f *QueryFilter) Where(db *gorm.DB) *gorm.DB {
+	if f == nil || len(f.Conditions) == 0 {
+		return db
+	}
+	exprs := make([]clause.Expression, 0, len(f.Conditions))
+	for _, condition := range f.Conditions {
+		exprs = append(exprs, condition.expression())
+	}
+	return db.Clauses(clause.Where{Exprs: exprs})
+}
+
+// Apply は条件とソート順を db に付ける。
+func (f *QueryFilter) Apply(db *gorm.DB) *gorm.DB {
+	db = f.Where(db)
+	if f == nil {
+		return db
+	}
+	for _, sort := range f.Sort {
+		db = db.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: sort.Column}, Desc: sort.Desc})
+	}
+	return db
+}
+
+func (c FilterCondition) expression() clause.Expression {
+	column := clause.Column{Table: clause.CurrentTable, Name: c.Column}
+	switch c.Op {
+	case FilterNe:
+		return clause.Neq{Column: column, Value: c.Values[0]}
+	case FilterIn:
+		return clause.IN{Column: column, Values: c.Values}
+	case FilterNotIn:
+		return clause.Not(clause.IN{Column: column, Values: c.Values})
+	case FilterGt:
+		return clause.Gt{Column: column, Value: c.Values[0]}
+	case FilterGte:
+		return clause.Gte{Column: column, Value: c.Values[0]}
+	case FilterLt:
+		return clause.Lt{Column: column, Value: c.Values[0]}
+	case FilterLte:
+		return clause.Lte{Column: column, Value: c.Values[0]}
+	case FilterLike:
+		// ESCAPE は MySQL でもバックスラッシュの二重解釈が起きない ! を使う
+		return clause.Expr{SQL: "? LIKE ? ESCAPE '!'", Vars: []any{column, c.Values[0]}}
+	case FilterNull:
+		if c.Values[0] == true {
+			return clause.Eq{Column: column, Value: nil}
+		}
+		return clause.Neq{Column: column, Value: nil}
+	default:
+		return clause.Eq{Column: column, Value: c.Values[0]}
+	}
+}
+
+func splitFilterKey(key string) (string, FilterOp, error) {
+	name, rest, ok := strings.Cut(key, "[")
+	if !ok {
+		return key, FilterEq, nil
+	}
+	op, ok := strings.CutSuffix(rest, "]")
+	if !ok || name == "" {
+		return "", "", fmt.Errorf("%w: malformed key %q", ErrInvalidFilter, key)
+	}
+	return name, FilterOp(op), nil
+}
+
+// filterableFields は filter タグのあるフィールドを、カラム名・フィールド名・json 名で引けるようにする。
+func filterableFields(s *schema.Schema) map[string]*schema.Field {
+	fields := map[string]*schema.Field{}
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.Tag.Get("filter") == "" || field.Tag.Get("filter") == "-" {
+			continue
+		}
+		fields[field.DBName] = field
+		fields[field.Name] = field
+		if jsonName, _, _ := strings.Cut(field.Tag.Get("json"), ","); jsonName != "" && jsonName != "-" {
+			fields[jsonName] = field
+		}
+	}
+	return fields
+}
+
+func filterTagHas(field *schema.Field, group string) bool {
+	for _, g := range strings.Split(field.Tag.Get("filter"), ",") {
+		if strings.TrimSpace(g) == group {
+			return true
+		}
+	}
+	return false
+}
+
+func filterAllows(field *schema.Field, op FilterOp) bool {
+	for group, ops := range filterTagGroups {
+		for _, allowed := range ops {
+			if allowed == op && filterTagHas(field, group) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newFilterCondition(field *schema.Field, op FilterOp, raw string) (FilterCondition, error) {
+	condition := FilterCondition{Column: field.DBName, Op: op}
+	switch op {
+	case FilterIn, FilterNotIn:
+		parts := strings.Split(raw, ",")
+		if len(parts) > maxFilterInValues {
+			return condition, fmt.Errorf("%w: too many values for %q", ErrInvalidFilter, field.DBName)
+		}
+		for _, part := range parts {
+			value, err := filterValue(field, strings.TrimSpace(part))
+			if err != nil {
+				return condition, err
+			}
+			condition.Values = append(condition.Values, value)
+		}
+	case FilterNull:
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return condition, fmt.Errorf("%w: %q[null] must be true or false", ErrInvalidFilter, field.DBName)
+		}
+		condition.Values = []any{isNull}
+	case FilterLike:
+		if field.DataType != schema.String {
+			return condition, fmt.Errorf("%w: like is only for string columns", ErrInvalidFilter)
+		}
+		condition.Values = []any{"%" + escapeLike(raw) + "%"}
+	default:
+		value, err := filterValue(field, raw)
+		if err != nil {
+			return condition, err
+		}
+		condition.Values = []any{value}
+	}
+	return condition, nil
+}
+
+// filterValue は文字列をカラムの型に変換する（変換できない値は DB まで渡さずに弾く）。
+func filterValue(field *schema.Field, raw string) (any, error) {
+	var value any
+	var err error
+	switch field.DataType {
+	case schema.Int:
+		value, err = strconv.ParseInt(raw, 10, 64)
+	case schema.Uint:
+		value, err = strconv.ParseUint(raw, 10, 64)
+	case schema.Float:
+		value, err = strconv.ParseFloat(raw, 64)
+	case schema.Bool:
+		value, err = strconv.ParseBool(raw)
+	case schema.Time:
+		value, err = parseFilterTime(raw)
+	default:
+		value = raw
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid value %q for %q", ErrInvalidFilter, raw, field.DBName)
+	}
+	return value, nil
+}
+
+func parseFilterTime(raw string) (time.Time, error) {
+	// エンコードされていない + はクエリ文字列の解釈で空白になるため戻す（2026-01-01T00:00:00+09:00）
+	raw = strings.ReplaceAll(raw, " ", "+")
+	// 文字列で時刻を保存する DB（SQLite）でも比較がずれないよう UTC にそろえる
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t.UTC(), nil
+	}
+	return time.Parse(time.DateOnly, raw)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(s)
+}
@@ -0,0 +1,129 @@
+package gw_gorm
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"gorm.io/gorm"
+)
+
+type filterTask struct {
+	Id         string
+	TenantId   string
+	Status     string     `filter:"eq,in,sort"`
+	Title      string     `filter:"like"`
+	Priority   int        `filter:"eq,range,sort"`
+	DueAt      *time.Time `json:"dueAt" filter:"range,null"`
+	CreatedAt  time.Time  `json:"createdAt" filter:"range,sort"`
+	SecretNote string
+}
+
+func (filterTask) TenantScoped() {}
+
+func openFilterTestDB(t *testing.T) (*gorm.DB, context.Context) {
+	t.Helper()
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	due := base.Add(48 * time.Hour)
+	tasks := []filterTask{
+		{Id: "a", TenantId: "t1", Status: "open", Title: "fix 100% bug", Priority: 1, CreatedAt: base},
+		{Id: "b", TenantId: "t1", Status: "open", Title: "write docs", Priority: 3, DueAt: &due, CreatedAt: base.Add(24 * time.Hour)},
+		{Id: "c", TenantId: "t1", Status: "closed", Title: "fix_login", Priority: 2, CreatedAt: base.Add(48 * time.Hour)},
+		{Id: "d", TenantId: "t1", Status: "draft", Title: "fix login", Priority: 5, CreatedAt: base.Add(72 * time.Hour)},
+		{Id: "x", TenantId: "t2", Status: "open", Title: "other tenant", Priority: 1, CreatedAt: base},
+	}
+	return migrateAndSeed(t, &filterTask{}, tasks)
+}
+
+func filteredIds(t *testing.T, db *gorm.DB, rawQuery string) string {
+	t.Helper()
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := ParseQueryFilter[filterTask](db, query)
+	if err != nil {
+		t.Fatalf("%s: %v", rawQuery, err)
+	}
+	if len(filter.Sort) == 0 {
+		filter.Sort = []gw_pagination.SortField{{Column: "id"}}
+	}
+	var tasks []filterTask
+	if err := filter.Apply(db).Find(&tasks).Error; err != nil {
+		t.Fatalf("%s: %v", rawQuery, err)
+	}
+	ids := make([]string, len(tasks))
+	for i, task := range tasks {
+		ids[i] = task.Id
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestQueryFilterOperators(t *testing.T) {
+	db, ctx := openFilterTestDB(t)
+	scoped := db.WithContext(ctx)
+
+	cases := map[string]string{
+		"status=open":                                 "a,b",
+		"status[in]=open,draft&sort=-priority":        "d,b,a",
+		"status[nin]=open":                            "c,d",
+		"status[ne]=open":                             "c,d",
+		"priority[gte]=2&priority[lt]=5":              "b,c",
+		"createdAt[gte]=2026-01-02&sort=-createdAt":   "d,c,b",
+		"created_at[lt]=2026-01-02T09:00:00+09:00":    "a",
+		"dueAt[null]=false":                           "b",
+		"due_at[null]=true&sort=status,-Priority":     "c,d,a",
+		"title[like]=fix_":                            "c",
+		"title[like]=100%25":                          "a",
+		"Title[like]=login&cursor=abc&limit=10":       "c,d",
+		"status=open&priority=3":                      "b",
+		"status=open&status=closed":                   "",
+		"priority[gt]=0&priority[lte]=5&status[in]=x": "",
+	}
+	for query, want := range cases {
+		if got := filteredIds(t, scoped, query); got != want {
+			t.Errorf("%s: got %q want %q", query, got, want)
+		}
+	}
+}
+
+func TestQueryFilterRejectsUnknownAndUnsafeInput(t *testing.T) {
+	db, _ := openFilterTestDB(t)
+	cases := []string{
+		"secret_note=x",         // filter タグの無いカラム
+		"tenant_id=t2",          // 〃（テナントの切り替えに使わせない）
+		"status[like]=op",       // 許可していない演算子
+		"priority[gt]=1 OR 1=1", // 型に変換できない値
+		"title[eq]=x",           // like だけ許可
+		"status[unknown]=x",     // 未知の演算子
+		"status[=x",             // 壊れたキー
+		"sort=title",            // sort を許可していない
+		"sort=status%3BDROP%20TABLE%20filter_tasks", // 未知のカラム
+		"due_at[null]=maybe",
+		"created_at[gte]=yesterday",
+	}
+	for _, raw := range cases {
+		query, _ := url.ParseQuery(raw)
+		if _, err := ParseQueryFilter[filterTask](db, query); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%s: err=%v", raw, err)
+		}
+	}
+}
+
+func TestQueryFilterWithPaginate(t *testing.T) {
+	db, ctx := openFilterTestDB(t)
+	gw_pagination.SetCursorKey([]byte("test-cursor-key"))
+	query, _ := url.ParseQuery("status[in]=open,closed,draft&sort=-priority")
+	filter, err := ParseQueryFilter[filterTask](db, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := Paginate[filterTask](filter.Where(db.WithContext(ctx)), gw_pagination.PageRequest{Limit: 2, Sort: filter.Sort})
+	if err != nil || len(page.Items) != 2 || page.Items[0].Id != "d" || page.Items[1].Id != "b" || page.NextCursor == "" {
+		t.Fatalf("page=%+v err=%v", page, err)
+	}
+}
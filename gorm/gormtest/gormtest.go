@@ -0,0 +1,48 @@
+// Package gw_gormtest は gw_gorm を使うアプリのテスト用ヘルパー。
+// gw_gorm 本体を特定の DB ドライバへ依存させないため、SQLite ドライバはこのパッケージだけが読み込む。
+package gw_gormtest
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var sequence atomic.Int64
+
+// OpenSQLite はテスト専用のインメモリ SQLite を開き、migrations を全て適用した *gorm.DB を返す。
+// 設定は gw_gorm.DefaultConfig（SQL ログは出さない）。DB はテスト終了時に閉じる。
+// 本番用の PostgreSQL / MySQL 固有の SQL マイグレーションは SQLite で実行できないため、
+// 方言に依存しない Go マイグレーション（Migrator().CreateTable 等）で書いたものを対象にする。
+func OpenSQLite(t testing.TB, migrations ...gw_gorm.Migration) *gorm.DB {
+	t.Helper()
+	config := gw_gorm.DefaultConfig(false)
+	config.Logger = logger.Default.LogMode(logger.Silent)
+	// サブテスト名の "/" や並列実行でも DB を共有しないよう、連番で一意な名前にする
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name()) + "_" + strconv.FormatInt(sequence.Add(1), 10)
+	db, err := gorm.Open(sqlite.Open("file:"+name+"?mode=memory&cache=shared"), config)
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("sql db: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	migrator, err := gw_gorm.NewMigrator(db, migrations...)
+	if err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatalf("apply migrations: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,47 @@
+package gw_gormtest
+
+import (
+	"context"
+	"testing"
+
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	"gorm.io/gorm"
+)
+
+type note struct {
+	Id   string
+	Body string
+}
+
+func TestOpenSQLiteAppliesMigrations(t *testing.T) {
+	migrations := []gw_gorm.Migration{
+		{Version: "1", Name: "create_note", Up: func(tx *gorm.DB) error { return tx.Migrator().CreateTable(&note{}) }},
+		{Version: "2", Name: "seed", UpSQL: "INSERT INTO note (id, body) VALUES ('n1', 'hello');"},
+	}
+	for _, name := range []string{"first", "second"} {
+		t.Run(name, func(t *testing.T) {
+			db := OpenSQLite(t, migrations...)
+			var count int64
+			if err := db.Model(&note{}).Count(&count).Error; err != nil || count != 1 {
+				t.Fatalf("each test must get a fresh migrated db: count=%d err=%v", count, err)
+			}
+			var applied int64
+			db.Model(&gw_gorm.SchemaMigration{}).Count(&applied)
+			if applied != 2 {
+				t.Fatalf("schema_migrations rows=%d", applied)
+			}
+		})
+	}
+}
+
+func TestMockRepository(t *testing.T) {
+	var repo gw_gorm.Repository[note] = &MockRepository[note]{
+		GetFunc: func(ctx context.Context, id any) (*note, error) { return &note{Id: id.(string)}, nil },
+	}
+	if n, err := repo.Get(context.Background(), "n1"); err != nil || n.Id != "n1" {
+		t.Fatalf("note=%+v err=%v", n, err)
+	}
+	if err := repo.Delete(context.Background(), "n1"); err == nil {
+		t.Fatal("methods without a func must return an error")
+	}
+}
@@ -0,0 +1,89 @@
+package gw_gormtest
+
+import (
+	"context"
+	"fmt"
+
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+)
+
+// MockRepository はサービス層のテスト用の gw_gorm.Repository[T]。必要なメソッドの XxxFunc だけを設定する。
+// 設定していないメソッドを呼ぶとエラーを返す（Exists / Count はゼロ値とエラー）。
+//
+//	repo := &gw_gormtest.MockRepository[Todo]{
+//	    GetFunc: func(ctx context.Context, id any) (*Todo, error) { return &Todo{Id: id.(string)}, nil },
+//	}
+//	svc := NewTodoService(repo)
+type MockRepository[T any] struct {
+	GetFunc    func(ctx context.Context, id any) (*T, error)
+	ListFunc   func(ctx context.Context, filter *gw_gorm.QueryFilter, page gw_pagination.PageRequest) (*gw_pagination.Page[T], error)
+	CreateFunc func(ctx context.Context, ent *T) error
+	UpdateFunc func(ctx context.Context, id any, fields map[string]any) error
+	DeleteFunc func(ctx context.Context, id any) error
+	ExistsFunc func(ctx context.Context, id any) (bool, error)
+	CountFunc  func(ctx context.Context, filter *gw_gorm.QueryFilter) (int64, error)
+	UpsertFunc func(ctx context.Context, ents []*T, conflictColumns ...string) error
+}
+
+var _ gw_gorm.Repository[struct{}] = (*MockRepository[struct{}])(nil)
+
+func notMocked(method string) error {
+	return fmt.Errorf("gw_gormtest: MockRepository.%s is not mocked", method)
+}
+
+func (m *MockRepository[T]) Get(ctx context.Context, id any) (*T, error) {
+	if m.GetFunc == nil {
+		return nil, notMocked("Get")
+	}
+	return m.GetFunc(ctx, id)
+}
+
+func (m *MockRepository[T]) List(ctx context.Context, filter *gw_gorm.QueryFilter, page gw_pagination.PageRequest) (*gw_pagination.Page[T], error) {
+	if m.ListFunc == nil {
+		return nil, notMocked("List")
+	}
+	return m.ListFunc(ctx, filter, page)
+}
+
+func (m *MockRepository[T]) Create(ctx context.Context, ent *T) error {
+	if m.CreateFunc == nil {
+		return notMocked("Create")
+	}
+	return m.CreateFunc(ctx, ent)
+}
+
+func (m *MockRepository[T]) Update(ctx context.Context, id any, fields map[string]any) error {
+	if m.UpdateFunc == nil {
+		return notMocked("Update")
+	}
+	return m.UpdateFunc(ctx, id, fields)
+}
+
+func (m *MockRepository[T]) Delete(ctx context.Context, id any) error {
+	if m.DeleteFunc == nil {
+		return notMocked("Delete")
+	}
+	return m.DeleteFunc(ctx, id)
+}
+
+func (m *MockRepository[T]) Exists(ctx context.Context, id any) (bool, error) {
+	if m.ExistsFunc == nil {
+		return false, notMocked("Exists")
+	}
+	return m.ExistsFunc(ctx, id)
+}
+
+func (m *MockRepository[T]) Count(ctx context.Context, filter *gw_gorm.QueryFilter) (int64, error) {
+	if m.CountFunc == nil {
+		return 0, notMocked("Count")
+	}
+	return m.CountFunc(ctx, filter)
+}
+
+func (m *MockRepository[T]) Upsert(ctx context.Context, ents []*T, conflictColumns ...string) error {
+	if m.UpsertFunc == nil {
+		return notMocked("Upsert")
+	}
+	return m.UpsertFunc(ctx, ents, conflictColumns...)
+}
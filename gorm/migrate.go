@@ -0,0 +1,389 @@
+package gw_gorm
+
+// このファイルはバージョン管理されたスキーママイグレーション（Migrator）を置く。
+// 適用履歴は schema_migrations テーブルに記録し、Go 関数と SQL ファイルのどちらのマイグレーションも扱える。
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// マイグレーションのエラー。
+var (
+	ErrMigrationChecksum     = errors.New("migration checksum mismatch")
+	ErrMigrationMissing      = errors.New("applied migration is missing from the source")
+	ErrIrreversibleMigration = errors.New("migration has no down")
+)
+
+// Migration は1件のマイグレーション。Up / UpSQL のどちらか一方を指定する（Down / DownSQL も同様）。
+type Migration struct {
+	// Version は適用順を決める識別子。文字列として昇順に適用するので、桁を揃えたタイムスタンプ（20260101120000）を推奨。
+	Version string
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+	UpSQL   string
+	DownSQL string
+	// NoTransaction は CREATE INDEX CONCURRENTLY などトランザクション内で実行できないマイグレーション用。
+	NoTransaction bool
+}
+
+// Checksum は適用済みマイグレーションの改変検出に使う値。SQL は本文、Go 関数は Version と Name から計算する
+// （関数本体は比較できないため、Go マイグレーションを書き換える場合は新しい Version を足すこと）。
+func (m Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Version + "\n" + m.Name + "\n" + m.UpSQL + "\n" + m.DownSQL))
+	return hex.EncodeToString(sum[:])
+}
+
+// SchemaMigration は適用履歴テーブル（schema_migrations）。
+type SchemaMigration struct {
+	Version   string `gorm:"primaryKey;type:varchar(64)"`
+	Name      string `gorm:"type:varchar(255)"`
+	Checksum  string `gorm:"type:varchar(64)"`
+	AppliedAt time.Time
+}
+
+func (SchemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationStatus は Status が返す各マイグレーションの適用状況。
+type MigrationStatus struct {
+	Version   string
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator は migrations を Version 順に適用・巻き戻す。
+//
+//	migrator, err := gw_gorm.NewMigrator(db, migrations...)
+//	applied, err := migrator.Up(ctx)
+//
+// 複数レプリカが同時に起動しても、PostgreSQL / MySQL ではアドバイザリロックで1プロセスだけが適用する。
+// マイグレーションはテナント横断の管理操作なので、Up / Down に渡す tx は BypassTenantGuard 済み。
+type Migrator struct {
+	db         *gorm.DB
+	migrations []Migration
+	dryRun     io.Writer
+}
+
+// NewMigrator は migrations を検証して Migrator を返す。Version の重複・Up の欠落はエラー。
+func NewMigrator(db *gorm.DB, migrations ...Migration) (*Migrator, error) {
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int { return strings.Compare(a.Version, b.Version) })
+	for i, m := range sorted {
+		if m.Version == "" {
+			return nil, fmt.Errorf("migration %q: version is required", m.Name)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migration %s: duplicate version", m.Version)
+		}
+		if (m.Up == nil) == (m.UpSQL == "") {
+			return nil, fmt.Errorf("migration %s: exactly one of Up and UpSQL is required", m.Version)
+		}
+		if m.Down != nil && m.DownSQL != "" {
+			return nil, fmt.Errorf("migration %s: Down and DownSQL are exclusive", m.Version)
+		}
+	}
+	return &Migrator{db: db, migrations: sorted}, nil
+}
+
+// WithDryRun は実行せずに SQL を w へ書き出す Migrator を返す。
+// Go マイグレーションは DryRun セッションで組み立てた SQL を書き出す（結果を読む処理は空の結果で進む）。
+func (m *Migrator) WithDryRun(w io.Writer) *Migrator {
+	clone := *m
+	clone.dryRun = w
+	return &clone
+}
+
+// Up は未適用のマイグレーションを全て適用し、適用した Version を返す。
+// 適用済みマイグレーションの改変（ErrMigrationChecksum）やソースからの削除（ErrMigrationMissing）があれば何もしない。
+func (m *Migrator) Up(ctx context.Context) ([]string, error) {
+	return m.UpTo(ctx, "")
+}
+
+// UpTo は version まで（version を含む）の未適用マイグレーションを適用する。version が "" なら全て。
+func (m *Migrator) UpTo(ctx context.Context, version string) ([]string, error) {
+	var applied []string
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		records, err := m.appliedRecords(conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range m.migrations {
+			if version != "" && migration.Version > version {
+				break
+			}
+			if _, ok := records[migration.Version]; ok {
+				continue
+			}
+			if err := m.run(conn, migration, true); err != nil {
+				return err
+			}
+			applied = append(applied, migration.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down は適用済みのマイグレーションを新しい順に steps 件巻き戻し、巻き戻した Version を返す。
+func (m *Migrator) Down(ctx context.Context, steps int) ([]string, error) {
+	var reverted []string
+	err := m.withLock(ctx, func(conn *gorm.DB) error {
+		records, err := m.appliedRecords(conn)
+		if err != nil {
+			return err
+		}
+		for i := len(m.migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if _, ok := records[migration.Version]; !ok {
+				continue
+			}
+			if migration.Down == nil && migration.DownSQL == "" {
+				return fmt.Errorf("%w: %s", ErrIrreversibleMigration, migration.Version)
+			}
+			if err := m.run(conn, migration, false); err != nil {
+				return err
+			}
+			reverted = append(reverted, migration.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status は各マイグレーションの適用状況を Version 順に返す。
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var records []SchemaMigration
+	db := m.db.WithContext(ctx)
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		if err := db.Find(&records).Error; err != nil {
+			return nil, err
+		}
+	}
+	appliedAt := map[string]time.Time{}
+	for _, r := range records {
+		appliedAt[r.Version] = r.AppliedAt
+	}
+	statuses := make([]MigrationStatus, 0, len(m.migrations))
+	for _, migration := range m.migrations {
+		at, ok := appliedAt[migration.Version]
+		statuses = append(statuses, MigrationStatus{Version: migration.Version, Name: migration.Name, Applied: ok, AppliedAt: at})
+	}
+	return statuses, nil
+}
+
+// withLock は1本のコネクションを確保し、アドバイザリロックを取ってから fn を実行する。
+// セッション単位のロックなので、同じコネクションで解放する必要がある（db.Connection で固定する）。
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	// マイグレーションは全テナントの行を扱うため、アプリのガードと RLS の両方を外す
+	db := BypassRLS(BypassTenantGuard(m.db.WithContext(ctx)))
+	if m.dryRun != nil {
+		return fn(db)
+	}
+	return db.Connection(func(conn *gorm.DB) error {
+		// Connection の tx は条件が残留するため、再利用可能な起点にしてから使い回す
+		conn = conn.Session(&gorm.Session{})
+		lock, unlock := advisoryLockSQL(conn.Dialector.Name())
+		if lock != "" {
+			if err := conn.Exec(lock, migrationLockKey()).Error; err != nil {
+				return fmt.Errorf("acquire migration lock: %w", err)
+			}
+			defer func() {
+				if err := conn.Exec(unlock, migrationLockKey()).Error; err != nil {
+					slog.WarnContext(ctx, "release migration lock failed", "error", err)
+				}
+			}()
+		}
+		if err := conn.AutoMigrate(&SchemaMigration{}); err != nil {
+			return err
+		}
+		return fn(conn)
+	})
+}
+
+func advisoryLockSQL(dialect string) (lock string, unlock string) {
+	switch dialect {
+	case "postgres":
+		return "SELECT pg_advisory_lock(?)", "SELECT pg_advisory_unlock(?)"
+	case "mysql":
+		return "SELECT GET_LOCK(?, -1)", "SELECT RELEASE_LOCK(?)"
+	default:
+		// SQLite 等の単一プロセス前提の DB ではロックしない
+		return "", ""
+	}
+}
+
+func migrationLockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("gw_gorm:schema_migrations"))
+	return int64(h.Sum64() >> 1)
+}
+
+// appliedRecords は適用履歴を読み、ソースとの整合性（改変・削除）を検証する。
+func (m *Migrator) appliedRecords(conn *gorm.DB) (map[string]SchemaMigration, error) {
+	records := map[string]SchemaMigration{}
+	if m.dryRun != nil && !conn.Migrator().HasTable(&SchemaMigration{}) {
+		return records, nil
+	}
+	var rows []SchemaMigration
+	if err := conn.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	known := map[string]Migration{}
+	for _, migration := range m.migrations {
+		known[migration.Version] = migration
+	}
+	for _, r := range rows {
+		migration, ok := known[r.Version]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrMigrationMissing, r.Version)
+		}
+		if migration.Checksum() != r.Checksum {
+			return nil, fmt.Errorf("%w: %s", ErrMigrationChecksum, r.Version)
+		}
+		records[r.Version] = r
+	}
+	return records, nil
+}
+
+func (m *Migrator) run(conn *gorm.DB, migration Migration, up bool) error {
+	fn, sqlText := migration.Up, migration.UpSQL
+	if !up {
+		fn, sqlText = migration.Down, migration.DownSQL
+	}
+	if m.dryRun != nil {
+		direction := "up"
+		if !up {
+			direction = "down"
+		}
+		if _, err := fmt.Fprintf(m.dryRun, "-- %s %s %s\n", migration.Version, migration.Name, direction); err != nil {
+			return err
+		}
+		if fn == nil {
+			_, err := fmt.Fprintf(m.dryRun, "%s\n", strings.TrimSpace(sqlText))
+			return err
+		}
+		recorder := &sqlRecorder{w: m.dryRun}
+		if err := fn(conn.Session(&gorm.Session{DryRun: true, Logger: recorder})); err != nil {
+			return err
+		}
+		return recorder.err
+	}
+
+	apply := func(tx *gorm.DB) error {
+		var err error
+		if fn != nil {
+			err = fn(tx)
+		} else {
+			err = tx.Exec(sqlText).Error
+		}
+		if err != nil {
+			return fmt.Errorf("migration %s %s: %w", migration.Version, migration.Name, err)
+		}
+		if up {
+			return tx.Create(&SchemaMigration{
+				Version:   migration.Version,
+				Name:      migration.Name,
+				Checksum:  migration.Checksum(),
+				AppliedAt: time.Now().UTC(),
+			}).Error
+		}
+		return tx.Where("version = ?", migration.Version).Delete(&SchemaMigration{}).Error
+	}
+	var err error
+	if migration.NoTransaction {
+		err = apply(conn)
+	} else {
+		err = conn.Transaction(apply)
+	}
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(conn.Statement.Context, "migration applied", "version", migration.Version, "name", migration.Name, "up", up)
+	return nil
+}
+
+// LoadSQLMigrations は dir 配下の "<version>_<name>.up.sql" / "<version>_<name>.down.sql" を読み込む。
+// embed.FS と組み合わせてバイナリに同梱する想定。down の無いマイグレーションは巻き戻せない。
+func LoadSQLMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[string]*Migration{}
+	var order []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		base, up := strings.CutSuffix(entry.Name(), ".up.sql")
+		if !up {
+			var down bool
+			if base, down = strings.CutSuffix(entry.Name(), ".down.sql"); !down {
+				continue
+			}
+		}
+		version, name, ok := strings.Cut(base, "_")
+		if !ok || version == "" {
+			return nil, fmt.Errorf("migration file %s: name must be <version>_<name>.(up|down).sql", entry.Name())
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+			order = append(order, version)
+		}
+		if up {
+			migration.UpSQL = string(body)
+		} else {
+			migration.DownSQL = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(order))
+	for _, version := range order {
+		if byVersion[version].UpSQL == "" {
+			return nil, fmt.Errorf("migration %s: up.sql is missing", version)
+		}
+		migrations = append(migrations, *byVersion[version])
+	}
+	return migrations, nil
+}
+
+// sqlRecorder は DryRun セッションで組み立てた SQL を書き出す logger.Interface。
+type sqlRecorder struct {
+	w   io.Writer
+	err error
+}
+
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface      { return r }
+func (r *sqlRecorder) Info(context.Context, string, ...interface{})  {}
+func (r *sqlRecorder) Warn(context.Context, string, ...interface{})  {}
+func (r *sqlRecorder) Error(context.Context, string, ...interface{}) {}
+
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	if r.err != nil {
+		return
+	}
+	if sql, _ := fc(); sql != "" {
+		_, r.err = fmt.Fprintf(r.w, "%s;\n", sql)
+	}
+}
@@ -0,0 +1,225 @@
+package gw_gorm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type migrationAccount struct {
+	Id       string
+	TenantId string
+	Name     string
+}
+
+func (migrationAccount) TenantScoped() {}
+
+func openMigrationTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UseTenantGuard(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		{
+			Version: "20260102000000", Name: "backfill_account_name",
+			// マイグレーションの tx は BypassTenantGuard 済みなので、ガード対象モデルも更新できる
+			Up: func(tx *gorm.DB) error {
+				return tx.Model(&migrationAccount{}).Where("name = ?", "").Update("name", "unnamed").Error
+			},
+		},
+		{
+			Version: "20260101000000", Name: "create_account",
+			UpSQL:   "CREATE TABLE migration_accounts (id text PRIMARY KEY, tenant_id text, name text);\nINSERT INTO migration_accounts VALUES ('a', 't1', '');",
+			DownSQL: "DROP TABLE migration_accounts;",
+		},
+	}
+}
+
+func TestMigratorUpDownAndStatus(t *testing.T) {
+	db := openMigrationTestDB(t)
+	ctx := context.Background()
+	migrator, err := NewMigrator(db, testMigrations()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, []string{"20260101000000", "20260102000000"}) {
+		t.Fatalf("applied=%v", applied)
+	}
+	var name string
+	if err := db.Raw("SELECT name FROM migration_accounts WHERE id = 'a'").Scan(&name).Error; err != nil || name != "unnamed" {
+		t.Fatalf("backfill name=%q err=%v", name, err)
+	}
+	if again, err := migrator.Up(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("second Up must be a no-op: %v %v", again, err)
+	}
+
+	// Go マイグレーションに Down が無いので巻き戻せない
+	if _, err := migrator.Down(ctx, 1); !errors.Is(err, ErrIrreversibleMigration) {
+		t.Fatalf("err=%v", err)
+	}
+
+	irreversibleFree := testMigrations()
+	irreversibleFree[0].Down = func(tx *gorm.DB) error { return nil }
+	migrator, err = NewMigrator(db, irreversibleFree...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := migrator.Down(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(reverted, []string{"20260102000000", "20260101000000"}) {
+		t.Fatalf("reverted=%v", reverted)
+	}
+	if db.Migrator().HasTable("migration_accounts") {
+		t.Fatal("down SQL must drop the table")
+	}
+
+	if applied, err := migrator.UpTo(ctx, "20260101000000"); err != nil || !reflect.DeepEqual(applied, []string{"20260101000000"}) {
+		t.Fatalf("UpTo applied=%v err=%v", applied, err)
+	}
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[0].AppliedAt.IsZero() || statuses[1].Applied {
+		t.Fatalf("statuses=%+v", statuses)
+	}
+}
+
+func TestMigratorVerifiesAppliedMigrations(t *testing.T) {
+	db := openMigrationTestDB(t)
+	ctx := context.Background()
+	migrator, _ := NewMigrator(db, testMigrations()...)
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	edited := testMigrations()
+	edited[1].UpSQL += "\nINSERT INTO migration_accounts VALUES ('b', 't1', '');"
+	migrator, _ = NewMigrator(db, edited...)
+	if _, err := migrator.Up(ctx); !errors.Is(err, ErrMigrationChecksum) {
+		t.Fatalf("edited migration must be rejected: %v", err)
+	}
+
+	migrator, _ = NewMigrator(db, testMigrations()[1:]...)
+	if _, err := migrator.Up(ctx); !errors.Is(err, ErrMigrationMissing) {
+		t.Fatalf("removed migration must be rejected: %v", err)
+	}
+}
+
+func TestMigratorFailedMigrationIsRolledBack(t *testing.T) {
+	db := openMigrationTestDB(t)
+	migrations := append(testMigrations(), Migration{Version: "20260103000000", Name: "broken", UpSQL: "CREATE TABLE broken (id text); SELECT * FROM no_such_table;"})
+	migrator, _ := NewMigrator(db, migrations...)
+
+	applied, err := migrator.Up(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "20260103000000 broken") {
+		t.Fatalf("err=%v", err)
+	}
+	if len(applied) != 2 || db.Migrator().HasTable("broken") {
+		t.Fatalf("failed migration must be rolled back: applied=%v", applied)
+	}
+	var count int64
+	db.Model(&SchemaMigration{}).Count(&count)
+	if count != 2 {
+		t.Fatalf("schema_migrations rows=%d", count)
+	}
+}
+
+func TestMigratorDryRun(t *testing.T) {
+	db := openMigrationTestDB(t)
+	migrations := append(testMigrations(), Migration{
+		Version: "20260103000000", Name: "create_note",
+		Up: func(tx *gorm.DB) error { return tx.Migrator().CreateTable(&plainNote{}) },
+	})
+	migrator, _ := NewMigrator(db, migrations...)
+
+	var out bytes.Buffer
+	applied, err := migrator.WithDryRun(&out).Up(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	printed := out.String()
+	for _, want := range []string{"-- 20260101000000 create_account up", "CREATE TABLE migration_accounts", "UPDATE `migration_accounts` SET `name`=\"unnamed\"", "CREATE TABLE `plain_notes`"} {
+		if !strings.Contains(printed, want) {
+			t.Fatalf("dry run output must contain %q:\n%s", want, printed)
+		}
+	}
+	if len(applied) != 3 || db.Migrator().HasTable("migration_accounts") || db.Migrator().HasTable(&SchemaMigration{}) {
+		t.Fatalf("dry run must not touch the database: applied=%v", applied)
+	}
+}
+
+func TestNewMigratorValidation(t *testing.T) {
+	cases := []struct {
+		name       string
+		migrations []Migration
+	}{
+		{"missing version", []Migration{{Name: "x", UpSQL: "SELECT 1"}}},
+		{"duplicate", []Migration{{Version: "1", UpSQL: "SELECT 1"}, {Version: "1", UpSQL: "SELECT 2"}}},
+		{"no up", []Migration{{Version: "1"}}},
+		{"both up", []Migration{{Version: "1", UpSQL: "SELECT 1", Up: func(*gorm.DB) error { return nil }}}},
+	}
+	for _, c := range cases {
+		if _, err := NewMigrator(nil, c.migrations...); err == nil {
+			t.Fatalf("%s: expected error", c.name)
+		}
+	}
+}
+
+func TestLoadSQLMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/20260101000000_create_account.up.sql":   {Data: []byte("CREATE TABLE account (id text);")},
+		"migrations/20260101000000_create_account.down.sql": {Data: []byte("DROP TABLE account;")},
+		"migrations/20260102000000_add_index.up.sql":        {Data: []byte("CREATE INDEX idx ON account (id);")},
+		"migrations/README.md":                              {Data: []byte("ignored")},
+	}
+	migrations, err := LoadSQLMigrations(fsys, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "create_account" || migrations[0].DownSQL != "DROP TABLE account;" || migrations[1].DownSQL != "" {
+		t.Fatalf("migrations=%+v", migrations)
+	}
+
+	fsys["migrations/20260103000000_orphan.down.sql"] = &fstest.MapFile{Data: []byte("SELECT 1")}
+	if _, err := LoadSQLMigrations(fsys, "migrations"); err == nil {
+		t.Fatal("down without up must be rejected")
+	}
+}
+
+func TestAdvisoryLockSQL(t *testing.T) {
+	if lock, unlock := advisoryLockSQL("postgres"); lock != "SELECT pg_advisory_lock(?)" || unlock != "SELECT pg_advisory_unlock(?)" {
+		t.Fatalf("postgres lock=%q unlock=%q", lock, unlock)
+	}
+	if lock, _ := advisoryLockSQL("sqlite"); lock != "" {
+		t.Fatalf("sqlite must not lock: %q", lock)
+	}
+	if migrationLockKey() <= 0 || migrationLockKey() != migrationLockKey() {
+		t.Fatal("lock key must be a stable positive int64")
+	}
+}
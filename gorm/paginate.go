@@ -0,0 +1,91 @@
+package gw_gorm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// Paginate は req.Sort の順でカーソル方式のページングを行う（OFFSET を使わない）。
+// db に付けた Where / Joins / Preload はそのまま効き、Tenant Guard も通常の Find と同じく適用される。
+// Order / Limit / Offset は Paginate が組み立てるため db には付けないこと。
+//
+//   - Sort が空、または主キーを含まない場合は主キーの昇順を末尾に補う（同じ値の行を取りこぼさないため）
+//   - Sort の Column はモデルに存在するカラムのみ（リクエストの値をそのまま渡しても任意のSQLにはならない）
+//   - ソートキーの値は NULL にならないこと
+//   - 不正・改ざん・別のソート順のカーソルは gw_pagination.ErrInvalidCursor
+func Paginate[T any](db *gorm.DB, req gw_pagination.PageRequest) (*gw_pagination.Page[T], error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	if stmt.Schema.PrioritizedPrimaryField == nil {
+		return nil, errors.New("paginate requires a model with a primary key")
+	}
+	req = req.WithTieBreaker(stmt.Schema.PrioritizedPrimaryField.DBName)
+	fields := make([]*schema.Field, len(req.Sort))
+	for i, sort := range req.Sort {
+		field := stmt.Schema.LookUpField(sort.Column)
+		if field == nil || field.DBName == "" {
+			return nil, fmt.Errorf("unknown sort column %q", sort.Column)
+		}
+		fields[i] = field
+	}
+
+	var cursor *gw_pagination.Cursor
+	if req.Cursor != "" {
+		var err error
+		if cursor, err = gw_pagination.DecodeCursor(req.Sort, req.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	backward := cursor != nil && cursor.Direction == gw_pagination.Prev
+
+	tx := db.Model(new(T))
+	if cursor != nil {
+		tx = tx.Where(keysetCondition(fields, req.Sort, cursor.Values, backward))
+	}
+	for i, sort := range req.Sort {
+		tx = tx.Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: fields[i].DBName}, Desc: sort.Desc != backward})
+	}
+	var rows []T
+	if err := tx.Limit(req.PageLimit() + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return gw_pagination.NewPage(req, cursor, rows, func(row T) ([]any, error) {
+		v := reflect.Indirect(reflect.ValueOf(&row).Elem())
+		values := make([]any, len(fields))
+		for i, field := range fields {
+			values[i], _ = field.ValueOf(tx.Statement.Context, v)
+		}
+		return values, nil
+	})
+}
+
+// keysetCondition は「カーソルの行より後ろ」の条件を作る。
+// (a, b) の昇順なら a > ? OR (a = ? AND b > ?)。降順のキーと逆方向（backward）では比較を反転する。
+func keysetCondition(fields []*schema.Field, sort []gw_pagination.SortField, values []any, backward bool) clause.Expression {
+	var terms []string
+	var vars []any
+	for i := range fields {
+		var conds []string
+		for j := 0; j < i; j++ {
+			conds = append(conds, "? = ?")
+			vars = append(vars, clause.Column{Table: clause.CurrentTable, Name: fields[j].DBName}, values[j])
+		}
+		op := ">"
+		if sort[i].Desc != backward {
+			op = "<"
+		}
+		conds = append(conds, "? "+op+" ?")
+		vars = append(vars, clause.Column{Table: clause.CurrentTable, Name: fields[i].DBName}, values[i])
+		terms = append(terms, "("+strings.Join(conds, " AND ")+")")
+	}
+	return clause.Expr{SQL: "(" + strings.Join(terms, " OR ") + ")", Vars: vars}
+}
@@ -0,0 +1,114 @@
+package gw_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"gorm.io/gorm"
+)
+
+type pagedEvent struct {
+	Id        string
+	TenantId  string
+	Rank      int
+	CreatedAt time.Time
+}
+
+func (pagedEvent) TenantScoped() {}
+
+func openPaginateTestDB(t *testing.T) (*gorm.DB, context.Context) {
+	t.Helper()
+	gw_pagination.SetCursorKey([]byte("test-cursor-key"))
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	var events []pagedEvent
+	for i := 0; i < 7; i++ {
+		// rank は重複させ、同じ rank の中は id で並ぶことを確かめる
+		events = append(events, pagedEvent{Id: fmt.Sprintf("e%d", i), TenantId: "t1", Rank: i / 2, CreatedAt: base.Add(time.Duration(i) * time.Minute)})
+	}
+	events = append(events, pagedEvent{Id: "x0", TenantId: "t2", Rank: 9, CreatedAt: base})
+	return migrateAndSeed(t, &pagedEvent{}, events)
+}
+
+func pageIds(page *gw_pagination.Page[pagedEvent]) string {
+	ids := make([]string, len(page.Items))
+	for i, item := range page.Items {
+		ids[i] = item.Id
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestPaginateWalksForwardAndBackward(t *testing.T) {
+	db, ctx := openPaginateTestDB(t)
+	scoped := db.WithContext(ctx)
+	req := gw_pagination.PageRequest{Limit: 3, Sort: []gw_pagination.SortField{{Column: "rank", Desc: true}}}
+
+	want := []string{"e6,e4,e5", "e2,e3,e0", "e1"}
+	var pages []*gw_pagination.Page[pagedEvent]
+	for i, expected := range want {
+		page, err := Paginate[pagedEvent](scoped, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pageIds(page); got != expected {
+			t.Fatalf("page %d=%s want %s (other tenants must be excluded)", i, got, expected)
+		}
+		pages = append(pages, page)
+		req.Cursor = page.NextCursor
+	}
+	if pages[0].PrevCursor != "" || pages[2].NextCursor != "" || pages[1].NextCursor == "" || pages[2].PrevCursor == "" {
+		t.Fatalf("cursor presence: %+v", pages)
+	}
+
+	req.Cursor = pages[2].PrevCursor
+	back, err := Paginate[pagedEvent](scoped, req)
+	if err != nil || pageIds(back) != "e2,e3,e0" || back.PrevCursor == "" || back.NextCursor == "" {
+		t.Fatalf("prev page=%+v err=%v", back, err)
+	}
+	req.Cursor = back.PrevCursor
+	first, err := Paginate[pagedEvent](scoped, req)
+	if err != nil || pageIds(first) != "e6,e4,e5" || first.PrevCursor != "" {
+		t.Fatalf("first page=%+v err=%v", first, err)
+	}
+}
+
+func TestPaginateByTimeWithFilter(t *testing.T) {
+	db, ctx := openPaginateTestDB(t)
+	req := gw_pagination.PageRequest{Limit: 2, Sort: []gw_pagination.SortField{{Column: "created_at"}}}
+	filtered := db.WithContext(ctx).Where("rank >= ?", 1)
+
+	first, err := Paginate[pagedEvent](filtered, req)
+	if err != nil || pageIds(first) != "e2,e3" {
+		t.Fatalf("first=%+v err=%v", first, err)
+	}
+	req.Cursor = first.NextCursor
+	second, err := Paginate[pagedEvent](db.WithContext(ctx).Where("rank >= ?", 1), req)
+	if err != nil || pageIds(second) != "e4,e5" {
+		t.Fatalf("second=%+v err=%v", second, err)
+	}
+}
+
+func TestPaginateRejectsInvalidInput(t *testing.T) {
+	db, ctx := openPaginateTestDB(t)
+	scoped := db.WithContext(ctx)
+	req := gw_pagination.PageRequest{Limit: 2, Sort: []gw_pagination.SortField{{Column: "rank"}}}
+	page, err := Paginate[pagedEvent](scoped, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 別のソート順のカーソル
+	other := gw_pagination.PageRequest{Limit: 2, Cursor: page.NextCursor, Sort: []gw_pagination.SortField{{Column: "rank", Desc: true}}}
+	if _, err := Paginate[pagedEvent](scoped, other); !errors.Is(err, gw_pagination.ErrInvalidCursor) {
+		t.Fatalf("cursor for another sort must be rejected: %v", err)
+	}
+	// モデルに無いカラム
+	bad := gw_pagination.PageRequest{Sort: []gw_pagination.SortField{{Column: "rank; DROP TABLE paged_events"}}}
+	if _, err := Paginate[pagedEvent](scoped, bad); err == nil {
+		t.Fatal("unknown sort column must be rejected")
+	}
+}
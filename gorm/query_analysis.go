@@ -0,0 +1,253 @@
+package gw_gorm
+
+// このファイルは SlogLogger のクエリ分析（スロークエリの EXPLAIN・N+1 の検知・呼び出し元の file:line）を置く。
+
+import (
+	"database/sql"
+	"log/slog"
+	"math/rand/v2"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// UseQueryAnalysis は db.Logger の SlogLogger の設定に従って SELECT を分析するコールバックを登録する（SlogLogger 以外なら何もしない）。
+//   - NPlusOneThreshold: 同じ request_id の中で同じ形（NormalizeSQL）の SELECT がしきい値の回数に達したら "n+1 query" を WARN で1回出す。
+//     request_id（gw_log.WithRequestId）の無いクエリ（バッチ・起動時の処理など）は数えない
+//   - ExplainSampleRate: SlowThreshold を超えた SELECT の EXPLAIN を割合に応じて取り、"slow query plan" を WARN で出す。
+//     PostgreSQL / MySQL は EXPLAIN、SQLite は EXPLAIN QUERY PLAN（ANALYZE は付けないので再実行はしない）
+//
+// EXPLAIN は元のクエリの Statement.ConnPool で実行する。トランザクション内なら同じコネクション、
+// そうでなければ同じコネクションプール（UseReadReplicas で振り分けたレプリカならそのレプリカ）の空いているコネクションになる。
+// 失敗は plan_error として出すだけで結果には影響させない。
+// PostgreSQL のトランザクション内では EXPLAIN の失敗でトランザクションが中断されるため取得しない。
+func UseQueryAnalysis(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if callbacks.Query().Get("gw_gorm:query_analysis_start") == nil {
+		if err := callbacks.Query().Before("gorm:query").Register("gw_gorm:query_analysis_start", queryAnalysisStart); err != nil {
+			return err
+		}
+	}
+	if callbacks.Query().Get("gw_gorm:query_analysis") == nil {
+		if err := callbacks.Query().After("gorm:query").Register("gw_gorm:query_analysis", analyzeQuery); err != nil {
+			return err
+		}
+	}
+	if callbacks.Row().Get("gw_gorm:query_analysis_row") == nil {
+		if err := callbacks.Row().After("gorm:row").Register("gw_gorm:query_analysis_row", analyzeRowQuery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const queryStartedKey = "gw_gorm:query_started"
+
+func queryAnalysisStart(db *gorm.DB) {
+	if l, ok := db.Logger.(*SlogLogger); ok && l.ExplainSampleRate > 0 && l.SlowThreshold > 0 {
+		db.InstanceSet(queryStartedKey, time.Now())
+	}
+}
+
+func analyzeQuery(db *gorm.DB) {
+	l, ok := db.Logger.(*SlogLogger)
+	if !ok || db.Error != nil || db.DryRun || db.Statement.SQL.Len() == 0 {
+		return
+	}
+	detectNPlusOne(db, l)
+	if v, ok := db.InstanceGet(queryStartedKey); ok {
+		if elapsed := time.Since(v.(time.Time)); elapsed > l.SlowThreshold && rand.Float64() < l.ExplainSampleRate {
+			explainSlowQuery(db, elapsed)
+		}
+	}
+}
+
+// analyzeRowQuery は Row / Rows / Pluck など gorm:row を通る SELECT の N+1 だけを数える
+// （行を読み終える前なので EXPLAIN は取らない）。
+func analyzeRowQuery(db *gorm.DB) {
+	l, ok := db.Logger.(*SlogLogger)
+	if !ok || db.Error != nil || db.DryRun || db.Statement.SQL.Len() == 0 {
+		return
+	}
+	detectNPlusOne(db, l)
+}
+
+// detectNPlusOne は request_id ごとに正規化した SQL の回数を数え、しきい値に達した1回だけ WARN を出す。
+func detectNPlusOne(db *gorm.DB, l *SlogLogger) {
+	ctx := db.Statement.Context
+	if l.NPlusOneThreshold <= 0 || l.LogLevel < gormlogger.Warn {
+		return
+	}
+	requestId := gw_log.RequestIdFromContext(ctx)
+	if requestId == "" {
+		return
+	}
+	query := db.Statement.SQL.String()
+	normalized := NormalizeSQL(query)
+	if queryCounts.add(requestId, normalized) != l.NPlusOneThreshold || !slog.Default().Enabled(ctx, slog.LevelWarn) {
+		return
+	}
+	slog.LogAttrs(ctx, slog.LevelWarn, "n+1 query",
+		slog.String("source", "gorm"),
+		slog.Int("count", l.NPlusOneThreshold),
+		slog.String("sql", db.Dialector.Explain(query, db.Statement.Vars...)),
+		slog.String("normalized_sql", normalized),
+		callerAttr())
+}
+
+func explainSlowQuery(db *gorm.DB, elapsed time.Duration) {
+	ctx := db.Statement.Context
+	if !slog.Default().Enabled(ctx, slog.LevelWarn) {
+		return
+	}
+	var prefix string
+	switch db.Dialector.Name() {
+	case "postgres":
+		if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); inTx {
+			return
+		}
+		prefix = "EXPLAIN "
+	case "mysql":
+		prefix = "EXPLAIN "
+	case "sqlite":
+		prefix = "EXPLAIN QUERY PLAN "
+	default:
+		return
+	}
+	query := db.Statement.SQL.String()
+	attrs := sqlAttrs(db.Dialector.Explain(query, db.Statement.Vars...), db.RowsAffected, elapsed, callerAttr())
+	plan, err := explainPlan(db, prefix+query)
+	if err != nil {
+		attrs = append(attrs, slog.String("plan_error", err.Error()))
+	} else {
+		attrs = append(attrs, slog.Any("plan", plan))
+	}
+	slog.LogAttrs(ctx, slog.LevelWarn, "slow query plan", attrs...)
+}
+
+// explainPlan は EXPLAIN の結果を1行ずつ列を空白で連結した文字列にして返す。
+// トランザクション外では元のクエリとは別のコネクションになることがある（セッション変数は引き継がれない）。
+func explainPlan(db *gorm.DB, query string) ([]string, error) {
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, query, db.Statement.Vars...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	var plan []string
+	values := make([]sql.RawBytes, len(columns))
+	dest := make([]any, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		parts := make([]string, 0, len(values))
+		for _, value := range values {
+			if value != nil {
+				parts = append(parts, string(value))
+			}
+		}
+		plan = append(plan, strings.Join(parts, " "))
+	}
+	return plan, rows.Err()
+}
+
+var (
+	sqlStringLiteral = regexp.MustCompile(`'(?:[^']|'')*'`)
+	sqlNumber        = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	sqlPlaceholder   = regexp.MustCompile(`\$\d+|@p\d+`)
+	sqlInList        = regexp.MustCompile(`(?i)\bIN\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	sqlSpaces        = regexp.MustCompile(`\s+`)
+)
+
+// NormalizeSQL は SQL の文字列・数値のリテラルとプレースホルダを ? に置き換え、IN (?, ?, ...) を IN (?) にまとめる。
+// 値だけが違う同じ形のクエリ（N+1 の典型）が同じ文字列になる。
+func NormalizeSQL(query string) string {
+	query = sqlStringLiteral.ReplaceAllString(query, "?")
+	query = sqlPlaceholder.ReplaceAllString(query, "?")
+	query = sqlNumber.ReplaceAllString(query, "?")
+	query = sqlInList.ReplaceAllString(query, "IN (?)")
+	return strings.TrimSpace(sqlSpaces.ReplaceAllString(query, " "))
+}
+
+// N+1 の集計で保持するリクエスト数・1リクエストあたりの SQL の種類の上限。
+// 上限を超えたら古いリクエストから捨てる（終わったリクエストを明示的に消す手段が無いため）。
+const (
+	maxTrackedRequests      = 1024
+	maxTrackedQueriesPerReq = 256
+)
+
+var queryCounts = newQueryCounter(maxTrackedRequests)
+
+type queryCounter struct {
+	mu       sync.Mutex
+	limit    int
+	order    []string
+	requests map[string]map[string]int
+}
+
+func newQueryCounter(limit int) *queryCounter {
+	return &queryCounter{limit: limit, requests: map[string]map[string]int{}}
+}
+
+// add は requestId の中での query の回数を1つ増やして返す。種類が上限を超えた SQL は数えず 0 を返す。
+func (c *queryCounter) add(requestId, query string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts, ok := c.requests[requestId]
+	if !ok {
+		if len(c.order) >= c.limit {
+			delete(c.requests, c.order[0])
+			c.order = c.order[1:]
+		}
+		counts = map[string]int{}
+		c.requests[requestId] = counts
+		c.order = append(c.order, requestId)
+	}
+	if _, seen := counts[query]; !seen && len(counts) >= maxTrackedQueriesPerReq {
+		return 0
+	}
+	counts[query]++
+	return counts[query]
+}
+
+// gw_gorm 自身（テストを除く）のソースのディレクトリ。呼び出し元の解決で読み飛ばす。
+var packageSourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.ToSlash(filepath.Dir(file)) + "/"
+}()
+
+// callerAttr は GORM と gw_gorm の外で最初にクエリを呼んだ箇所を caller{file, line, function} として返す。
+func callerAttr() slog.Attr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		file := filepath.ToSlash(frame.File)
+		internal := strings.Contains(file, "/gorm.io/") ||
+			(strings.HasPrefix(file, packageSourceDir) && !strings.HasSuffix(file, "_test.go"))
+		if !internal && file != "" && !strings.HasPrefix(frame.Function, "runtime.") {
+			return slog.Group("caller",
+				slog.String("file", file),
+				slog.Int("line", frame.Line),
+				slog.String("function", frame.Function))
+		}
+		if !more {
+			return slog.Attr{}
+		}
+	}
+}
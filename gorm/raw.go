@@ -0,0 +1,237 @@
+package gw_gorm
+
+// このファイルは Tenant Guard を通らない生 SQL（Raw/Exec）向けに、スコープ条件をプレースホルダで埋め込む API を置く。
+// SQL の構文解析による自動注入は JOIN・サブクエリ・CTE で取りこぼすため行わず、
+// スコープ条件の位置を SQL 側で明示させ、証明できなければ実行しない（fail-closed）。
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnscopedRawSQL は ScopedRaw / ScopedExec の SQL にスコープのプレースホルダが無い場合のエラー。
+var ErrUnscopedRawSQL = errors.New("raw SQL must contain a :tenant_scope or :org_scope placeholder")
+
+// :tenant_scope / :org_scope と、任意の (alias) または (alias.column) 指定
+var scopePlaceholderPattern = regexp.MustCompile(`^:(tenant_scope|org_scope)\b(?:\(\s*([A-Za-z_]\w*(?:\.[A-Za-z_]\w*)?)\s*\))?`)
+
+// 展開に使う名前付きパラメータ名（名前付き引数の SQL の場合）
+const (
+	rawTenantScopeParam = "gw_tenant_scope"
+	rawOrgScopeParam    = "gw_org_scope"
+)
+
+type scopePlaceholder struct {
+	start, end int
+	kind       string // tenant_scope / org_scope
+	target     string // "" / alias / alias.column
+}
+
+// ScopedRaw は Scope の条件をプレースホルダへ展開してから db.Raw を組み立てる。
+//   - :tenant_scope        → tenant_id = ? （複数テナントは IN）
+//   - :tenant_scope(t)     → t.tenant_id = ?
+//   - :org_scope(t)        → t.organization_id IN (?)（OrgIds が空なら 1 = 0）
+//   - :org_scope(o.id)     → o.id IN (?)（organization テーブル自身など、カラムを直接指定）
+//
+// AllTenants や BypassTenantGuard では 1 = 1 に展開する。
+// プレースホルダが無い・スコープ未設定の場合は SQL を実行せず、返り値の Error（Scan 等の結果）でエラーを返す。
+// 文字列リテラル・コメント中のプレースホルダは数えない。
+func ScopedRaw(db *gorm.DB, sql string, values ...interface{}) *gorm.DB {
+	expanded, vars, err := expandScopePlaceholders(db, sql, values)
+	if err != nil {
+		return failedRaw(db, err)
+	}
+	return db.Raw(expanded, vars...)
+}
+
+// ScopedExec は ScopedRaw と同じ展開をしてから db.Exec を実行する。展開できなければ実行しない。
+func ScopedExec(db *gorm.DB, sql string, values ...interface{}) *gorm.DB {
+	expanded, vars, err := expandScopePlaceholders(db, sql, values)
+	if err != nil {
+		return failedRaw(db, err)
+	}
+	return db.Exec(expanded, vars...)
+}
+
+// failedRaw は実行されない（Error 済みの）起点を返す。コールバックは db.Error があると SQL を発行しない。
+func failedRaw(db *gorm.DB, err error) *gorm.DB {
+	tx := db.Session(&gorm.Session{})
+	_ = tx.AddError(err)
+	return tx
+}
+
+func expandScopePlaceholders(db *gorm.DB, rawSQL string, values []interface{}) (string, []interface{}, error) {
+	placeholders := findScopePlaceholders(rawSQL)
+	if len(placeholders) == 0 {
+		return "", nil, ErrUnscopedRawSQL
+	}
+	skip := shouldSkip(db)
+	scope, ok := scopeFrom(db)
+	if !skip && (!ok || scope == nil || (!scope.AllTenants && len(scope.TenantIds) == 0)) {
+		return "", nil, errors.New("tenant scope is required")
+	}
+	unrestricted := skip || scope.AllTenants
+
+	named, namedMap := namedRawValues(values)
+	var b strings.Builder
+	var vars []interface{}
+	if named {
+		vars = append(vars, values...)
+	}
+	last, consumed := 0, 0
+	usedTenant, usedOrg := false, false
+	for _, p := range placeholders {
+		b.WriteString(rawSQL[last:p.start])
+		if !named {
+			// GORM は引用符を区別せず ? を順に置き換えるので、同じ数え方で差し込む位置を決める
+			position := min(consumed+strings.Count(rawSQL[last:p.start], "?"), len(values))
+			vars = append(vars, values[consumed:position]...)
+			consumed = position
+		}
+		last = p.end
+
+		if unrestricted {
+			b.WriteString("1 = 1")
+			continue
+		}
+		var ids []string
+		var param string
+		if p.kind == "tenant_scope" {
+			ids, param, usedTenant = scope.TenantIds, rawTenantScopeParam, true
+		} else {
+			if len(scope.OrgIds) == 0 {
+				b.WriteString("1 = 0")
+				continue
+			}
+			ids, param, usedOrg = scope.OrgIds, rawOrgScopeParam, true
+		}
+		b.WriteString(placeholderColumn(p))
+		switch {
+		case named:
+			b.WriteString(" IN @" + param)
+		case len(ids) == 1:
+			b.WriteString(" = ?")
+			vars = append(vars, ids[0])
+		default:
+			b.WriteString(" IN ?")
+			vars = append(vars, ids)
+		}
+	}
+	b.WriteString(rawSQL[last:])
+	if !named {
+		vars = append(vars, values[consumed:]...)
+		return b.String(), vars, nil
+	}
+
+	scopeParams := map[string]interface{}{}
+	if usedTenant {
+		scopeParams[rawTenantScopeParam] = append([]string(nil), scope.TenantIds...)
+	}
+	if usedOrg {
+		scopeParams[rawOrgScopeParam] = append([]string(nil), scope.OrgIds...)
+	}
+	if namedMap != nil {
+		merged := make(map[string]interface{}, len(namedMap)+len(scopeParams))
+		for k, v := range namedMap {
+			merged[k] = v
+		}
+		for k, v := range scopeParams {
+			merged[k] = v
+		}
+		return b.String(), []interface{}{merged}, nil
+	}
+	for k, v := range scopeParams {
+		vars = append(vars, sql.Named(k, v))
+	}
+	return b.String(), vars, nil
+}
+
+// namedRawValues は GORM が名前付き引数（@name）として扱う values かを返す。map 形式ならその map も返す。
+func namedRawValues(values []interface{}) (bool, map[string]interface{}) {
+	if len(values) == 1 {
+		if m, ok := values[0].(map[string]interface{}); ok {
+			return true, m
+		}
+	}
+	for _, v := range values {
+		if _, ok := v.(sql.NamedArg); ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func placeholderColumn(p scopePlaceholder) string {
+	column := "tenant_id"
+	if p.kind == "org_scope" {
+		column = "organization_id"
+	}
+	switch {
+	case p.target == "":
+		return column
+	case strings.Contains(p.target, "."):
+		return p.target
+	default:
+		return p.target + "." + column
+	}
+}
+
+// findScopePlaceholders は文字列リテラル・引用符付き識別子・コメントの外にあるプレースホルダを返す。
+func findScopePlaceholders(rawSQL string) []scopePlaceholder {
+	var found []scopePlaceholder
+	for i := 0; i < len(rawSQL); i++ {
+		switch c := rawSQL[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = skipQuoted(rawSQL, i, c)
+		case c == '-' && strings.HasPrefix(rawSQL[i:], "--"):
+			if end := strings.IndexByte(rawSQL[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(rawSQL)
+			}
+		case c == '/' && strings.HasPrefix(rawSQL[i:], "/*"):
+			if end := strings.Index(rawSQL[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(rawSQL)
+			}
+		case c == ':':
+			// PostgreSQL のキャスト（::type）や識別子の途中は対象外
+			if i > 0 && (rawSQL[i-1] == ':' || isIdentByte(rawSQL[i-1])) {
+				continue
+			}
+			if m := scopePlaceholderPattern.FindStringSubmatchIndex(rawSQL[i:]); m != nil {
+				p := scopePlaceholder{start: i, end: i + m[1], kind: rawSQL[i+m[2] : i+m[3]]}
+				if m[4] >= 0 {
+					p.target = rawSQL[i+m[4] : i+m[5]]
+				}
+				found = append(found, p)
+				i = p.end - 1
+			}
+		}
+	}
+	return found
+}
+
+// skipQuoted は quote で始まる範囲の終端位置を返す。連続した2つの引用符はエスケープとして扱う。
+func skipQuoted(rawSQL string, start int, quote byte) int {
+	for i := start + 1; i < len(rawSQL); i++ {
+		if rawSQL[i] != quote {
+			continue
+		}
+		if i+1 < len(rawSQL) && rawSQL[i+1] == quote {
+			i++
+			continue
+		}
+		return i
+	}
+	return len(rawSQL)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
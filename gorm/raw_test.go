@@ -0,0 +1,146 @@
+package gw_gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func TestExpandScopePlaceholders(t *testing.T) {
+	db := openTestDB(t)
+	single := ApplyScope(db, singleScope())
+	multi := ApplyScope(db, &Scope{TenantIds: []string{"t1", "t2"}})
+
+	cases := []struct {
+		name   string
+		db     *gorm.DB
+		sql    string
+		values []interface{}
+		want   string
+		vars   []interface{}
+	}{
+		{"single tenant", single, "SELECT * FROM todo WHERE :tenant_scope AND title = ?", []interface{}{"a"},
+			"SELECT * FROM todo WHERE tenant_id = ? AND title = ?", []interface{}{"t1", "a"}},
+		{"alias and org", single, "SELECT * FROM todo t WHERE t.id = ? AND :tenant_scope(t) AND :org_scope(t)", []interface{}{"x"},
+			"SELECT * FROM todo t WHERE t.id = ? AND t.tenant_id = ? AND t.organization_id = ?", []interface{}{"x", "t1", "o1"}},
+		{"explicit column", single, "SELECT * FROM organization o WHERE :org_scope(o.id)", nil,
+			"SELECT * FROM organization o WHERE o.id = ?", []interface{}{"o1"}},
+		{"multi tenant", multi, "UPDATE todo SET title = ? WHERE :tenant_scope", []interface{}{"b"},
+			"UPDATE todo SET title = ? WHERE tenant_id IN ?", []interface{}{"b", []string{"t1", "t2"}}},
+		{"no org ids", multi, "DELETE FROM todo WHERE :org_scope", nil,
+			"DELETE FROM todo WHERE 1 = 0", nil},
+		{"all tenants", ApplyScope(db, &Scope{AllTenants: true}), "SELECT * FROM todo WHERE :tenant_scope", nil,
+			"SELECT * FROM todo WHERE 1 = 1", nil},
+		{"bypass", BypassTenantGuard(db), "SELECT * FROM todo WHERE :tenant_scope AND id = ?", []interface{}{"x"},
+			"SELECT * FROM todo WHERE 1 = 1 AND id = ?", []interface{}{"x"}},
+		{"cast and literal", single, "SELECT id::text, ':tenant_scope' FROM todo WHERE :tenant_scope", nil,
+			"SELECT id::text, ':tenant_scope' FROM todo WHERE tenant_id = ?", []interface{}{"t1"}},
+	}
+	for _, c := range cases {
+		got, vars, err := expandScopePlaceholders(c.db, c.sql, c.values)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got != c.want || !reflect.DeepEqual(vars, c.vars) {
+			t.Fatalf("%s:\n got=%q %#v\nwant=%q %#v", c.name, got, vars, c.want, c.vars)
+		}
+	}
+}
+
+func TestExpandScopePlaceholdersNamedArgs(t *testing.T) {
+	db := ApplyScope(openTestDB(t), singleScope())
+
+	got, vars, err := expandScopePlaceholders(db, "SELECT * FROM todo WHERE :tenant_scope AND title = @title", []interface{}{sql.Named("title", "a")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []interface{}{sql.Named("title", "a"), sql.Named(rawTenantScopeParam, []string{"t1"})}
+	if got != "SELECT * FROM todo WHERE tenant_id IN @gw_tenant_scope AND title = @title" || !reflect.DeepEqual(vars, want) {
+		t.Fatalf("got=%q vars=%#v", got, vars)
+	}
+
+	params := map[string]interface{}{"title": "a"}
+	_, vars, err = expandScopePlaceholders(db, "SELECT * FROM todo WHERE :org_scope AND title = @title", []interface{}{params})
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := vars[0].(map[string]interface{})
+	if len(vars) != 1 || !reflect.DeepEqual(merged[rawOrgScopeParam], []string{"o1"}) || merged["title"] != "a" {
+		t.Fatalf("vars=%#v", vars)
+	}
+	if len(params) != 1 {
+		t.Fatal("caller map must not be modified")
+	}
+}
+
+func TestScopedRawFailsClosed(t *testing.T) {
+	db := openTestDB(t)
+	scoped := ApplyScope(db, singleScope())
+
+	cases := []struct {
+		name string
+		db   *gorm.DB
+		sql  string
+		want error
+	}{
+		{"no placeholder", scoped, "SELECT * FROM todo WHERE id = ?", ErrUnscopedRawSQL},
+		{"placeholder in comment", scoped, "SELECT * FROM todo -- :tenant_scope\nWHERE id = ?", ErrUnscopedRawSQL},
+		{"placeholder in block comment", scoped, "SELECT * FROM todo /* :tenant_scope */ WHERE id = ?", ErrUnscopedRawSQL},
+		{"placeholder in literal", scoped, "SELECT * FROM todo WHERE title = 'it''s :tenant_scope'", ErrUnscopedRawSQL},
+		{"similar name", scoped, "SELECT * FROM todo WHERE :tenant_scoped", ErrUnscopedRawSQL},
+	}
+	for _, c := range cases {
+		var rows []map[string]interface{}
+		if err := ScopedRaw(c.db, c.sql, "x").Scan(&rows).Error; !errors.Is(err, c.want) {
+			t.Fatalf("%s: err=%v", c.name, err)
+		}
+		if err := ScopedExec(c.db, c.sql, "x").Error; !errors.Is(err, c.want) {
+			t.Fatalf("%s: exec err=%v", c.name, err)
+		}
+	}
+
+	if err := ScopedExec(db, "DELETE FROM todo WHERE :tenant_scope").Error; err == nil || !strings.Contains(err.Error(), "tenant scope is required") {
+		t.Fatalf("missing scope must be rejected, got %v", err)
+	}
+}
+
+func TestScopedRawAndExecOnSQLite(t *testing.T) {
+	db := openTransactionTestDB(t)
+	if err := db.Exec(
+		"INSERT INTO guarded_todos (id, tenant_id, organization_id, title) VALUES ('a', 't1', 'o1', 'mine'), ('b', 't2', 'o2', 'other'), ('c', 't1', 'o9', 'hidden org')").Error; err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithScopeContext(context.Background(), singleScope())
+	scoped := db.WithContext(ctx)
+
+	var ids []string
+	if err := ScopedRaw(scoped, "SELECT g.id FROM guarded_todos g WHERE :tenant_scope(g) AND :org_scope(g) AND g.title <> ? ORDER BY g.id", "x").Scan(&ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Fatalf("ids=%v", ids)
+	}
+
+	result := ScopedExec(scoped, "UPDATE guarded_todos SET title = ? WHERE :tenant_scope", "renamed")
+	if result.Error != nil || result.RowsAffected != 2 {
+		t.Fatalf("err=%v rows=%d", result.Error, result.RowsAffected)
+	}
+	var other string
+	if err := db.Raw("SELECT title FROM guarded_todos WHERE id = 'b'").Scan(&other).Error; err != nil || other != "other" {
+		t.Fatalf("other tenant must be untouched: %q %v", other, err)
+	}
+
+	// 失敗した ScopedExec は SQL を発行しない
+	if err := ScopedExec(scoped, "DELETE FROM guarded_todos").Error; !errors.Is(err, ErrUnscopedRawSQL) {
+		t.Fatalf("err=%v", err)
+	}
+	var count int64
+	if err := db.Raw("SELECT COUNT(*) FROM guarded_todos").Scan(&count).Error; err != nil || count != 3 {
+		t.Fatalf("count=%d err=%v", count, err)
+	}
+}
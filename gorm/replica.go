@@ -0,0 +1,339 @@
+package gw_gorm
+
+// このファイルは読み取りをリードレプリカへ振り分ける ReplicaResolver と、接続プールの設定（PoolConfig）を置く。
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// PoolConfig は database/sql の接続プールの設定。0 の項目は database/sql の既定値のまま。
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// DefaultPoolConfig は Web アプリ向けの接続プールの設定を返す。
+// 接続数に上限を付け、ロードバランサやフェイルオーバーで切れた接続を使い続けないよう寿命を付ける。
+func DefaultPoolConfig() PoolConfig {
+	return PoolConfig{
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
+	}
+}
+
+// Apply は sqlDB に設定を反映する。
+func (c PoolConfig) Apply(sqlDB *sql.DB) {
+	if c.MaxOpenConns > 0 {
+		sqlDB.SetMaxOpenConns(c.MaxOpenConns)
+	}
+	if c.MaxIdleConns > 0 {
+		sqlDB.SetMaxIdleConns(c.MaxIdleConns)
+	}
+	if c.ConnMaxLifetime > 0 {
+		sqlDB.SetConnMaxLifetime(c.ConnMaxLifetime)
+	}
+	if c.ConnMaxIdleTime > 0 {
+		sqlDB.SetConnMaxIdleTime(c.ConnMaxIdleTime)
+	}
+}
+
+// ConfigurePool は db（プライマリ）の接続プールに設定を反映する。
+func ConfigurePool(db *gorm.DB, pool PoolConfig) error {
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	pool.Apply(sqlDB)
+	return nil
+}
+
+// PrimaryOnlyModel はレプリカへ振り分けないモデルのマーカー。
+// 書き込み直後に読み直す設定・残高など、レプリカの遅延を許容できないモデルに `func (Wallet) PrimaryOnly() {}` を書く。
+type PrimaryOnlyModel interface{ PrimaryOnly() }
+
+// ReplicaOptions は UseReadReplicas の設定。
+type ReplicaOptions struct {
+	// Pool はレプリカの接続プールの設定。0 値なら DefaultPoolConfig
+	Pool PoolConfig
+	// HealthCheckInterval はレプリカの死活確認の間隔（10秒）。負の値で無効（常に正常とみなす）
+	HealthCheckInterval time.Duration
+	// HealthCheckTimeout は1回の確認のタイムアウト（2秒）
+	HealthCheckTimeout time.Duration
+}
+
+// ReplicaResolver は読み取りをレプリカへ、書き込み・トランザクションをプライマリへ振り分ける。
+type ReplicaResolver struct {
+	primary  gorm.ConnPool
+	replicas []*replica
+	next     atomic.Uint64
+	timeout  time.Duration
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+type replica struct {
+	name    string
+	pool    gorm.ConnPool
+	sqlDB   *sql.DB
+	healthy atomic.Bool
+}
+
+const (
+	replicaRouteKey  = "gw_gorm:replica_route"
+	routeToPrimary   = "primary"
+	routeToReplica   = "replica"
+	replicaQueryName = "gw_gorm:replica_query"
+)
+
+type replicaSessionKey struct{}
+
+// replicaSession はリクエスト内で書き込みがあったかを記録する（書き込み後の読み取りをプライマリへ固定する）。
+type replicaSession struct {
+	wrote atomic.Bool
+}
+
+// UseReadReplicas は db の読み取り（Find / First / Count / Row / Raw の SELECT）をレプリカへ振り分けるコールバックを登録する。
+//   - 書き込み（Exec を含む）・トランザクション内の読み取り・FOR UPDATE 付きの読み取り・SELECT 以外の Raw はプライマリ
+//   - WithReplicaSession の context では、書き込みの後の読み取りをプライマリに固定する（自分の書き込みが読める）
+//   - PrimaryOnlyModel のモデル、UsePrimary を付けた呼び出しはプライマリ。UseReplica はセッションの固定を無視してレプリカを使う
+//   - 死活確認に失敗したレプリカは外し、復旧したら戻す。正常なレプリカが無ければプライマリで読む
+//
+// 振り分けは接続を差し替えるだけなので、Tenant Guard などの他のコールバックはそのまま効く。
+// db 自身の接続プールは ConfigurePool で設定する。終了時は Close でレプリカの接続を閉じる。
+func UseReadReplicas(db *gorm.DB, dialectors []gorm.Dialector, opts *ReplicaOptions) (*ReplicaResolver, error) {
+	if db.Callback().Query().Get(replicaQueryName) != nil {
+		return nil, errors.New("read replicas are already registered")
+	}
+	if opts == nil {
+		opts = &ReplicaOptions{}
+	}
+	pool := opts.Pool
+	if pool == (PoolConfig{}) {
+		pool = DefaultPoolConfig()
+	}
+	r := &ReplicaResolver{
+		primary: db.ConnPool,
+		timeout: opts.HealthCheckTimeout,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if r.timeout <= 0 {
+		r.timeout = 2 * time.Second
+	}
+	for i, dialector := range dialectors {
+		// 接続プールを得るためだけに開く（SQL の実行・ログは元の db のセッションで行う）
+		replicaDB, err := gorm.Open(dialector, &gorm.Config{Logger: logger.Discard, SkipDefaultTransaction: true})
+		if err != nil {
+			r.closeReplicas()
+			return nil, fmt.Errorf("open replica %d: %w", i, err)
+		}
+		sqlDB, err := replicaDB.DB()
+		if err != nil {
+			r.closeReplicas()
+			return nil, fmt.Errorf("open replica %d: %w", i, err)
+		}
+		pool.Apply(sqlDB)
+		rep := &replica{name: fmt.Sprintf("replica-%d", i), pool: replicaDB.ConnPool, sqlDB: sqlDB}
+		rep.healthy.Store(true)
+		r.replicas = append(r.replicas, rep)
+	}
+
+	callbacks := db.Callback()
+	if err := callbacks.Query().Before("gorm:query").Register(replicaQueryName, r.routeRead); err != nil {
+		r.closeReplicas()
+		return nil, err
+	}
+	if err := callbacks.Row().Before("gorm:row").Register("gw_gorm:replica_row", r.routeRead); err != nil {
+		r.closeReplicas()
+		return nil, err
+	}
+	if err := callbacks.Create().After("gorm:create").Register("gw_gorm:replica_sticky_create", markWritten); err != nil {
+		r.closeReplicas()
+		return nil, err
+	}
+	if err := callbacks.Update().After("gorm:update").Register("gw_gorm:replica_sticky_update", markWritten); err != nil {
+		r.closeReplicas()
+		return nil, err
+	}
+	if err := callbacks.Delete().After("gorm:delete").Register("gw_gorm:replica_sticky_delete", markWritten); err != nil {
+		r.closeReplicas()
+		return nil, err
+	}
+	if err := callbacks.Raw().After("gorm:raw").Register("gw_gorm:replica_sticky_raw", markWritten); err != nil {
+		r.closeReplicas()
+		return nil, err
+	}
+
+	if opts.HealthCheckInterval >= 0 && len(r.replicas) > 0 {
+		interval := opts.HealthCheckInterval
+		if interval == 0 {
+			interval = 10 * time.Second
+		}
+		r.CheckHealth(context.Background())
+		go r.healthLoop(interval)
+	} else {
+		close(r.done)
+	}
+	return r, nil
+}
+
+// WithReplicaSession は書き込み後の読み取りをプライマリに固定するセッションを ctx に作る。
+// リクエストの開始時（ミドルウェア）に呼ぶ。セッションの無い context では固定しない。
+func WithReplicaSession(ctx context.Context) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, replicaSessionKey{}, &replicaSession{})
+}
+
+// UsePrimary はこの呼び出しの読み取りをプライマリで行う。
+func UsePrimary(db *gorm.DB) *gorm.DB {
+	return db.Set(replicaRouteKey, routeToPrimary).Session(&gorm.Session{})
+}
+
+// UseReplica はこの呼び出しの読み取りを、セッションの固定・PrimaryOnlyModel に関わらずレプリカで行う（トランザクション内を除く）。
+// 集計・レポートなど遅延を許容できる重い読み取り用。
+func UseReplica(db *gorm.DB) *gorm.DB {
+	return db.Set(replicaRouteKey, routeToReplica).Session(&gorm.Session{})
+}
+
+// HealthyReplicas は振り分け対象になっているレプリカの数を返す。
+func (r *ReplicaResolver) HealthyReplicas() int {
+	count := 0
+	for _, rep := range r.replicas {
+		if rep.healthy.Load() {
+			count++
+		}
+	}
+	return count
+}
+
+// CheckHealth はすべてのレプリカに ping し、応答の無いものを振り分けから外す（復旧したものは戻す）。
+func (r *ReplicaResolver) CheckHealth(ctx context.Context) {
+	for _, rep := range r.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, r.timeout)
+		err := rep.sqlDB.PingContext(pingCtx)
+		cancel()
+		healthy := err == nil
+		if rep.healthy.Swap(healthy) != healthy {
+			if healthy {
+				slog.InfoContext(ctx, "replica recovered", slog.String("replica", rep.name))
+			} else {
+				slog.WarnContext(ctx, "replica ejected", slog.String("replica", rep.name), slog.String("error", err.Error()))
+			}
+		}
+	}
+}
+
+// Close は死活確認を止め、レプリカの接続を閉じる。
+func (r *ReplicaResolver) Close() error {
+	r.stopOnce.Do(func() { close(r.stop) })
+	<-r.done
+	// 閉じた後の読み取りはプライマリへ回す
+	for _, rep := range r.replicas {
+		rep.healthy.Store(false)
+	}
+	return r.closeReplicas()
+}
+
+func (r *ReplicaResolver) closeReplicas() error {
+	var errs []error
+	for _, rep := range r.replicas {
+		errs = append(errs, rep.sqlDB.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (r *ReplicaResolver) healthLoop(interval time.Duration) {
+	defer close(r.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.CheckHealth(context.Background())
+		}
+	}
+}
+
+func (r *ReplicaResolver) routeRead(db *gorm.DB) {
+	stmt := db.Statement
+	// トランザクション・明示的に渡された接続はそのまま使う
+	if db.Error != nil || stmt.ConnPool != r.primary {
+		return
+	}
+	if !r.readsFromReplica(db) {
+		return
+	}
+	if rep := r.pick(); rep != nil {
+		stmt.ConnPool = rep.pool
+	}
+}
+
+func (r *ReplicaResolver) readsFromReplica(db *gorm.DB) bool {
+	stmt := db.Statement
+	if _, locking := stmt.Clauses["FOR"]; locking {
+		return false
+	}
+	if stmt.SQL.Len() > 0 && !isSelectSQL(stmt.SQL.String()) {
+		return false
+	}
+	route, _ := db.Get(replicaRouteKey)
+	switch route {
+	case routeToPrimary:
+		return false
+	case routeToReplica:
+		return true
+	}
+	if implements[PrimaryOnlyModel](stmt.Schema) {
+		return false
+	}
+	if session, ok := contextFromDB(db).Value(replicaSessionKey{}).(*replicaSession); ok && session.wrote.Load() {
+		return false
+	}
+	return true
+}
+
+// pick は正常なレプリカをラウンドロビンで選ぶ。
+func (r *ReplicaResolver) pick() *replica {
+	n := len(r.replicas)
+	start := int(r.next.Add(1) % uint64(max(n, 1)))
+	for i := 0; i < n; i++ {
+		if rep := r.replicas[(start+i)%n]; rep.healthy.Load() {
+			return rep
+		}
+	}
+	return nil
+}
+
+func markWritten(db *gorm.DB) {
+	if db.Error != nil {
+		return
+	}
+	if session, ok := contextFromDB(db).Value(replicaSessionKey{}).(*replicaSession); ok {
+		session.wrote.Store(true)
+	}
+}
+
+func isSelectSQL(sql string) bool {
+	sql = strings.ToUpper(strings.TrimSpace(sql))
+	return strings.HasPrefix(sql, "SELECT") && !strings.Contains(sql, " FOR UPDATE") && !strings.Contains(sql, " FOR SHARE")
+}
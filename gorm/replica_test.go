@@ -0,0 +1,163 @@
+package gw_gorm
+
+import (
+	"context"
+	"testing"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+type replicaSetting struct {
+	Id    string
+	Value string
+}
+
+func (replicaSetting) PrimaryOnly() {}
+
+// openReplicaTestDBs はプライマリとレプリカを別々の SQLite で用意し、どちらから読んだかを title で見分けられるようにする。
+func openReplicaTestDBs(t *testing.T) (*gorm.DB, *ReplicaResolver) {
+	t.Helper()
+	primary := openTransactionTestDB(t)
+	replicaDSN := "file:" + t.Name() + "_replica?mode=memory&cache=shared"
+	replicaDB, err := gorm.Open(sqlite.Open(replicaDSN), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, db := range map[string]*gorm.DB{"primary": primary, "replica": replicaDB} {
+		if err := db.AutoMigrate(&guardedTodo{}, &replicaSetting{}); err != nil {
+			t.Fatal(err)
+		}
+		err := db.Session(&gorm.Session{SkipHooks: true}).Exec(
+			"INSERT INTO guarded_todos (id, tenant_id, organization_id, title) VALUES ('a', 't1', 'o1', ?), ('b', 't2', 'o2', 'other')", name).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Create(&replicaSetting{Id: "s", Value: name}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resolver, err := UseReadReplicas(primary, []gorm.Dialector{sqlite.Open(replicaDSN)}, &ReplicaOptions{HealthCheckInterval: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		resolver.Close()
+		// レプリカの共有メモリDBはテストの間だけ保持する
+		if sqlDB, err := replicaDB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return primary, resolver
+}
+
+func readTitles(t *testing.T, db *gorm.DB) string {
+	t.Helper()
+	var todos []guardedTodo
+	if err := db.Order("id").Find(&todos).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(todos) != 1 {
+		t.Fatalf("tenant guard must apply on every route: %+v", todos)
+	}
+	return todos[0].Title
+}
+
+func TestReadReplicaRouting(t *testing.T) {
+	db, _ := openReplicaTestDBs(t)
+	ctx := WithScopeContext(context.Background(), singleScope())
+	scoped := db.WithContext(ctx)
+
+	if got := readTitles(t, scoped); got != "replica" {
+		t.Fatalf("reads must go to the replica: %s", got)
+	}
+	if got := readTitles(t, UsePrimary(scoped)); got != "primary" {
+		t.Fatalf("UsePrimary: %s", got)
+	}
+	if got := readTitles(t, scoped.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})); got != "primary" {
+		t.Fatalf("locking reads must go to the primary: %s", got)
+	}
+	var setting replicaSetting
+	scoped.First(&setting)
+	if setting.Value != "primary" {
+		t.Fatalf("PrimaryOnlyModel must be read from the primary: %s", setting.Value)
+	}
+	UseReplica(scoped).First(&setting)
+	if setting.Value != "replica" {
+		t.Fatalf("UseReplica must override PrimaryOnlyModel: %s", setting.Value)
+	}
+
+	var title string
+	if err := scoped.Raw("SELECT title FROM guarded_todos WHERE id = ?", "a").Row().Scan(&title); err != nil || title != "replica" {
+		t.Fatalf("raw select: %s %v", title, err)
+	}
+	if err := scoped.Transaction(func(tx *gorm.DB) error {
+		if got := readTitles(t, tx); got != "primary" {
+			t.Errorf("reads in a transaction must go to the primary: %s", got)
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadReplicaStickyAfterWrite(t *testing.T) {
+	db, _ := openReplicaTestDBs(t)
+	ctx := WithScopeContext(context.Background(), singleScope())
+
+	// セッションの無い context では書き込み後もレプリカ
+	if err := db.WithContext(ctx).Create(&guardedTodo{Id: "c", OrganizationId: "o1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := readTitles(t, db.WithContext(ctx).Where("id = ?", "a")); got != "replica" {
+		t.Fatalf("no session: %s", got)
+	}
+
+	session := WithReplicaSession(ctx)
+	if got := readTitles(t, db.WithContext(session).Where("id = ?", "a")); got != "replica" {
+		t.Fatalf("before write: %s", got)
+	}
+	if err := db.WithContext(session).Model(&guardedTodo{}).Where("id = ?", "c").Update("title", "updated").Error; err != nil {
+		t.Fatal(err)
+	}
+	if got := readTitles(t, db.WithContext(session).Where("id = ?", "a")); got != "primary" {
+		t.Fatalf("reads after a write must stick to the primary: %s", got)
+	}
+	if got := readTitles(t, UseReplica(db.WithContext(session)).Where("id = ?", "a")); got != "replica" {
+		t.Fatalf("UseReplica must override the sticky session: %s", got)
+	}
+}
+
+func TestReadReplicaEjection(t *testing.T) {
+	db, resolver := openReplicaTestDBs(t)
+	ctx := WithScopeContext(context.Background(), singleScope())
+	if resolver.HealthyReplicas() != 1 {
+		t.Fatal("replica must start healthy")
+	}
+	resolver.replicas[0].sqlDB.Close()
+	resolver.CheckHealth(context.Background())
+	if resolver.HealthyReplicas() != 0 {
+		t.Fatal("unreachable replica must be ejected")
+	}
+	if got := readTitles(t, db.WithContext(ctx)); got != "primary" {
+		t.Fatalf("reads must fall back to the primary: %s", got)
+	}
+
+	if _, err := UseReadReplicas(db, nil, nil); err == nil {
+		t.Fatal("registering twice must fail")
+	}
+}
+
+func TestConfigurePool(t *testing.T) {
+	db := openTransactionTestDB(t)
+	if err := ConfigurePool(db, DefaultPoolConfig()); err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	if got := sqlDB.Stats().MaxOpenConnections; got != 25 {
+		t.Fatalf("MaxOpenConnections=%d", got)
+	}
+}
@@ -0,0 +1,200 @@
+package gw_gorm
+
+// このファイルは主キーで扱う1モデルの基本操作をまとめた Repository[T] と、その GORM 実装を置く。
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotFound は Repository の Get / Update / Delete で対象の行が（Scope の中に）無いことを表す。
+// Repository が返すエラーには gw_errors.NotFound のコードが付く。
+//
+//	if gw_errors.HasCode(err, gw_errors.NotFound) { ... } // または errors.Is(err, gw_gorm.ErrNotFound)
+var ErrNotFound = errors.New("record not found")
+
+// Repository は T を主キーで扱う基本操作。サービス層はこのインターフェースに依存し、
+// テストでは gw_gormtest.MockRepository などに差し替える。
+type Repository[T any] interface {
+	// Get は主キーが id の行を返す。無ければ ErrNotFound
+	Get(ctx context.Context, id any) (*T, error)
+	// List は filter の条件で page のページを返す（page.Sort が空なら filter.Sort の順）
+	List(ctx context.Context, filter *QueryFilter, page gw_pagination.PageRequest) (*gw_pagination.Page[T], error)
+	Create(ctx context.Context, ent *T) error
+	// Update は主キーが id の行の fields（カラム名またはフィールド名 → 値）だけを更新する。無ければ ErrNotFound
+	Update(ctx context.Context, id any, fields map[string]any) error
+	// Delete は主キーが id の行を削除する（論理削除のモデルは論理削除）。無ければ ErrNotFound
+	Delete(ctx context.Context, id any) error
+	Exists(ctx context.Context, id any) (bool, error)
+	Count(ctx context.Context, filter *QueryFilter) (int64, error)
+	// Upsert は ents を挿入し、conflictColumns（空なら主キー）が重複する行は更新する
+	Upsert(ctx context.Context, ents []*T, conflictColumns ...string) error
+}
+
+// GormRepository は Repository の GORM 実装。
+// どの操作も ctx の Scope で ApplyScope してから実行するため、BypassTenantGuard した db を渡しても Tenant Guard が効く。
+// ctx に WithDB で db（トランザクションなど）が載っていればそれを使う。
+//
+//	todos := gw_gorm.NewRepository[Todo](db)
+//	todo, err := todos.Get(ctx, id)
+//	err = gw_gorm.WithTx(ctx, db, nil, func(tx *gorm.DB) error {
+//	    return todos.Update(gw_gorm.WithDB(ctx, tx), id, map[string]any{"title": title})
+//	})
+type GormRepository[T any] struct {
+	db *gorm.DB
+}
+
+var _ Repository[struct{ Id string }] = (*GormRepository[struct{ Id string }])(nil)
+
+// NewRepository は db を使う T の GormRepository を返す。
+func NewRepository[T any](db *gorm.DB) *GormRepository[T] {
+	return &GormRepository[T]{db: db}
+}
+
+// session は ctx の db（無ければ r.db）に ctx の Scope を適用した起点を返す。
+func (r *GormRepository[T]) session(ctx context.Context) *gorm.DB {
+	db, err := DBFromContext(ctx)
+	if err != nil {
+		db = r.db.WithContext(ctx)
+	}
+	scope, _ := scopeFromContext(ctx)
+	return ApplyScope(db, scope)
+}
+
+func (r *GormRepository[T]) schema() (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: r.db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+	if stmt.Schema.PrioritizedPrimaryField == nil || len(stmt.Schema.PrimaryFields) != 1 {
+		return nil, fmt.Errorf("repository requires %s to have a single primary key", stmt.Schema.Name)
+	}
+	return stmt.Schema, nil
+}
+
+func (r *GormRepository[T]) byId(db *gorm.DB, s *schema.Schema, id any) *gorm.DB {
+	return db.Model(new(T)).Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: s.PrioritizedPrimaryField.DBName}, Value: id})
+}
+
+func (r *GormRepository[T]) notFound(s *schema.Schema, id any) error {
+	return gw_errors.WithCode(fmt.Errorf("%s %v: %w", s.Table, id, ErrNotFound), gw_errors.NotFound)
+}
+
+func (r *GormRepository[T]) Get(ctx context.Context, id any) (*T, error) {
+	s, err := r.schema()
+	if err != nil {
+		return nil, err
+	}
+	ent, err := FindOne[T](r.byId(r.session(ctx), s, id))
+	if err != nil {
+		return nil, err
+	}
+	if ent == nil {
+		return nil, r.notFound(s, id)
+	}
+	return ent, nil
+}
+
+func (r *GormRepository[T]) List(ctx context.Context, filter *QueryFilter, page gw_pagination.PageRequest) (*gw_pagination.Page[T], error) {
+	if len(page.Sort) == 0 && filter != nil {
+		page.Sort = filter.Sort
+	}
+	return Paginate[T](filter.Where(r.session(ctx)), page)
+}
+
+func (r *GormRepository[T]) Create(ctx context.Context, ent *T) error {
+	return r.session(ctx).Create(ent).Error
+}
+
+func (r *GormRepository[T]) Update(ctx context.Context, id any, fields map[string]any) error {
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return errors.New("update requires at least one field")
+	}
+	updates := make(map[string]any, len(fields))
+	for name, value := range fields {
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return fmt.Errorf("unknown field %q", name)
+		}
+		if field.PrimaryKey {
+			return fmt.Errorf("primary key %q cannot be updated", name)
+		}
+		updates[field.DBName] = value
+	}
+	db := r.session(ctx)
+	result := r.byId(db, s, id).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// MySQL は値が変わらなかった行を数えないため、存在を確かめてから NotFound にする
+		exists, err := r.exists(db, s, id)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return r.notFound(s, id)
+		}
+	}
+	return nil
+}
+
+func (r *GormRepository[T]) Delete(ctx context.Context, id any) error {
+	s, err := r.schema()
+	if err != nil {
+		return err
+	}
+	result := r.byId(r.session(ctx), s, id).Delete(new(T))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return r.notFound(s, id)
+	}
+	return nil
+}
+
+func (r *GormRepository[T]) Exists(ctx context.Context, id any) (bool, error) {
+	s, err := r.schema()
+	if err != nil {
+		return false, err
+	}
+	return r.exists(r.session(ctx), s, id)
+}
+
+func (r *GormRepository[T]) exists(db *gorm.DB, s *schema.Schema, id any) (bool, error) {
+	var count int64
+	if err := r.byId(db, s, id).Limit(1).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *GormRepository[T]) Count(ctx context.Context, filter *QueryFilter) (int64, error) {
+	var count int64
+	err := filter.Where(r.session(ctx).Model(new(T))).Count(&count).Error
+	return count, err
+}
+
+// Upsert は BulkUpsert で ents をチャンクに分けて挿入し、conflictColumns が重複する行は更新する
+// （tenant_id / organization_id / created_by / version は更新しない。更新の範囲と MySQL での扱いは BulkUpsert を参照）。
+// conflictColumns にはそれらのカラムの一意インデックスが必要（PostgreSQL / SQLite）。
+// TenantScopedModel は tenant_id、OrgScopedModel は organization_id を conflictColumns に含める必要がある。
+func (r *GormRepository[T]) Upsert(ctx context.Context, ents []*T, conflictColumns ...string) error {
+	if len(ents) == 0 {
+		return nil
+	}
+	_, err := BulkUpsert(r.session(ctx), ents, &BulkOptions{ConflictColumns: conflictColumns})
+	return err
+}
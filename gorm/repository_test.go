@@ -0,0 +1,123 @@
+package gw_gorm
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"gorm.io/gorm"
+)
+
+type catalogItem struct {
+	Id       string
+	TenantId string `gorm:"uniqueIndex:ux_catalog_item_code"`
+	Code     string `gorm:"uniqueIndex:ux_catalog_item_code"`
+	Price    int
+}
+
+func (catalogItem) TenantScoped() {}
+
+func assertNotFound(t *testing.T, err error) {
+	t.Helper()
+	if !gw_errors.HasCode(err, gw_errors.NotFound) || !errors.Is(err, ErrNotFound) {
+		t.Fatalf("must be NotFound: %v", err)
+	}
+}
+
+func TestRepositoryRespectsScope(t *testing.T) {
+	db, ctx := migrateAndSeed(t, &guardedTodo{}, []guardedTodo{
+		{Id: "a", TenantId: "t1", OrganizationId: "o1", Title: "x"},
+		{Id: "b", TenantId: "t1", OrganizationId: "o1", Title: "y"},
+		{Id: "c", TenantId: "t1", OrganizationId: "o1", Title: "x"},
+		{Id: "z", TenantId: "t2", OrganizationId: "o2", Title: "x"},
+	})
+	// BypassTenantGuard した db を渡しても ApplyScope で Guard が戻る
+	var repo Repository[guardedTodo] = NewRepository[guardedTodo](BypassTenantGuard(db))
+
+	todo, err := repo.Get(ctx, "a")
+	if err != nil || todo.Title != "x" {
+		t.Fatalf("todo=%+v err=%v", todo, err)
+	}
+	_, err = repo.Get(ctx, "z")
+	assertNotFound(t, err)
+	if _, err := repo.Get(context.Background(), "a"); err == nil || gw_errors.HasCode(err, gw_errors.NotFound) {
+		t.Fatalf("missing scope must be rejected, not reported as not found: %v", err)
+	}
+	if exists, err := repo.Exists(ctx, "z"); err != nil || exists {
+		t.Fatalf("exists=%v err=%v", exists, err)
+	}
+
+	gw_pagination.SetCursorKey([]byte("test-cursor-key"))
+	filter := &QueryFilter{Conditions: []FilterCondition{{Column: "title", Op: FilterEq, Values: []any{"x"}}}}
+	if count, err := repo.Count(ctx, filter); err != nil || count != 2 {
+		t.Fatalf("count=%d err=%v", count, err)
+	}
+	page, err := repo.List(ctx, filter, gw_pagination.PageRequest{Limit: 1, Sort: []gw_pagination.SortField{{Column: "id", Desc: true}}})
+	if err != nil || len(page.Items) != 1 || page.Items[0].Id != "c" || page.NextCursor == "" {
+		t.Fatalf("page=%+v err=%v", page, err)
+	}
+
+	if err := repo.Update(ctx, "a", map[string]any{"Title": "renamed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Update(ctx, "a", map[string]any{"title": "renamed"}); err != nil {
+		t.Fatalf("unchanged values must not be reported as not found: %v", err)
+	}
+	assertNotFound(t, repo.Update(ctx, "z", map[string]any{"title": "stolen"}))
+	if err := repo.Update(ctx, "a", map[string]any{"nope": 1}); err == nil {
+		t.Fatal("unknown fields must be rejected")
+	}
+	if err := repo.Update(ctx, "a", map[string]any{"id": "a2"}); err == nil {
+		t.Fatal("primary key must not be updated")
+	}
+
+	assertNotFound(t, repo.Delete(ctx, "z"))
+	if err := repo.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	assertNotFound(t, repo.Delete(ctx, "a"))
+
+	// ctx に載せたトランザクションを使う
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := repo.Create(WithDB(ctx, tx), &guardedTodo{Id: "d", OrganizationId: "o1", Title: "new"}); err != nil {
+			return err
+		}
+		return errors.New("rollback")
+	})
+	if err == nil || err.Error() != "rollback" {
+		t.Fatal(err)
+	}
+	if exists, _ := repo.Exists(ctx, "d"); exists {
+		t.Fatal("create must run in the transaction from the context")
+	}
+}
+
+func TestRepositoryUpsert(t *testing.T) {
+	db, ctx := migrateAndSeed(t, &catalogItem{}, []catalogItem{{Id: "other", TenantId: "t2", Code: "A", Price: 1}})
+	repo := NewRepository[catalogItem](db)
+
+	items := []*catalogItem{{Id: "i1", Code: "A", Price: 100}, {Id: "i2", Code: "B", Price: 200}}
+	if err := repo.Upsert(ctx, items, "tenant_id", "Code"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Upsert(ctx, []*catalogItem{{Id: "i3", Code: "A", Price: 150}}, "tenant_id", "code"); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := repo.Count(ctx, nil); count != 2 {
+		t.Fatalf("conflicting row must be updated, count=%d", count)
+	}
+	var prices []int
+	BypassTenantGuard(db).Model(&catalogItem{}).Order("tenant_id, code").Pluck("price", &prices)
+	if len(prices) != 3 || prices[0] != 150 || prices[1] != 200 || prices[2] != 1 {
+		t.Fatalf("other tenants must be untouched: %v", prices)
+	}
+
+	if err := repo.Upsert(ctx, items); err == nil {
+		t.Fatal("conflict target without tenant_id must be rejected")
+	}
+	if err := repo.Upsert(ctx, items, "tenant_id", "nope"); err == nil {
+		t.Fatal("unknown conflict column must be rejected")
+	}
+}
@@ -0,0 +1,191 @@
+package gw_gorm
+
+// このファイルは Tenant Guard の多層防御として、PostgreSQL の Row-Level Security（RLS）を扱う。
+//   - RLSPolicySQL: マーカーインターフェースから ENABLE ROW LEVEL SECURITY とポリシーの DDL を生成する
+//   - UseRLSSession: トランザクション内の各 SQL の前に Scope をセッション変数（set_config(..., true)）へ反映する
+//   - BypassRLS: RLS のポリシーを明示的に外す（BypassTenantGuard だけでは外れない）
+//
+// アプリのガードをすり抜けた SQL（Raw の書き忘れ・ガードの不具合）も DB 側で他テナントの行を返さない。
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// RLS ポリシーが参照するセッション変数名。
+const (
+	RLSSettingTenantIds  = "gw.tenant_ids"  // 参照可能テナント（カンマ区切り）
+	RLSSettingOrgIds     = "gw.org_ids"     // 参照可能 organization（カンマ区切り）
+	RLSSettingAllTenants = "gw.all_tenants" // "on" なら全テナント（AllTenants / BypassRLS）
+)
+
+// ErrRLSRequiresTransaction は UseRLSSession を登録した DB で、RLS 対象のモデルへトランザクション外でアクセスしたことを表す。
+// トランザクション外ではセッション変数を設定できず、RLS により行が見えない・書けないため、黙って空の結果にせずエラーにする。
+var ErrRLSRequiresTransaction = errors.New("row-level security requires a transaction to access a scoped model")
+
+const rlsBypassKey = "gw_gorm:rls_bypass"
+
+// RLSPolicyName は RLSPolicySQL が作成するポリシー名。
+const RLSPolicyName = "gw_tenant_guard"
+
+const rlsSetConfigSQL = "SELECT set_config('" + RLSSettingTenantIds + "', $1, true), set_config('" +
+	RLSSettingOrgIds + "', $2, true), set_config('" + RLSSettingAllTenants + "', $3, true)"
+
+// RLSPolicySQL は models のうちマーカーを実装するモデルのテーブルに RLS を有効化する DDL を返す（PostgreSQL 用）。
+// テーブル名は db の NamingStrategy / TableName() で解決する。マーカーの無いモデルは無視する。
+//
+// 条件は Tenant Guard と同じで、セッション変数が未設定なら何も見えない（fail-closed）。
+// テーブル所有者にも適用するため FORCE ROW LEVEL SECURITY も付ける。マイグレーションで実行する想定で、
+// 何度実行しても同じ状態になる（ポリシーは DROP してから作り直す）。
+func RLSPolicySQL(db *gorm.DB, models ...any) ([]string, error) {
+	var statements []string
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		s := stmt.Schema
+		tenantScoped, orgScoped, orgSelfScoped := implementsTenantScoped(s), implementsOrgScoped(s), implementsOrgSelfScoped(s)
+		if !tenantScoped && !orgScoped && !orgSelfScoped {
+			continue
+		}
+
+		var using, check []string
+		if tenantScoped {
+			using = append(using, rlsInSetting("tenant_id", RLSSettingTenantIds))
+		}
+		if orgScoped {
+			using = append(using, rlsInSetting("organization_id", RLSSettingOrgIds))
+		}
+		check = append(check, using...)
+		if orgSelfScoped {
+			// 作成直後の organization はまだ OrgIds に含まれないため、WITH CHECK には入れない（Create のガードと同じ）
+			using = append(using, rlsInSetting(primaryColumnName(s), RLSSettingOrgIds))
+		}
+		bypass := fmt.Sprintf("current_setting('%s', true) = 'on'", RLSSettingAllTenants)
+
+		table := quotePostgresIdent(s.Table)
+		statements = append(statements,
+			fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", table),
+			fmt.Sprintf("ALTER TABLE %s FORCE ROW LEVEL SECURITY", table),
+			fmt.Sprintf("DROP POLICY IF EXISTS %s ON %s", RLSPolicyName, table),
+		)
+		policy := fmt.Sprintf("CREATE POLICY %s ON %s USING (%s OR (%s))", RLSPolicyName, table, bypass, strings.Join(using, " AND "))
+		if len(check) > 0 {
+			policy += fmt.Sprintf(" WITH CHECK (%s OR (%s))", bypass, strings.Join(check, " AND "))
+		}
+		statements = append(statements, policy)
+	}
+	return statements, nil
+}
+
+// UseRLSSession は GORM の各操作の前に、Scope をトランザクションローカルなセッション変数へ設定するコールバックを登録する。
+// set_config(..., true) はトランザクション終了で消えるため、コネクションプールへ値が残留しない。
+// トランザクション外では設定できないため、マーカーを実装するモデルへのトランザクション外の操作は ErrRLSRequiresTransaction にする。
+// RLS 対象テーブルへは Transaction 内でアクセスすること（Create/Update/Delete は GORM の既定でトランザクション内になる）。
+// Raw()/Exec() にも設定されるため、生 SQL も DB 側のポリシーで守られる（モデルの無い生 SQL はトランザクション外でもエラーにしない）。
+// BypassTenantGuard はアプリのガードだけを外し、RLS は Scope のまま効く。RLS も外すときは BypassRLS を併せて使う。
+func UseRLSSession(db *gorm.DB) error {
+	const name = "gw_gorm:rls_session"
+	callbacks := db.Callback()
+	if callbacks.Create().Get(name) == nil {
+		if err := callbacks.Create().After("gorm:begin_transaction").Before("gorm:create").Register(name, setRLSSession); err != nil {
+			return err
+		}
+	}
+	if callbacks.Update().Get(name) == nil {
+		if err := callbacks.Update().After("gorm:begin_transaction").Before("gorm:update").Register(name, setRLSSession); err != nil {
+			return err
+		}
+	}
+	if callbacks.Delete().Get(name) == nil {
+		if err := callbacks.Delete().After("gorm:begin_transaction").Before("gorm:delete").Register(name, setRLSSession); err != nil {
+			return err
+		}
+	}
+	if callbacks.Query().Get(name) == nil {
+		if err := callbacks.Query().Before("gorm:query").Register(name, setRLSSession); err != nil {
+			return err
+		}
+	}
+	if callbacks.Row().Get(name) == nil {
+		if err := callbacks.Row().Before("gorm:row").Register(name, setRLSSession); err != nil {
+			return err
+		}
+	}
+	if callbacks.Raw().Get(name) == nil {
+		if err := callbacks.Raw().Before("gorm:raw").Register(name, setRLSSession); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BypassRLS は RLS のポリシーを外す（gw.all_tenants = 'on'）。管理バッチ・テナントのエクスポートなど、
+// 全テナントの行へ DB 側でもアクセスさせる箇所で明示的に使う。アプリのガードは外さないので、通常は BypassTenantGuard と併せて使う。
+//
+//	gw_gorm.BypassRLS(gw_gorm.BypassTenantGuard(db)).Transaction(func(tx *gorm.DB) error { ... })
+func BypassRLS(db *gorm.DB) *gorm.DB {
+	return db.Set(rlsBypassKey, true).Session(&gorm.Session{})
+}
+
+func bypassesRLS(db *gorm.DB) bool {
+	bypass, _ := db.Get(rlsBypassKey)
+	return bypass == true
+}
+
+func setRLSSession(db *gorm.DB) {
+	if db.Error != nil || db.DryRun || db.Statement == nil || db.Statement.ConnPool == nil {
+		return
+	}
+	if _, inTx := db.Statement.ConnPool.(gorm.TxCommitter); !inTx {
+		if s := db.Statement.Schema; s != nil && (implementsTenantScoped(s) || implementsOrgScoped(s) || implementsOrgSelfScoped(s)) {
+			db.AddError(fmt.Errorf("%w: %s", ErrRLSRequiresTransaction, s.Table))
+		}
+		return
+	}
+	tenantIds, orgIds, allTenants, err := rlsSessionValues(db)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	// 同じトランザクション内で Scope が変わっても前の値が残らないよう、毎回3つとも設定する
+	if _, err := db.Statement.ConnPool.ExecContext(db.Statement.Context, rlsSetConfigSQL, tenantIds, orgIds, allTenants); err != nil {
+		db.AddError(err)
+	}
+}
+
+func rlsSessionValues(db *gorm.DB) (tenantIds string, orgIds string, allTenants string, err error) {
+	if bypassesRLS(db) {
+		return "", "", "on", nil
+	}
+	scope, ok := scopeFrom(db)
+	if !ok || scope == nil {
+		return "", "", "off", nil
+	}
+	if scope.AllTenants {
+		return "", "", "on", nil
+	}
+	for _, id := range append(append([]string(nil), scope.TenantIds...), scope.OrgIds...) {
+		if strings.Contains(id, ",") {
+			return "", "", "", errors.New("scope id must not contain a comma for RLS session")
+		}
+	}
+	return strings.Join(scope.TenantIds, ","), strings.Join(scope.OrgIds, ","), "off", nil
+}
+
+func rlsInSetting(column string, setting string) string {
+	return fmt.Sprintf("%s::text = ANY (string_to_array(current_setting('%s', true), ','))", quotePostgresIdent(column), setting)
+}
+
+// quotePostgresIdent は schema.table 形式を含む識別子を二重引用符で囲む。
+func quotePostgresIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = `"` + strings.ReplaceAll(part, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
@@ -0,0 +1,187 @@
+package gw_gorm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"gorm.io/gorm/utils/tests"
+)
+
+// SQLite に set_config を登録し、UseRLSSession が設定した値を記録する（PostgreSQL の代わり）
+var rlsSettings = struct {
+	sync.Mutex
+	calls []map[string]string
+}{}
+
+func init() {
+	sql.Register("sqlite3_gw_rls", &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			pending := map[string]string{}
+			return conn.RegisterFunc("set_config", func(name string, value string, local bool) string {
+				rlsSettings.Lock()
+				defer rlsSettings.Unlock()
+				if !local {
+					panic("set_config must be transaction local")
+				}
+				pending[name] = value
+				if len(pending) == 3 {
+					rlsSettings.calls = append(rlsSettings.calls, pending)
+					pending = map[string]string{}
+				}
+				return value
+			}, false)
+		},
+	})
+}
+
+func openRLSTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Dialector{DriverName: "sqlite3_gw_rls", DSN: "file:" + t.Name() + "?mode=memory&cache=shared"}, &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UseRLSSession(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&guardedTodo{}); err != nil {
+		t.Fatal(err)
+	}
+	rlsSettings.Lock()
+	rlsSettings.calls = nil
+	rlsSettings.Unlock()
+	return db
+}
+
+func takeRLSCalls() []map[string]string {
+	rlsSettings.Lock()
+	defer rlsSettings.Unlock()
+	calls := rlsSettings.calls
+	rlsSettings.calls = nil
+	return calls
+}
+
+func TestRLSPolicySQL(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, DefaultConfig(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	statements, err := RLSPolicySQL(db, &guardedTodo{}, &plainNote{}, &guardedOrganization{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 8 {
+		t.Fatalf("unscoped models must be skipped: %v", statements)
+	}
+	want := []string{
+		`ALTER TABLE "guarded_todo" ENABLE ROW LEVEL SECURITY`,
+		`ALTER TABLE "guarded_todo" FORCE ROW LEVEL SECURITY`,
+		`DROP POLICY IF EXISTS gw_tenant_guard ON "guarded_todo"`,
+		`CREATE POLICY gw_tenant_guard ON "guarded_todo" USING (current_setting('gw.all_tenants', true) = 'on' OR (` +
+			`"tenant_id"::text = ANY (string_to_array(current_setting('gw.tenant_ids', true), ',')) AND ` +
+			`"organization_id"::text = ANY (string_to_array(current_setting('gw.org_ids', true), ',')))) WITH CHECK (` +
+			`current_setting('gw.all_tenants', true) = 'on' OR (` +
+			`"tenant_id"::text = ANY (string_to_array(current_setting('gw.tenant_ids', true), ',')) AND ` +
+			`"organization_id"::text = ANY (string_to_array(current_setting('gw.org_ids', true), ','))))`,
+	}
+	for i, w := range want {
+		if statements[i] != w {
+			t.Fatalf("statement[%d]:\n got=%s\nwant=%s", i, statements[i], w)
+		}
+	}
+	// organization 自身は主キーで絞るが、作成時の WITH CHECK はテナントのみ
+	orgPolicy := statements[7]
+	using, check, _ := strings.Cut(orgPolicy, " WITH CHECK ")
+	if !strings.Contains(using, `"id"::text = ANY (string_to_array(current_setting('gw.org_ids', true)`) || strings.Contains(check, `"id"`) {
+		t.Fatalf("org self policy=%s", orgPolicy)
+	}
+}
+
+func TestRLSSessionInTransaction(t *testing.T) {
+	db := openRLSTestDB(t)
+	ctx := WithScopeContext(context.Background(), &Scope{TenantIds: []string{"t1", "t2"}, OrgIds: []string{"o1"}})
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var todos []guardedTodo
+		if err := tx.Find(&todos).Error; err != nil {
+			return err
+		}
+		if err := BypassTenantGuard(tx).Exec("DELETE FROM guarded_todos WHERE id = ?", "x").Error; err != nil {
+			return err
+		}
+		return BypassRLS(tx).Exec("DELETE FROM guarded_todos WHERE id = ?", "x").Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := takeRLSCalls()
+	if len(calls) != 3 {
+		t.Fatalf("calls=%v", calls)
+	}
+	if calls[0][RLSSettingTenantIds] != "t1,t2" || calls[0][RLSSettingOrgIds] != "o1" || calls[0][RLSSettingAllTenants] != "off" {
+		t.Fatalf("scoped settings=%v", calls[0])
+	}
+	// BypassTenantGuard だけでは RLS は外れない
+	if calls[1][RLSSettingTenantIds] != "t1,t2" || calls[1][RLSSettingAllTenants] != "off" {
+		t.Fatalf("tenant guard bypass settings=%v", calls[1])
+	}
+	if calls[2][RLSSettingAllTenants] != "on" || calls[2][RLSSettingTenantIds] != "" {
+		t.Fatalf("rls bypass settings=%v", calls[2])
+	}
+
+	// GORM の既定トランザクションで実行される Create にも設定される
+	if err := db.WithContext(ctx).Create(&guardedTodo{Id: "a", TenantId: "t1", OrganizationId: "o1"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if calls := takeRLSCalls(); len(calls) != 1 || calls[0][RLSSettingTenantIds] != "t1,t2" {
+		t.Fatalf("create calls=%v", calls)
+	}
+
+	// トランザクション外では設定できないため、RLS 対象のモデルはエラーにする
+	var todos []guardedTodo
+	if err := db.WithContext(ctx).Find(&todos).Error; !errors.Is(err, ErrRLSRequiresTransaction) {
+		t.Fatalf("err=%v", err)
+	}
+	var notes []plainNote
+	if err := db.AutoMigrate(&plainNote{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Find(&notes).Error; err != nil {
+		t.Fatalf("models without markers must not require a transaction: %v", err)
+	}
+	if calls := takeRLSCalls(); len(calls) != 0 {
+		t.Fatalf("settings outside transaction=%v", calls)
+	}
+}
+
+func TestRLSSessionWithoutScopeClearsSettings(t *testing.T) {
+	db := openRLSTestDB(t)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		return tx.Table("guarded_todos").Count(&count).Error
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := takeRLSCalls()
+	if len(calls) != 1 || calls[0][RLSSettingTenantIds] != "" || calls[0][RLSSettingAllTenants] != "off" {
+		t.Fatalf("calls=%v", calls)
+	}
+
+	ctx := WithScopeContext(context.Background(), &Scope{TenantIds: []string{"t1,t2"}})
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Exec("DELETE FROM guarded_todos").Error
+	})
+	if err == nil || !strings.Contains(err.Error(), "comma") {
+		t.Fatalf("expected comma error, got %v", err)
+	}
+}
@@ -18,7 +18,8 @@ const tenantScopeSkipKey = "gw_gorm:tenant_scope_skip"
 // Scope はテナント境界と参照可能 organization を表す。
 //   - TenantIds: 参照可能テナント。通常ユーザーは所属テナントの1件。複数テナント権限者はN件
 //   - OrgIds: 参照可能 organization。nil/空 = 何も見えない
-//   - AllTenants: システム管理者用。テナント/organization 条件の注入を全てスキップする（RLS の BYPASSRLS 相当）。
+//   - AllTenants: システム管理者用。テナント/organization 条件の注入を全てスキップする（RLS の BYPASSRLS 相当。
+//     UseRLSSession を使う場合は DB 側のポリシーも gw.all_tenants = 'on' で全行を許可する）。
 //     これを true にしてよいのはアプリのスコープ解決処理（Role 判定）1箇所のみ、という規約で運用すること
 type Scope struct {
 	TenantIds  []string
@@ -67,7 +68,7 @@ type OrgScopedModel interface{ OrgScoped() }
 type OrgSelfScopedModel interface{ OrgSelfScoped() }
 
 // ApplyScope はDBのcontext.Contextへテナントスコープを載せ、先行するGuard解除を取り消す。
-// Raw()/Exec() の生 SQL は GORM コールバックを通らないため、このガードの対象外。
+// Raw()/Exec() の生 SQL は GORM コールバックを通らないため、このガードの対象外（ScopedRaw/ScopedExec を使う）。
 // 返り値は Session() 済みの「再利用可能な起点」。変数に取って複数クエリに使い回しても、
 // finisher 実行後の条件が次のクエリへ残留しない。Scopeの正本はcontext.Contextだけに置く。
 func ApplyScope(db *gorm.DB, scope *Scope) *gorm.DB {
@@ -76,14 +77,14 @@ func ApplyScope(db *gorm.DB, scope *Scope) *gorm.DB {
 }
 
 // BypassTenantGuard はスコープ解決処理・管理バッチ・シードなどで明示的にガードを外す。
-// Raw()/Exec() の生 SQL は GORM コールバックを通らないため、このガードの対象外。
+// Raw()/Exec() の生 SQL は GORM コールバックを通らないため、このガードの対象外（ScopedRaw/ScopedExec を使う）。
 // ApplyScope と同様、返り値は再利用可能な起点として扱え、後から呼んだ設定を有効とする。
 func BypassTenantGuard(db *gorm.DB) *gorm.DB {
 	return db.Set(tenantScopeSkipKey, true).Session(&gorm.Session{})
 }
 
 // UseTenantGuard は TenantScopedModel/OrgScopedModel/OrgSelfScopedModel への GORM 操作にスコープ条件を強制する。
-// Raw()/Exec() の生 SQL は GORM コールバックを通らないため、このガードの対象外。
+// Raw()/Exec() の生 SQL は GORM コールバックを通らないため、このガードの対象外（ScopedRaw/ScopedExec を使う）。
 func UseTenantGuard(db *gorm.DB) error {
 	if db.Callback().Query().Get("gw_gorm:tenant_guard_query") == nil {
 		if err := db.Callback().Query().Before("gorm:query").Register("gw_gorm:tenant_guard_query", tenantGuardQuery); err != nil {
@@ -277,7 +278,8 @@ func tenantGuardQuery(db *gorm.DB) {
 	tenantScoped := implementsTenantScoped(stmt.Schema)
 	orgScoped := implementsOrgScoped(stmt.Schema)
 	orgSelfScoped := implementsOrgSelfScoped(stmt.Schema)
-	if !tenantScoped && !orgScoped && !orgSelfScoped {
+	joined := guardedJoins(stmt)
+	if !tenantScoped && !orgScoped && !orgSelfScoped && len(joined) == 0 {
 		return
 	}
 	scope, ok := getScope(db)
@@ -289,33 +291,40 @@ func tenantGuardQuery(db *gorm.DB) {
 		// システム管理者: 条件注入なし（全テナント横断）
 		return
 	}
-	if tenantScoped {
+	if exprs := scopeExprs(stmt.Schema, scope); len(exprs) > 0 {
+		stmt.AddClause(clause.Where{Exprs: exprs})
+	}
+	if len(joined) > 0 {
+		applyJoinScopes(stmt, joined, scope)
+	}
+}
+
+// scopeExprs は s のマーカーに応じたスコープ条件を返す。カラムは clause.CurrentTable
+// （JOIN の ON 句ではその JOIN の別名）に対するものとして組み立てる。
+func scopeExprs(s *schema.Schema, scope *Scope) []clause.Expression {
+	var exprs []clause.Expression
+	if implementsTenantScoped(s) {
+		column := clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}
 		if len(scope.TenantIds) == 1 {
-			stmt.AddClause(clause.Where{Exprs: []clause.Expression{
-				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Value: scope.TenantIds[0]},
-			}})
+			exprs = append(exprs, clause.Eq{Column: column, Value: scope.TenantIds[0]})
 		} else {
-			stmt.AddClause(clause.Where{Exprs: []clause.Expression{
-				clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Values: toAnySlice(scope.TenantIds)},
-			}})
+			exprs = append(exprs, clause.IN{Column: column, Values: toAnySlice(scope.TenantIds)})
 		}
 	}
-	if orgScoped {
-		addOrgInClause(stmt, "organization_id", scope.OrgIds)
+	if implementsOrgScoped(s) {
+		exprs = append(exprs, orgInExpr("organization_id", scope.OrgIds))
 	}
-	if orgSelfScoped {
-		addOrgInClause(stmt, primaryColumnName(stmt.Schema), scope.OrgIds)
+	if implementsOrgSelfScoped(s) {
+		exprs = append(exprs, orgInExpr(primaryColumnName(s), scope.OrgIds))
 	}
+	return exprs
 }
 
-func addOrgInClause(stmt *gorm.Statement, column string, orgIds []string) {
+func orgInExpr(column string, orgIds []string) clause.Expression {
 	if len(orgIds) == 0 {
-		stmt.AddClause(clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "1 = 0"}}})
-		return
+		return clause.Expr{SQL: "1 = 0"}
 	}
-	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
-		clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Values: toAnySlice(orgIds)},
-	}})
+	return clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Values: toAnySlice(orgIds)}
 }
 
 func tenantGuardCreate(db *gorm.DB) {
@@ -357,10 +366,54 @@ func tenantGuardCreate(db *gorm.DB) {
 	})
 }
 
+var (
+	registeredModelsMu sync.RWMutex
+	registeredModels   []any
+)
+
+// RegisterModels はアプリの全モデルを登録する（&Todo{} のようなポインタ。同じ型の2回目以降は無視する）。
+// 登録したモデルは AssertScopedModels（models 省略時）と、テナント単位のエクスポート・削除（ExportTenant / EraseTenant）の対象になる。
+// 親（organization など）を先に登録する。EraseTenant は子から順に削除する。
+func RegisterModels(models ...any) {
+	registeredModelsMu.Lock()
+	defer registeredModelsMu.Unlock()
+	for _, m := range models {
+		t := indirectType(reflect.TypeOf(m))
+		duplicate := false
+		for _, registered := range registeredModels {
+			if indirectType(reflect.TypeOf(registered)) == t {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			registeredModels = append(registeredModels, m)
+		}
+	}
+}
+
+// RegisteredModels は RegisterModels で登録したモデルを登録順に返す。
+func RegisteredModels() []any {
+	registeredModelsMu.RLock()
+	defer registeredModelsMu.RUnlock()
+	return append([]any(nil), registeredModels...)
+}
+
+// AssertRegisteredModels は RegisterModels で登録したモデルを AssertScopedModels で検査する。
+// 1つも登録されていなければエラーにする（登録漏れで検査が素通りしないように）。
+func AssertRegisteredModels(exceptions []any) error {
+	models := RegisteredModels()
+	if len(models) == 0 {
+		return errors.New("no models are registered; call RegisterModels before AssertRegisteredModels")
+	}
+	return AssertScopedModels(exceptions, models...)
+}
+
 // AssertScopedModels はガードのマーカー付け忘れを起動時に検出する。
 // 「tenant_id カラムを持つのに TenantScopedModel を実装していない」モデル（およびその逆）をエラーにする。
 // exceptions には意図的にガード対象外とするモデル（例: ログイン時にスコープ確立前へ検索が必要な User）を渡す。
 // アプリの初期化（InitDB 等)で全モデルを渡して呼び、エラーなら起動を中断すること。
+// RegisterModels で登録したモデルを検査するなら AssertRegisteredModels を使う。
 func AssertScopedModels(exceptions []any, models ...any) error {
 	exceptionTypes := map[reflect.Type]bool{}
 	for _, e := range exceptions {
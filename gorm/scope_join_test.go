@@ -0,0 +1,173 @@
+package gw_gorm
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type joinOrg struct {
+	Id       string
+	TenantId string
+	Name     string
+}
+
+func (joinOrg) TenantScoped()  {}
+func (joinOrg) OrgSelfScoped() {}
+
+type joinProject struct {
+	Id       string
+	TenantId string
+	OrgId    string
+	Org      joinOrg    `gorm:"foreignKey:OrgId"`
+	Items    []joinItem `gorm:"foreignKey:ProjectId"`
+}
+
+func (joinProject) TenantScoped() {}
+
+type joinItem struct {
+	Id        string
+	TenantId  string
+	ProjectId string
+	Project   joinProject `gorm:"foreignKey:ProjectId"`
+}
+
+func (joinItem) TenantScoped() {}
+
+// マーカー無しの親から、ガード対象の関連を結合するケース
+type joinAuditEntry struct {
+	Id    string
+	OrgId string
+	Org   joinOrg `gorm:"foreignKey:OrgId"`
+}
+
+// p1 は t1 のプロジェクトだが、他テナント t2 の organization と item を参照している
+func openJoinTestDB(t *testing.T) (*gorm.DB, context.Context) {
+	t.Helper()
+	db := openTransactionTestDB(t)
+	if err := db.AutoMigrate(&joinOrg{}, &joinProject{}, &joinItem{}, &joinAuditEntry{}); err != nil {
+		t.Fatal(err)
+	}
+	seed := BypassTenantGuard(db)
+	for _, row := range []any{
+		&[]joinOrg{{Id: "o1", TenantId: "t1", Name: "acme"}, {Id: "o2", TenantId: "t2", Name: "globex"}},
+		&[]joinProject{{Id: "p1", TenantId: "t1", OrgId: "o2"}, {Id: "p2", TenantId: "t1", OrgId: "o1"}},
+		&[]joinItem{{Id: "i1", TenantId: "t1", ProjectId: "p1"}, {Id: "i2", TenantId: "t2", ProjectId: "p1"}, {Id: "i3", TenantId: "t1", ProjectId: "p2"}},
+		&[]joinAuditEntry{{Id: "a1", OrgId: "o2"}},
+	} {
+		if err := seed.Omit("Org", "Items", "Project").Create(row).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db, WithScopeContext(context.Background(), &Scope{TenantIds: []string{"t1"}, OrgIds: []string{"o1"}})
+}
+
+func TestJoinsExcludeCrossTenantAssociation(t *testing.T) {
+	db, ctx := openJoinTestDB(t)
+	scoped := db.WithContext(ctx)
+
+	var projects []joinProject
+	if err := scoped.Joins("Org").Order("join_projects.id").Find(&projects).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 || projects[0].Org.Id != "" || projects[1].Org.Id != "o1" {
+		t.Fatalf("projects=%+v", projects)
+	}
+
+	// InnerJoins は他テナントの関連を持つ親ごと除外される
+	projects = nil
+	if err := scoped.InnerJoins("Org").Find(&projects).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0].Id != "p2" {
+		t.Fatalf("inner joined projects=%+v", projects)
+	}
+
+	// 呼び出し側の ON 条件は残したまま追加する
+	projects = nil
+	if err := scoped.Joins("Org", db.Where(&joinOrg{Name: "globex"})).Order("join_projects.id").Find(&projects).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 2 || projects[0].Org.Id != "" || projects[1].Org.Id != "" {
+		t.Fatalf("custom on condition must be kept: %+v", projects)
+	}
+
+	// マーカー無しの親でも、ガード対象の関連を結合するならスコープが必要
+	var entries []joinAuditEntry
+	if err := db.Joins("Org").Find(&entries).Error; err == nil || !strings.Contains(err.Error(), "tenant scope is required") {
+		t.Fatalf("expected tenant guard error, got %v", err)
+	}
+	if err := scoped.Joins("Org").Find(&entries).Error; err != nil || len(entries) != 1 || entries[0].Org.Id != "" {
+		t.Fatalf("entries=%+v err=%v", entries, err)
+	}
+
+	// BypassTenantGuard では条件を入れない
+	entries = nil
+	if err := BypassTenantGuard(db).Joins("Org").Find(&entries).Error; err != nil || entries[0].Org.Id != "o2" {
+		t.Fatalf("bypass entries=%+v err=%v", entries, err)
+	}
+}
+
+func TestNestedJoinsRequireUniformScope(t *testing.T) {
+	db, ctx := openJoinTestDB(t)
+	scoped := db.WithContext(ctx)
+
+	var items []joinItem
+	err := scoped.Joins("Project.Org").Find(&items).Error
+	if err == nil || !strings.Contains(err.Error(), "different scope conditions") {
+		t.Fatalf("expected nested join error, got %v", err)
+	}
+
+	// 階層ごとに結合すれば、それぞれのテーブルにそのテーブルの条件が入る
+	items = nil
+	if err := scoped.Joins("Project").Joins("Project.Org").Order("join_items.id").Find(&items).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Id != "i1" || items[0].Project.Id != "p1" || items[0].Project.Org.Id != "" {
+		t.Fatalf("items=%+v", items)
+	}
+	if items[1].Project.Org.Id != "o1" {
+		t.Fatalf("same-tenant nested association must be joined: %+v", items[1])
+	}
+}
+
+func TestPreloadAndAssociationExcludeCrossTenantRows(t *testing.T) {
+	db, ctx := openJoinTestDB(t)
+	scoped := db.WithContext(ctx)
+
+	var project joinProject
+	if err := scoped.Preload("Items").Preload("Org").First(&project, "id = ?", "p1").Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(project.Items) != 1 || project.Items[0].Id != "i1" || project.Org.Id != "" {
+		t.Fatalf("project=%+v", project)
+	}
+
+	var items []joinItem
+	if err := scoped.Model(&joinProject{Id: "p1"}).Association("Items").Find(&items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].Id != "i1" {
+		t.Fatalf("association items=%+v", items)
+	}
+
+	var bypassed joinProject
+	if err := BypassTenantGuard(db).Preload("Items").First(&bypassed, "id = ?", "p1").Error; err != nil || len(bypassed.Items) != 2 {
+		t.Fatalf("bypass must reach preload queries: %+v %v", bypassed, err)
+	}
+}
+
+func TestJoinScopeSQL(t *testing.T) {
+	db := ApplyScope(openTestDB(t), singleScope())
+	var projects []joinProject
+	tx := db.Joins("Org").Find(&projects)
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	sql := tx.Statement.SQL.String()
+	if !strings.Contains(sql, "`Org`.`tenant_id` = ?") || !strings.Contains(sql, "`Org`.`id` = ?") || !strings.Contains(sql, "`join_projects`.`tenant_id` = ?") {
+		t.Fatalf("sql=%s", sql)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"strconv"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,20 +16,63 @@ import (
 // SlogLogger は GORM のログを slog（構造化JSON）で出力する logger.Interface 実装。
 // Trace は slog.XxxContext 相当で呼ぶため、gw_log の context 注入ハンドラを
 // 使っていれば SQL ログにも request_id / user_id が自動付与される。
+// SQL ログには呼び出し元（GORM と gw_gorm の外）の caller{file, line, function} も付く。
 type SlogLogger struct {
 	// LogLevel は GORM 側の出力レベル（Silent/Error/Warn/Info）。
 	LogLevel gormlogger.LogLevel
 	// SlowThreshold を超えたクエリは WARN で slow_query として出力する（0 なら無効）。
 	SlowThreshold time.Duration
+	// ExplainSampleRate はスロークエリのうち EXPLAIN を取る割合（0〜1、0 なら無効）。
+	// UseQueryAnalysis でコールバックを登録したときだけ効く。
+	ExplainSampleRate float64
+	// NPlusOneThreshold は同じ request_id の中で同じ形の SELECT がこの回数に達したら WARN で知らせる（0 なら無効）。
+	// UseQueryAnalysis でコールバックを登録したときだけ効く。
+	NPlusOneThreshold int
 }
 
+// SlogLogger の設定を環境ごとに変えるための環境変数。値が不正なら既定値のまま WARN を出す。
+const (
+	EnvSlowThreshold     = "GW_GORM_SLOW_THRESHOLD"      // 例: "500ms"
+	EnvExplainSampleRate = "GW_GORM_EXPLAIN_SAMPLE_RATE" // 例: "0.1"
+	EnvNPlusOneThreshold = "GW_GORM_NPLUSONE_THRESHOLD"  // 例: "10"
+)
+
 // NewSlogLogger は SQL ログ用の SlogLogger を返す。
 // debug=true なら全クエリを INFO で、false ならスロークエリ(200ms超)とエラーのみ出力する。
+// debug=true では N+1 の検知（同じ SQL が10回）も有効にする。
+// しきい値・EXPLAIN の割合・N+1 の回数は環境変数（EnvSlowThreshold など）で上書きできる。
 func NewSlogLogger(debug bool) *SlogLogger {
+	l := &SlogLogger{LogLevel: gormlogger.Warn, SlowThreshold: 200 * time.Millisecond}
 	if debug {
-		return &SlogLogger{LogLevel: gormlogger.Info, SlowThreshold: 200 * time.Millisecond}
+		l.LogLevel = gormlogger.Info
+		l.NPlusOneThreshold = 10
+	}
+	if v, ok := os.LookupEnv(EnvSlowThreshold); ok {
+		if d, err := time.ParseDuration(v); err == nil && d >= 0 {
+			l.SlowThreshold = d
+		} else {
+			invalidLoggerEnv(EnvSlowThreshold, v)
+		}
+	}
+	if v, ok := os.LookupEnv(EnvExplainSampleRate); ok {
+		if rate, err := strconv.ParseFloat(v, 64); err == nil && rate >= 0 && rate <= 1 {
+			l.ExplainSampleRate = rate
+		} else {
+			invalidLoggerEnv(EnvExplainSampleRate, v)
+		}
 	}
-	return &SlogLogger{LogLevel: gormlogger.Warn, SlowThreshold: 200 * time.Millisecond}
+	if v, ok := os.LookupEnv(EnvNPlusOneThreshold); ok {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			l.NPlusOneThreshold = n
+		} else {
+			invalidLoggerEnv(EnvNPlusOneThreshold, v)
+		}
+	}
+	return l
+}
+
+func invalidLoggerEnv(name, value string) {
+	slog.Warn("invalid sql logger setting is ignored", slog.String("source", "gorm"), slog.String("env", name), slog.String("value", value))
 }
 
 func (l *SlogLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
@@ -77,6 +122,7 @@ func (l *SlogLogger) trace(ctx context.Context, level slog.Level, msg string, fc
 		return
 	}
 	sql, rows := fc()
+	extra = append(extra, callerAttr())
 	slog.LogAttrs(ctx, level, msg, sqlAttrs(sql, rows, elapsed, extra...)...)
 }
 
@@ -0,0 +1,166 @@
+package gw_gorm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// slog のデフォルトロガーを buffer 出力に差し替え、出力された JSON を1行ずつ返す関数を返す
+func captureSQLLog(t *testing.T) func() []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	orig := slog.Default()
+	slog.SetDefault(slog.New(gw_log.NewHandler(slog.NewJSONHandler(&buf, nil))))
+	t.Cleanup(func() { slog.SetDefault(orig) })
+	return func() []map[string]any {
+		var records []map[string]any
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			if line == "" {
+				continue
+			}
+			var record map[string]any
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal(err)
+			}
+			records = append(records, record)
+		}
+		return records
+	}
+}
+
+func recordsWithMsg(records []map[string]any, msg string) []map[string]any {
+	var found []map[string]any
+	for _, record := range records {
+		if record["msg"] == msg {
+			found = append(found, record)
+		}
+	}
+	return found
+}
+
+func TestNewSlogLoggerReadsEnvironment(t *testing.T) {
+	l := NewSlogLogger(false)
+	if l.SlowThreshold != 200*time.Millisecond || l.ExplainSampleRate != 0 || l.NPlusOneThreshold != 0 {
+		t.Fatalf("defaults=%+v", l)
+	}
+	if l := NewSlogLogger(true); l.LogLevel != gormlogger.Info || l.NPlusOneThreshold != 10 {
+		t.Fatalf("debug=%+v", l)
+	}
+
+	t.Setenv(EnvSlowThreshold, "1s")
+	t.Setenv(EnvExplainSampleRate, "0.25")
+	t.Setenv(EnvNPlusOneThreshold, "5")
+	l = NewSlogLogger(false)
+	if l.SlowThreshold != time.Second || l.ExplainSampleRate != 0.25 || l.NPlusOneThreshold != 5 {
+		t.Fatalf("env=%+v", l)
+	}
+
+	logs := captureSQLLog(t)
+	t.Setenv(EnvExplainSampleRate, "2")
+	if l := NewSlogLogger(false); l.ExplainSampleRate != 0 {
+		t.Fatalf("out of range rate must be ignored: %+v", l)
+	}
+	if invalid := recordsWithMsg(logs(), "invalid sql logger setting is ignored"); len(invalid) != 1 || invalid[0]["env"] != EnvExplainSampleRate {
+		t.Fatalf("invalid=%v", invalid)
+	}
+}
+
+func TestNormalizeSQL(t *testing.T) {
+	cases := map[string]string{
+		`SELECT * FROM "todos" WHERE id = 'a''b' AND n = 12.5`:    `SELECT * FROM "todos" WHERE id = ? AND n = ?`,
+		"SELECT * FROM t1 WHERE id IN (1, 2,3)\n  LIMIT 10":       "SELECT * FROM t1 WHERE id IN (?) LIMIT ?",
+		`SELECT * FROM todos WHERE tenant_id = $1 AND id IN ($2)`: `SELECT * FROM todos WHERE tenant_id = ? AND id IN (?)`,
+	}
+	for in, want := range cases {
+		if got := NormalizeSQL(in); got != want {
+			t.Errorf("NormalizeSQL(%q)=%q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestSlogLoggerDetectsNPlusOne(t *testing.T) {
+	db := openTransactionTestDB(t)
+	if err := UseQueryAnalysis(db); err != nil {
+		t.Fatal(err)
+	}
+	logs := captureSQLLog(t)
+	tx := db.Session(&gorm.Session{Logger: &SlogLogger{LogLevel: gormlogger.Warn, NPlusOneThreshold: 3}})
+
+	// 集計はプロセス全体で持つため、-count で繰り返しても重ならない request_id にする
+	requestId := "req-" + time.Now().Format(time.RFC3339Nano)
+	ctx := WithScopeContext(gw_log.WithRequestId(context.Background(), requestId), singleScope())
+	for _, id := range []string{"a", "b", "c", "d", "e"} {
+		var todo guardedTodo
+		tx.WithContext(ctx).Where("id = ?", id).Limit(1).Find(&todo)
+	}
+	// request_id の無いクエリと別のリクエストは数えない
+	other := WithScopeContext(gw_log.WithRequestId(context.Background(), requestId+"-other"), singleScope())
+	for range 3 {
+		tx.WithContext(WithScopeContext(context.Background(), singleScope())).Where("id = ?", "a").Find(&[]guardedTodo{})
+	}
+	for range 2 {
+		tx.WithContext(other).Where("id = ?", "a").Find(&[]guardedTodo{})
+	}
+
+	warnings := recordsWithMsg(logs(), "n+1 query")
+	if len(warnings) != 1 {
+		t.Fatalf("must warn once per request and query: %v", warnings)
+	}
+	warning := warnings[0]
+	if warning["request_id"] != requestId || warning["count"] != float64(3) || warning["level"] != "WARN" {
+		t.Fatalf("warning=%v", warning)
+	}
+	if normalized, _ := warning["normalized_sql"].(string); normalized != "SELECT * FROM `guarded_todos` WHERE id = ? AND `guarded_todos`.`tenant_id` = ? AND `guarded_todos`.`organization_id` = ? LIMIT ?" {
+		t.Fatalf("normalized_sql=%s", normalized)
+	}
+	caller, _ := warning["caller"].(map[string]any)
+	if file, _ := caller["file"].(string); !strings.HasSuffix(file, "/slog_logger_test.go") || caller["line"] == nil {
+		t.Fatalf("caller must point at the test: %v", caller)
+	}
+}
+
+func TestSlowQueryExplain(t *testing.T) {
+	db := openTransactionTestDB(t)
+	if err := UseQueryAnalysis(db); err != nil {
+		t.Fatal(err)
+	}
+	logs := captureSQLLog(t)
+	ctx := WithScopeContext(context.Background(), singleScope())
+
+	slow := &SlogLogger{LogLevel: gormlogger.Warn, SlowThreshold: time.Nanosecond, ExplainSampleRate: 1}
+	if err := db.Session(&gorm.Session{Logger: slow}).WithContext(ctx).Where("title = ?", "x").Find(&[]guardedTodo{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	records := logs()
+	plans := recordsWithMsg(records, "slow query plan")
+	if len(plans) != 1 || len(recordsWithMsg(records, "slow query")) != 1 {
+		t.Fatalf("records=%v", records)
+	}
+	plan, _ := plans[0]["plan"].([]any)
+	if len(plan) == 0 || !strings.Contains(plan[0].(string), "guarded_todos") {
+		t.Fatalf("plan=%v", plans[0])
+	}
+	if sql, _ := plans[0]["sql"].(string); !strings.Contains(sql, "title = \"x\"") {
+		t.Fatalf("sql=%s", sql)
+	}
+
+	// 割合 0・しきい値未満では取らない
+	for _, l := range []*SlogLogger{
+		{LogLevel: gormlogger.Warn, SlowThreshold: time.Nanosecond},
+		{LogLevel: gormlogger.Warn, SlowThreshold: time.Hour, ExplainSampleRate: 1},
+	} {
+		db.Session(&gorm.Session{Logger: l}).WithContext(ctx).Find(&[]guardedTodo{})
+	}
+	if plans := recordsWithMsg(logs(), "slow query plan"); len(plans) != 1 {
+		t.Fatalf("plans=%v", plans)
+	}
+}
@@ -0,0 +1,315 @@
+package gw_gorm
+
+// このファイルは退会したテナントのデータの書き出し（ExportTenant）と、検証付きの一括削除（EraseTenant）を置く。
+// 個人情報保護法・GDPR の開示請求と削除請求に使う。
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	gw_files "github.com/generalworksinc/goutil/files"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrTenantDataRemains は EraseTenant の削除後にテナントの行が残っていたことを表す（削除は取り消される）。
+	ErrTenantDataRemains = errors.New("tenant data remains after erase")
+	// ErrTenantDataChanged は EraseTenant の削除件数が ExportTenant で書き出した件数と違うことを表す（削除は取り消される）。
+	ErrTenantDataChanged = errors.New("tenant data changed since export")
+)
+
+// DefaultExportBatchSize は ExportTenant が1回の SELECT で読む行数の既定値。
+const DefaultExportBatchSize = 500
+
+// TenantManifestFile は ExportTenant の zip に入れる TenantDataReport（JSON）のファイル名。
+const TenantManifestFile = "manifest.json"
+
+// TenantDataReport は ExportTenant / EraseTenant の結果。EraseTenant の結果は削除の証跡としてテナントの外に保存する。
+type TenantDataReport struct {
+	TenantId   string              `json:"tenantId"`
+	Tables     []TenantTableReport `json:"tables"`
+	StartedAt  time.Time           `json:"startedAt"`
+	FinishedAt time.Time           `json:"finishedAt"`
+}
+
+// TenantTableReport はテーブルごとの件数（ExportTenant は書き出した行数、EraseTenant は削除した行数）。
+type TenantTableReport struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+}
+
+// Rows は table の件数を返す。
+func (r *TenantDataReport) Rows(table string) int64 {
+	for _, t := range r.Tables {
+		if t.Table == table {
+			return t.Rows
+		}
+	}
+	return 0
+}
+
+// Total は全テーブルの件数の合計を返す。
+func (r *TenantDataReport) Total() int64 {
+	var total int64
+	for _, t := range r.Tables {
+		total += t.Rows
+	}
+	return total
+}
+
+// TenantExportOptions は ExportTenant の設定。
+type TenantExportOptions struct {
+	// Models は対象のモデル。空なら RegisterModels で登録したモデル
+	Models []any
+	// Password を指定すると zip の各ファイルを AES-256 で暗号化する（gw_files.CreateZipBuffer と同じ方式）
+	Password string
+	// BatchSize は1回の SELECT で読む行数（0 以下なら DefaultExportBatchSize）
+	BatchSize int
+}
+
+// ExportTenant は tenantId のテナントの全データを、テーブルごとの JSONL（<table>.jsonl）と manifest.json の zip として w に書き出す。
+// 行は BatchSize 件ずつ主キー順に読み、zip へ直接書くのでテナントが大きくてもメモリに溜めない。論理削除済みの行も含む。
+//   - TenantScopedModel: tenant_id が一致する行
+//   - OrgScopedModel（tenant_id なし）: テナントの organization（OrgSelfScopedModel かつ TenantScopedModel）に属する行
+//   - どちらでもないモデルは対象外
+//
+// Tenant Guard と RLS は外して実行する（UseRLSSession を使う DB では db にトランザクションを渡す）。暗号化カラム（gw_crypto.EncryptedString）は復号した値で書き出される。
+//
+//	report, err := gw_gorm.ExportTenant(db.WithContext(ctx), tenantId, file, gw_gorm.TenantExportOptions{Password: password})
+func ExportTenant(db *gorm.DB, tenantId string, w io.Writer, opts TenantExportOptions) (*TenantDataReport, error) {
+	report := &TenantDataReport{TenantId: tenantId, StartedAt: db.NowFunc()}
+	targets, err := tenantTargets(db, tenantId, opts.Models)
+	if err != nil {
+		return nil, err
+	}
+	orgIds, err := tenantOrgIds(db, tenantId, targets, false)
+	if err != nil {
+		return nil, err
+	}
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultExportBatchSize
+	}
+	zw := gw_files.NewZipWriter(w, opts.Password)
+	for _, target := range targets {
+		f, err := zw.Create(target.schema.Table + ".jsonl")
+		if err != nil {
+			return report, err
+		}
+		enc := json.NewEncoder(f)
+		var count int64
+		rows := reflect.New(reflect.SliceOf(reflect.PointerTo(target.schema.ModelType)))
+		err = target.query(db, tenantId, orgIds).FindInBatches(rows.Interface(), batchSize, func(tx *gorm.DB, batch int) error {
+			list := rows.Elem()
+			for i := 0; i < list.Len(); i++ {
+				if err := enc.Encode(list.Index(i).Interface()); err != nil {
+					return err
+				}
+			}
+			count += int64(list.Len())
+			return nil
+		}).Error
+		report.Tables = append(report.Tables, TenantTableReport{Table: target.schema.Table, Rows: count})
+		if err != nil {
+			return report, fmt.Errorf("export %s: %w", target.schema.Table, err)
+		}
+	}
+	report.FinishedAt = db.NowFunc()
+	f, err := zw.Create(TenantManifestFile)
+	if err != nil {
+		return report, err
+	}
+	if err := json.NewEncoder(f).Encode(report); err != nil {
+		return report, err
+	}
+	return report, zw.Close()
+}
+
+// TenantEraseOptions は EraseTenant の設定。
+type TenantEraseOptions struct {
+	// Models は対象のモデル。空なら RegisterModels で登録したモデル
+	Models []any
+	// Expected に ExportTenant の結果を渡すと、テーブルごとの削除件数が書き出した件数と一致するか検証する
+	Expected *TenantDataReport
+}
+
+// EraseTenant は ExportTenant と同じ対象の行を1つのトランザクションで物理削除し、テーブルごとの削除件数を返す。
+// 子から順に（organization に属する行 → テナントの行 → organization 自身、それぞれ登録の逆順で）削除したあと、
+// 行が残っていれば ErrTenantDataRemains、Expected と件数が違えば ErrTenantDataChanged を返して削除を取り消す。
+// organization の主キーはトランザクションの中でロックして読み、organization 自身を消す前に読み直して残りの確認に使う。
+// 論理削除済みの行も消す。削除は監査ログに記録しない（削除した個人情報が監査ログに残るため）。
+// 証跡が必要なら返り値の TenantDataReport をテナントの外に保存する。
+//
+//	exported, err := gw_gorm.ExportTenant(db.WithContext(ctx), tenantId, file, gw_gorm.TenantExportOptions{})
+//	erased, err := gw_gorm.EraseTenant(db.WithContext(ctx), tenantId, gw_gorm.TenantEraseOptions{Expected: exported})
+func EraseTenant(db *gorm.DB, tenantId string, opts TenantEraseOptions) (*TenantDataReport, error) {
+	report := &TenantDataReport{TenantId: tenantId, StartedAt: db.NowFunc()}
+	targets, err := tenantTargets(db, tenantId, opts.Models)
+	if err != nil {
+		return nil, err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// organization の行をロックしてから主キーを読む（読んだ後に消される・付け替えられる organization の行を残さない）
+		orgIds, err := tenantOrgIds(tx, tenantId, targets, true)
+		if err != nil {
+			return err
+		}
+		remainIds := orgIds
+		rederived := false
+		for _, target := range eraseOrder(targets) {
+			if target.orgSelf && !rederived {
+				// organization 自身を消す前に主キーを読み直し、削除中に追加された organization に属する行も残りとして数える
+				current, err := tenantOrgIds(tx, tenantId, targets, true)
+				if err != nil {
+					return err
+				}
+				remainIds = append(append([]any{}, orgIds...), current...)
+				rederived = true
+			}
+			result := target.query(markInternalWrite(tx), tenantId, orgIds).Delete(reflect.New(target.schema.ModelType).Interface())
+			report.Tables = append(report.Tables, TenantTableReport{Table: target.schema.Table, Rows: result.RowsAffected})
+			if result.Error != nil {
+				return fmt.Errorf("erase %s: %w", target.schema.Table, result.Error)
+			}
+		}
+		for _, target := range targets {
+			var remaining int64
+			if err := target.query(tx, tenantId, remainIds).Count(&remaining).Error; err != nil {
+				return err
+			}
+			if remaining > 0 {
+				return fmt.Errorf("%w: %d rows in %s", ErrTenantDataRemains, remaining, target.schema.Table)
+			}
+		}
+		if opts.Expected != nil {
+			for _, t := range report.Tables {
+				if expected := opts.Expected.Rows(t.Table); expected != t.Rows {
+					return fmt.Errorf("%w: %s exported %d rows but %d rows were found", ErrTenantDataChanged, t.Table, expected, t.Rows)
+				}
+			}
+		}
+		return nil
+	})
+	report.FinishedAt = db.NowFunc()
+	return report, err
+}
+
+type tenantTarget struct {
+	schema *schema.Schema
+	// orgOnly は tenant_id を持たず organization_id でテナントを辿るモデル
+	orgOnly bool
+	// orgSelf は organization テーブル自身（OrgSelfScopedModel）
+	orgSelf bool
+}
+
+// query はテナントの行（論理削除済みを含む）を対象にした Tenant Guard・RLS なしのクエリを返す。
+func (t tenantTarget) query(db *gorm.DB, tenantId string, orgIds []any) *gorm.DB {
+	tx := BypassRLS(BypassTenantGuard(db)).Model(reflect.New(t.schema.ModelType).Interface()).Unscoped()
+	if t.orgOnly {
+		return tx.Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: "organization_id"}, Values: orgIds})
+	}
+	return tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Value: tenantId})
+}
+
+// tenantTargets は models（空なら登録済みのモデル）のうちテナントのデータを持つものを返す。
+func tenantTargets(db *gorm.DB, tenantId string, models []any) ([]tenantTarget, error) {
+	if tenantId == "" {
+		return nil, errors.New("tenant id is required")
+	}
+	if len(models) == 0 {
+		models = RegisteredModels()
+	}
+	var targets []tenantTarget
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return nil, err
+		}
+		s := stmt.Schema
+		tenantScoped := implementsTenantScoped(s) && s.LookUpField("tenant_id") != nil
+		target := tenantTarget{schema: s, orgSelf: implements[OrgSelfScopedModel](s)}
+		switch {
+		case target.orgSelf && !tenantScoped:
+			return nil, fmt.Errorf("%s: organization model must have tenant_id to find the tenant's rows", s.Table)
+		case tenantScoped:
+		case implementsOrgScoped(s) && s.LookUpField("organization_id") != nil:
+			target.orgOnly = true
+		default:
+			continue
+		}
+		targets = append(targets, target)
+	}
+	var orgOnly []string
+	var orgSelves []tenantTarget
+	for _, target := range targets {
+		if target.orgOnly {
+			orgOnly = append(orgOnly, target.schema.Table)
+		}
+		if target.orgSelf {
+			orgSelves = append(orgSelves, target)
+		}
+	}
+	if len(orgOnly) == 0 {
+		return targets, nil
+	}
+	if len(orgSelves) == 0 {
+		return nil, fmt.Errorf("%s: organization scoped models require an OrgSelfScopedModel to find the tenant's organizations", strings.Join(orgOnly, ", "))
+	}
+	for _, org := range orgSelves {
+		if org.schema.PrioritizedPrimaryField == nil {
+			return nil, fmt.Errorf("%s: organization model must have a primary key", org.schema.Table)
+		}
+	}
+	return targets, nil
+}
+
+// tenantOrgIds はテナントの organization の主キーを返す（organization に属するモデルが targets に無ければ nil）。
+// lock なら読んだ organization の行を SELECT ... FOR UPDATE でロックする。
+func tenantOrgIds(db *gorm.DB, tenantId string, targets []tenantTarget, lock bool) ([]any, error) {
+	needed := false
+	for _, target := range targets {
+		needed = needed || target.orgOnly
+	}
+	if !needed {
+		return nil, nil
+	}
+	var orgIds []any
+	for _, org := range targets {
+		if !org.orgSelf {
+			continue
+		}
+		query := org.query(db, tenantId, nil)
+		if lock {
+			query = query.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate})
+		}
+		var ids []any
+		if err := query.Pluck(org.schema.PrioritizedPrimaryField.DBName, &ids).Error; err != nil {
+			return nil, err
+		}
+		orgIds = append(orgIds, ids...)
+	}
+	return orgIds, nil
+}
+
+// eraseOrder は targets を子から順（organization に属する行 → テナントの行 → organization 自身、それぞれ登録の逆順）に並べる。
+func eraseOrder(targets []tenantTarget) []tenantTarget {
+	var orgOnly, tenant, orgSelf []tenantTarget
+	for i := len(targets) - 1; i >= 0; i-- {
+		switch t := targets[i]; {
+		case t.orgOnly:
+			orgOnly = append(orgOnly, t)
+		case t.orgSelf:
+			orgSelf = append(orgSelf, t)
+		default:
+			tenant = append(tenant, t)
+		}
+	}
+	return append(append(orgOnly, tenant...), orgSelf...)
+}
@@ -0,0 +1,213 @@
+package gw_gorm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/yeka/zip"
+	"gorm.io/gorm"
+)
+
+type orgMemo struct {
+	Id             string
+	OrganizationId string
+	Body           string
+}
+
+func (orgMemo) OrgScoped() {}
+
+type archivedNote struct {
+	Id        string
+	TenantId  string
+	Body      string
+	DeletedAt gorm.DeletedAt
+}
+
+func (archivedNote) TenantScoped() {}
+
+func tenantDataModels() []any {
+	return []any{&guardedOrganization{}, &guardedTodo{}, &archivedNote{}, &orgMemo{}, &plainNote{}}
+}
+
+func openTenantDataTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTransactionTestDB(t)
+	if err := db.AutoMigrate(&guardedOrganization{}, &archivedNote{}, &orgMemo{}, &plainNote{}); err != nil {
+		t.Fatal(err)
+	}
+	seed := BypassTenantGuard(db)
+	for _, rows := range []any{
+		&[]guardedOrganization{{Id: "o1", TenantId: "t1", Name: "本社"}, {Id: "o2", TenantId: "t1", Name: "支社"}, {Id: "o9", TenantId: "t2", Name: "other"}},
+		&[]guardedTodo{{Id: "a", TenantId: "t1", OrganizationId: "o1", Title: "mine"}, {Id: "b", TenantId: "t2", OrganizationId: "o9", Title: "other"}},
+		&[]orgMemo{{Id: "m1", OrganizationId: "o1", Body: "memo"}, {Id: "m2", OrganizationId: "o2", Body: "memo"}, {Id: "m9", OrganizationId: "o9", Body: "other"}},
+		&[]archivedNote{{Id: "n1", TenantId: "t1", Body: "mine"}, {Id: "n2", TenantId: "t1", Body: "mine"}, {Id: "x1", TenantId: "t2", Body: "other"}},
+		&[]plainNote{{Id: "p1", Text: "shared"}},
+	} {
+		if err := seed.Create(rows).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 論理削除した行も書き出し・削除の対象になる
+	if err := seed.Where("id = ?", "n1").Delete(&archivedNote{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func readTenantArchive(t *testing.T, data []byte, password string) map[string][]string {
+	t.Helper()
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]string{}
+	for _, f := range r.File {
+		if f.IsEncrypted() {
+			f.SetPassword(password)
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		lines := []string{}
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		files[f.Name] = lines
+	}
+	return files
+}
+
+func TestExportAndEraseTenant(t *testing.T) {
+	db := openTenantDataTestDB(t)
+
+	var buf bytes.Buffer
+	exported, err := ExportTenant(db, "t1", &buf, TenantExportOptions{Models: tenantDataModels(), Password: "secret", BatchSize: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int64{"guarded_organizations": 2, "guarded_todos": 1, "archived_notes": 2, "org_memos": 2}
+	if len(exported.Tables) != len(want) {
+		t.Fatalf("tables=%+v", exported.Tables)
+	}
+	for table, rows := range want {
+		if exported.Rows(table) != rows {
+			t.Fatalf("%s: rows=%d want %d", table, exported.Rows(table), rows)
+		}
+	}
+	if bytes.Contains(buf.Bytes(), []byte("mine")) {
+		t.Fatal("archive must be encrypted")
+	}
+	files := readTenantArchive(t, buf.Bytes(), "secret")
+	if len(files["org_memos.jsonl"]) != 2 || len(files["archived_notes.jsonl"]) != 2 || files["plain_notes.jsonl"] != nil {
+		t.Fatalf("files=%v", files)
+	}
+	if strings.Contains(strings.Join(files["org_memos.jsonl"], "\n"), "other") {
+		t.Fatalf("other tenants must not be exported: %v", files["org_memos.jsonl"])
+	}
+	var manifest TenantDataReport
+	if err := json.Unmarshal([]byte(files[TenantManifestFile][0]), &manifest); err != nil || manifest.Total() != 7 || manifest.TenantId != "t1" {
+		t.Fatalf("manifest=%+v err=%v", manifest, err)
+	}
+
+	// 書き出した後にデータが増えていたら削除しない
+	if err := BypassTenantGuard(db).Create(&orgMemo{Id: "m3", OrganizationId: "o2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EraseTenant(db, "t1", TenantEraseOptions{Models: tenantDataModels(), Expected: exported}); !errors.Is(err, ErrTenantDataChanged) {
+		t.Fatalf("err=%v", err)
+	}
+	var memos int64
+	BypassTenantGuard(db).Model(&orgMemo{}).Count(&memos)
+	if memos != 4 {
+		t.Fatalf("erase must be rolled back: memos=%d", memos)
+	}
+
+	erased, err := EraseTenant(db, "t1", TenantEraseOptions{Models: tenantDataModels()})
+	if err != nil || erased.Total() != 8 || erased.Tables[0].Table != "org_memos" || erased.Tables[len(erased.Tables)-1].Table != "guarded_organizations" {
+		t.Fatalf("erased=%+v err=%v", erased, err)
+	}
+	var left []string
+	for _, model := range []any{&guardedOrganization{}, &guardedTodo{}, &archivedNote{}, &orgMemo{}, &plainNote{}} {
+		var ids []string
+		BypassTenantGuard(db).Model(model).Unscoped().Order("id").Pluck("id", &ids)
+		left = append(left, ids...)
+	}
+	if strings.Join(left, ",") != "o9,b,x1,m9,p1" {
+		t.Fatalf("only the tenant's rows must be erased: %v", left)
+	}
+}
+
+func TestTenantDataUsesRegisteredModels(t *testing.T) {
+	t.Cleanup(func() {
+		registeredModelsMu.Lock()
+		registeredModels = nil
+		registeredModelsMu.Unlock()
+	})
+	db := openTenantDataTestDB(t)
+
+	if err := AssertRegisteredModels(nil); err == nil {
+		t.Fatal("AssertRegisteredModels must fail without registered models")
+	}
+	RegisterModels(&guardedTodo{}, &orgMemo{})
+	RegisterModels(&guardedTodo{})
+	if len(RegisteredModels()) != 2 {
+		t.Fatalf("registered=%v", RegisteredModels())
+	}
+	if _, err := ExportTenant(db, "t1", io.Discard, TenantExportOptions{}); err == nil || !strings.Contains(err.Error(), "org_memos") {
+		t.Fatalf("organization scoped models need the organization model: %v", err)
+	}
+	RegisterModels(&guardedOrganization{})
+	report, err := ExportTenant(db, "t1", io.Discard, TenantExportOptions{})
+	if err != nil || report.Total() != 5 {
+		t.Fatalf("report=%+v err=%v", report, err)
+	}
+	if _, err := ExportTenant(db, "", io.Discard, TenantExportOptions{}); err == nil {
+		t.Fatal("empty tenant id must be rejected")
+	}
+
+	RegisterModels(&plainUser{})
+	if err := AssertRegisteredModels(nil); err == nil || !strings.Contains(err.Error(), "plainUser") {
+		t.Fatalf("AssertRegisteredModels must inspect the registry: %v", err)
+	}
+	if err := AssertScopedModels(nil); err != nil {
+		t.Fatalf("AssertScopedModels without models must not inspect the registry: %v", err)
+	}
+}
+
+func TestEraseTenantRederivesOrganizations(t *testing.T) {
+	db := openTenantDataTestDB(t)
+	// org_memos を消した直後に、別の処理が organization とその行を追加したことにする
+	added := false
+	err := db.Callback().Delete().After("gorm:delete").Register("test:add_organization", func(tx *gorm.DB) {
+		if added || tx.Statement.Schema == nil || tx.Statement.Schema.Table != "org_memos" {
+			return
+		}
+		added = true
+		insert := BypassTenantGuard(tx.Session(&gorm.Session{NewDB: true}))
+		insert.Create(&guardedOrganization{Id: "o3", TenantId: "t1", Name: "新設"})
+		insert.Create(&orgMemo{Id: "m4", OrganizationId: "o3"})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := EraseTenant(db, "t1", TenantEraseOptions{Models: tenantDataModels()}); !errors.Is(err, ErrTenantDataRemains) {
+		t.Fatalf("err=%v", err)
+	}
+	var memos int64
+	BypassTenantGuard(db).Model(&orgMemo{}).Count(&memos)
+	if !added || memos != 3 {
+		t.Fatalf("erase must be rolled back: added=%v memos=%d", added, memos)
+	}
+}
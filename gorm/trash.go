@@ -0,0 +1,210 @@
+package gw_gorm
+
+// このファイルは論理削除（gorm.DeletedAt）した行のゴミ箱一覧・復元・保持期間後の物理削除と、
+// 論理削除済みの行を除いた一意インデックス（CreateActiveUniqueIndex）を置く。
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrNotSoftDeletable はモデルに論理削除のカラム（gorm.DeletedAt）が無いことを表す。
+var ErrNotSoftDeletable = errors.New("model has no soft delete column")
+
+// DefaultPurgeBatchSize は PurgeDeleted が1回の DELETE で消す行数の既定値。
+const DefaultPurgeBatchSize = 500
+
+// Trash は T の論理削除済みの行だけを対象にしたクエリを返す。
+// Tenant Guard は通常の Find と同じく効くので、BypassTenantGuard を使わずに自分の Scope のゴミ箱を一覧できる。
+//
+//	var todos []Todo
+//	err := gw_gorm.Trash[Todo](db.WithContext(ctx)).Order("deleted_at DESC").Find(&todos).Error
+//	page, err := gw_gorm.Paginate[Todo](gw_gorm.Trash[Todo](db), req) // 並び順は PageRequest.Sort で指定する
+func Trash[T any](db *gorm.DB) *gorm.DB {
+	_, field, err := softDeleteSchema[T](db)
+	if err != nil {
+		tx := db.Session(&gorm.Session{})
+		tx.AddError(err)
+		return tx
+	}
+	return db.Model(new(T)).Unscoped().
+		Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil})
+}
+
+// Restore は論理削除済みの行のうち、主キーが ids のものを復元して件数を返す（削除されていない行は数えない）。
+// deleted_by カラムがあれば空に戻す。更新は Tenant Guard・監査ログ・UseActorStamp のコールバックを通る。
+// 論理削除中に同じ値の行が作られていると、一意インデックスの違反（DB のエラー）になる。
+func Restore[T any](db *gorm.DB, ids ...any) (int64, error) {
+	s, field, err := softDeleteSchema[T](db)
+	if err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	primary := s.PrioritizedPrimaryField
+	if primary == nil || len(s.PrimaryFields) != 1 {
+		return 0, errors.New("restore requires a model with a single primary key")
+	}
+	updates := map[string]any{field.DBName: nil}
+	if s.LookUpField("deleted_by") != nil {
+		updates["deleted_by"] = ""
+	}
+	result := db.Model(new(T)).Unscoped().
+		Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: primary.DBName}, Values: ids}).
+		Where(clause.Neq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil}).
+		Updates(updates)
+	return result.RowsAffected, result.Error
+}
+
+// PurgeDeleted は deletedBefore より前に論理削除された T の行を物理削除し、件数を返す。
+// 長いロックを避けるため batchSize（0 以下なら DefaultPurgeBatchSize）件ずつ主キーで削除する。
+// Tenant Guard が効くため、全テナントを対象にする定期ジョブは AllTenants の Scope の context で呼ぶ。
+func PurgeDeleted[T any](db *gorm.DB, deletedBefore time.Time, batchSize int) (int64, error) {
+	return purgeDeleted(db, new(T), deletedBefore, batchSize)
+}
+
+// RetentionPolicy は論理削除した行を保持する期間。
+type RetentionPolicy struct {
+	// Model は &Todo{} のようなモデルのポインタ
+	Model     any
+	Retention time.Duration
+}
+
+// PurgeExpired は policies ごとに保持期間を過ぎた論理削除済みの行を物理削除し、テーブルごとの件数を返す。
+// 途中のテーブルで失敗した場合は、そこまでの件数とエラーを返す。
+//
+//	ctx := gw_gorm.WithScopeContext(ctx, &gw_gorm.Scope{AllTenants: true})
+//	counts, err := gw_gorm.PurgeExpired(db.WithContext(ctx), gw_gorm.RetentionPolicy{Model: &Todo{}, Retention: 30 * 24 * time.Hour})
+func PurgeExpired(db *gorm.DB, policies ...RetentionPolicy) (map[string]int64, error) {
+	counts := map[string]int64{}
+	now := db.NowFunc()
+	for _, policy := range policies {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(policy.Model); err != nil {
+			return counts, err
+		}
+		purged, err := purgeDeleted(db, policy.Model, now.Add(-policy.Retention), 0)
+		counts[stmt.Schema.Table] += purged
+		if err != nil {
+			return counts, fmt.Errorf("purge %s: %w", stmt.Schema.Table, err)
+		}
+	}
+	return counts, nil
+}
+
+func purgeDeleted(db *gorm.DB, model any, deletedBefore time.Time, batchSize int) (int64, error) {
+	if batchSize <= 0 {
+		batchSize = DefaultPurgeBatchSize
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return 0, err
+	}
+	field := findSoftDeleteField(stmt.Schema)
+	if field == nil {
+		return 0, ErrNotSoftDeletable
+	}
+	primary := stmt.Schema.PrioritizedPrimaryField
+	if primary == nil || len(stmt.Schema.PrimaryFields) != 1 {
+		return 0, errors.New("purge requires a model with a single primary key")
+	}
+	modelType := reflect.TypeOf(model)
+	var total int64
+	for {
+		var ids []any
+		err := db.Model(reflect.New(modelType.Elem()).Interface()).Unscoped().
+			Where(clause.Lt{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: deletedBefore}).
+			Order(clause.OrderByColumn{Column: clause.Column{Table: clause.CurrentTable, Name: primary.DBName}}).
+			Limit(batchSize).
+			Pluck(primary.DBName, &ids).Error
+		if err != nil || len(ids) == 0 {
+			return total, err
+		}
+		result := db.Unscoped().
+			Where(clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: primary.DBName}, Values: ids}).
+			Delete(reflect.New(modelType.Elem()).Interface())
+		total += result.RowsAffected
+		if result.Error != nil {
+			return total, result.Error
+		}
+		if len(ids) < batchSize {
+			return total, nil
+		}
+	}
+}
+
+// CreateActiveUniqueIndex は論理削除済みの行を除いて columns を一意にするインデックスを作る（既にあれば何もしない）。
+// 削除した行と同じメールアドレスでの再登録などを許可するために使う。
+//   - PostgreSQL / SQLite / SQL Server: 部分インデックス（WHERE deleted_at IS NULL）
+//   - MySQL（8.0.13 以降）: 関数インデックス（削除済みの行は NULL になり一意制約の対象外になる）
+//
+// columns はカラム名またはフィールド名。マイグレーションの Up から呼ぶ。
+func CreateActiveUniqueIndex(db *gorm.DB, model any, name string, columns ...string) error {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(model); err != nil {
+		return err
+	}
+	field := findSoftDeleteField(stmt.Schema)
+	if field == nil {
+		return ErrNotSoftDeletable
+	}
+	if len(columns) == 0 {
+		return errors.New("unique index requires at least one column")
+	}
+	if db.Migrator().HasIndex(model, name) {
+		return nil
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		f := stmt.Schema.LookUpField(column)
+		if f == nil || f.DBName == "" {
+			return fmt.Errorf("unknown column %q", column)
+		}
+		quoted[i] = stmt.Quote(f.DBName)
+	}
+	deletedAt := stmt.Quote(field.DBName)
+	var sql string
+	switch db.Dialector.Name() {
+	case "postgres", "sqlite", "sqlserver":
+		sql = fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s) WHERE %s IS NULL",
+			stmt.Quote(name), stmt.Quote(stmt.Schema.Table), strings.Join(quoted, ", "), deletedAt)
+	case "mysql":
+		parts := make([]string, len(quoted))
+		for i, column := range quoted {
+			parts[i] = fmt.Sprintf("(IF(%s IS NULL, %s, NULL))", deletedAt, column)
+		}
+		sql = fmt.Sprintf("CREATE UNIQUE INDEX %s ON %s (%s)", stmt.Quote(name), stmt.Quote(stmt.Schema.Table), strings.Join(parts, ", "))
+	default:
+		return fmt.Errorf("active unique index is not supported on %s", db.Dialector.Name())
+	}
+	return db.Exec(sql).Error
+}
+
+func softDeleteSchema[T any](db *gorm.DB) (*schema.Schema, *schema.Field, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, nil, err
+	}
+	if field := findSoftDeleteField(stmt.Schema); field != nil {
+		return stmt.Schema, field, nil
+	}
+	return nil, nil, ErrNotSoftDeletable
+}
+
+func findSoftDeleteField(s *schema.Schema) *schema.Field {
+	deletedAtType := reflect.TypeOf(gorm.DeletedAt{})
+	for _, field := range s.Fields {
+		if field.FieldType == deletedAtType && field.DBName != "" {
+			return field
+		}
+	}
+	return nil
+}
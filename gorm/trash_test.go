@@ -0,0 +1,137 @@
+package gw_gorm
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type trashedNote struct {
+	Id        string
+	TenantId  string
+	Email     string
+	DeletedBy string
+	DeletedAt gorm.DeletedAt
+}
+
+func (trashedNote) TenantScoped() {}
+
+func openTrashTestDB(t *testing.T) (*gorm.DB, context.Context) {
+	t.Helper()
+	notes := []trashedNote{
+		{Id: "n1", TenantId: "t1", Email: "a@example.com"},
+		{Id: "n2", TenantId: "t1", Email: "b@example.com"},
+		{Id: "x1", TenantId: "t2", Email: "c@example.com"},
+	}
+	db, ctx := migrateAndSeed(t, &trashedNote{}, notes)
+	if err := BypassTenantGuard(db).Where("id IN ?", []string{"n1", "x1"}).Delete(&trashedNote{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	return db, ctx
+}
+
+func noteIds(t *testing.T, tx *gorm.DB) []string {
+	t.Helper()
+	var notes []trashedNote
+	if err := tx.Find(&notes).Error; err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(notes))
+	for i, note := range notes {
+		ids[i] = note.Id
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestTrashAndRestoreRespectScope(t *testing.T) {
+	db, ctx := openTrashTestDB(t)
+	scoped := db.WithContext(ctx)
+
+	if ids := noteIds(t, Trash[trashedNote](scoped)); len(ids) != 1 || ids[0] != "n1" {
+		t.Fatalf("trash must list only deleted rows in scope: %v", ids)
+	}
+	if err := Trash[guardedTodo](scoped).Find(&[]guardedTodo{}).Error; !errors.Is(err, ErrNotSoftDeletable) {
+		t.Fatalf("err=%v", err)
+	}
+	if err := Trash[trashedNote](db).Find(&[]trashedNote{}).Error; err == nil {
+		t.Fatal("trash without scope must be rejected by the tenant guard")
+	}
+
+	if err := BypassTenantGuard(db).Model(&trashedNote{}).Unscoped().Where("id = ?", "n1").Update("deleted_by", "u1").Error; err != nil {
+		t.Fatal(err)
+	}
+	restored, err := Restore[trashedNote](scoped, "n1", "n2", "x1")
+	if err != nil || restored != 1 {
+		t.Fatalf("only deleted rows in scope are restored: restored=%d err=%v", restored, err)
+	}
+	var note trashedNote
+	scoped.First(&note, "id = ?", "n1")
+	if note.DeletedAt.Valid || note.DeletedBy != "" {
+		t.Fatalf("restored=%+v", note)
+	}
+	if ids := noteIds(t, Trash[trashedNote](BypassTenantGuard(db))); len(ids) != 1 || ids[0] != "x1" {
+		t.Fatalf("other tenants must stay in the trash: %v", ids)
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	db, ctx := openTrashTestDB(t)
+	if err := db.WithContext(ctx).Delete(&trashedNote{Id: "n2"}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := PurgeDeleted[trashedNote](db.WithContext(ctx), time.Now().Add(time.Minute), 1)
+	if err != nil || purged != 2 {
+		t.Fatalf("purged=%d err=%v", purged, err)
+	}
+	if ids := noteIds(t, BypassTenantGuard(db).Unscoped()); len(ids) != 1 || ids[0] != "x1" {
+		t.Fatalf("only rows in scope must be purged: %v", ids)
+	}
+
+	// 保持期間内の行は残す
+	all := db.WithContext(WithScopeContext(context.Background(), &Scope{AllTenants: true}))
+	counts, err := PurgeExpired(all, RetentionPolicy{Model: &trashedNote{}, Retention: time.Hour})
+	if err != nil || counts["trashed_notes"] != 0 {
+		t.Fatalf("counts=%v err=%v", counts, err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	if err := BypassTenantGuard(db).Model(&trashedNote{}).Unscoped().Where("id = ?", "x1").Update("deleted_at", old).Error; err != nil {
+		t.Fatal(err)
+	}
+	counts, err = PurgeExpired(all, RetentionPolicy{Model: &trashedNote{}, Retention: time.Hour})
+	if err != nil || counts["trashed_notes"] != 1 {
+		t.Fatalf("counts=%v err=%v", counts, err)
+	}
+	if _, err := PurgeExpired(all, RetentionPolicy{Model: &guardedTodo{}, Retention: time.Hour}); !errors.Is(err, ErrNotSoftDeletable) {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestActiveUniqueIndex(t *testing.T) {
+	db, ctx := openTrashTestDB(t)
+	scoped := db.WithContext(ctx)
+	for range 2 {
+		if err := CreateActiveUniqueIndex(db, &trashedNote{}, "ux_trashed_note_email", "TenantId", "email"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// n1（a@example.com）は削除済みなので同じメールアドレスで作り直せる
+	if err := scoped.Create(&trashedNote{Id: "n3", Email: "a@example.com"}).Error; err != nil {
+		t.Fatalf("deleted rows must not block the unique index: %v", err)
+	}
+	if err := scoped.Create(&trashedNote{Id: "n4", Email: "a@example.com"}).Error; err == nil {
+		t.Fatal("duplicate active rows must be rejected")
+	}
+	if _, err := Restore[trashedNote](scoped, "n1"); err == nil {
+		t.Fatal("restoring a duplicate must be rejected")
+	}
+	if err := CreateActiveUniqueIndex(db, &guardedTodo{}, "ux_todo", "title"); !errors.Is(err, ErrNotSoftDeletable) {
+		t.Fatalf("err=%v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package gw_gorm
+
+// このファイルはリトライ・セーブポイント・コミット後フック付きのトランザクション（WithTx）を置く。
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"math/rand/v2"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// DefaultTxAttempts は TxOptions.MaxAttempts が 0 のときの試行回数（初回を含む）。
+	DefaultTxAttempts = 3
+	defaultTxBackoff  = 50 * time.Millisecond
+	maxTxBackoff      = time.Second
+)
+
+// TxOptions は WithTx の設定。nil なら既定値（DB 既定の分離レベル、3回まで試行）。
+type TxOptions struct {
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	// MaxAttempts は初回を含む試行回数。1 でリトライしない。
+	MaxAttempts int
+	// Backoff はリトライ前の待ち時間の初期値（50ms）。試行ごとに倍にし（上限1秒）、ゆらぎを加える。
+	Backoff time.Duration
+	// RetryIf はリトライする失敗の判定。nil なら IsRetryableTxError。
+	RetryIf func(error) bool
+}
+
+type txHooksKey struct{}
+
+// txHooks は1つのトランザクション（またはセーブポイント）で登録されたコミット後フック。
+type txHooks struct {
+	hooks []func(ctx context.Context)
+}
+
+// WithTx は fn をトランザクションで実行し、直列化失敗・デッドロックなどの一時的な失敗なら最初からやり直す。
+//   - ctx の Scope・deadline は tx に引き継がれる（Tenant Guard はそのまま効く）。ctx に Scope が無ければ db の Scope を使う
+//   - fn は再実行されるため、DB 以外への副作用（メール送信・外部API）は AfterCommit に登録する
+//   - tx の中で WithTx を呼ぶとセーブポイントになる。内側の失敗は内側だけ巻き戻り、リトライと分離レベルは一番外側のものが使われる
+//   - fn が返したエラー、またはリトライを使い切った最後のエラーをそのまま返す
+func WithTx(ctx context.Context, db *gorm.DB, opts *TxOptions, fn func(tx *gorm.DB) error) error {
+	if ctx == nil {
+		ctx = contextFromDB(db)
+	}
+	if _, ok := scopeFromContext(ctx); !ok {
+		// ctx に Scope が無ければ db（ApplyScope / WithContext 済み）の Scope を引き継ぐ
+		if scope, ok := scopeFromContext(contextFromDB(db)); ok {
+			ctx = WithScopeContext(ctx, scope)
+		}
+	}
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	if _, nested := db.Statement.ConnPool.(gorm.TxCommitter); nested {
+		return withSavepoint(ctx, db, fn)
+	}
+
+	attempts := opts.MaxAttempts
+	if attempts <= 0 {
+		attempts = DefaultTxAttempts
+	}
+	retryIf := opts.RetryIf
+	if retryIf == nil {
+		retryIf = IsRetryableTxError
+	}
+	txOptions := &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}
+	for attempt := 1; ; attempt++ {
+		hooks := &txHooks{}
+		err := db.WithContext(context.WithValue(ctx, txHooksKey{}, hooks)).Transaction(fn, txOptions)
+		if err == nil {
+			hooks.run(ctx)
+			return nil
+		}
+		if attempt >= attempts || !retryIf(err) || ctx.Err() != nil {
+			return err
+		}
+		slog.WarnContext(ctx, "retrying transaction", slog.Int("attempt", attempt), slog.String("error", err.Error()))
+		if err := sleepContext(ctx, txBackoff(opts.Backoff, attempt)); err != nil {
+			return err
+		}
+	}
+}
+
+// withSavepoint は実行中のトランザクションの中でセーブポイントを使って fn を実行する。
+// 成功したときだけ、内側で登録されたコミット後フックを外側へ引き継ぐ。
+func withSavepoint(ctx context.Context, tx *gorm.DB, fn func(tx *gorm.DB) error) error {
+	hooks := &txHooks{}
+	if err := tx.WithContext(context.WithValue(ctx, txHooksKey{}, hooks)).Transaction(fn); err != nil {
+		return err
+	}
+	// 呼び出し側の ctx ではなく、外側の tx が持つ context から親のフックを探す
+	if parent, ok := contextFromDB(tx).Value(txHooksKey{}).(*txHooks); ok {
+		parent.hooks = append(parent.hooks, hooks.hooks...)
+		return nil
+	}
+	// 外側が WithTx でないトランザクションでは、外側のコミットを待てないのでここで実行する
+	hooks.run(ctx)
+	return nil
+}
+
+// AfterCommit は WithTx のコミット後に hook を実行するよう登録する（ロールバック・リトライで捨てられた試行の分は実行されない）。
+// WithTx の外で呼ぶとその場で実行する。hook の panic は記録して握りつぶし、後続の hook は実行される。
+func AfterCommit(tx *gorm.DB, hook func(ctx context.Context)) {
+	ctx := contextFromDB(tx)
+	if hooks, ok := ctx.Value(txHooksKey{}).(*txHooks); ok {
+		hooks.hooks = append(hooks.hooks, hook)
+		return
+	}
+	(&txHooks{hooks: []func(context.Context){hook}}).run(ctx)
+}
+
+func (h *txHooks) run(ctx context.Context) {
+	for _, hook := range h.hooks {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					slog.ErrorContext(ctx, "panic in after-commit hook", slog.Any("recover", r))
+				}
+			}()
+			hook(ctx)
+		}()
+	}
+}
+
+// IsRetryableTxError はトランザクションを最初からやり直せば成功し得る失敗かを返す。
+//   - PostgreSQL: SQLSTATE 40001（serialization_failure）/ 40P01（deadlock_detected）
+//   - MySQL: 1213（ER_LOCK_DEADLOCK）/ 1205（ER_LOCK_WAIT_TIMEOUT）
+//
+// ドライバに依存しないよう、SQLState() メソッド（pgx / lib/pq）と Number フィールド（go-sql-driver/mysql）で判定する。
+func IsRetryableTxError(err error) bool {
+	retryable := false
+	walkErrors(err, func(e error) bool {
+		if state, ok := e.(interface{ SQLState() string }); ok {
+			if code := state.SQLState(); code == "40001" || code == "40P01" {
+				retryable = true
+				return false
+			}
+		}
+		if number, ok := errorNumber(e); ok && (number == 1213 || number == 1205) {
+			retryable = true
+			return false
+		}
+		return true
+	})
+	return retryable
+}
+
+// walkErrors は errors.Unwrap のチェーン（errors.Join を含む）を visit が false を返すまでたどる。
+func walkErrors(err error, visit func(error) bool) bool {
+	for err != nil {
+		if !visit(err) {
+			return false
+		}
+		switch u := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, e := range u.Unwrap() {
+				if !walkErrors(e, visit) {
+					return false
+				}
+			}
+			return true
+		case interface{ Unwrap() error }:
+			err = u.Unwrap()
+		default:
+			return true
+		}
+	}
+	return true
+}
+
+// errorNumber は MySQL のエラー（*mysql.MySQLError）の Number フィールドを取り出す。
+func errorNumber(err error) (uint64, bool) {
+	v := reflect.ValueOf(err)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	field := v.FieldByName("Number")
+	switch field.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return field.Uint(), true
+	default:
+		return 0, false
+	}
+}
+
+func txBackoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		base = defaultTxBackoff
+	}
+	d := base << (attempt - 1)
+	if d > maxTxBackoff || d <= 0 {
+		d = maxTxBackoff
+	}
+	// 同時にぶつかった処理が同じ間隔で再衝突しないよう、半分〜全体の範囲でゆらす
+	return d/2 + rand.N(d/2+1)
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
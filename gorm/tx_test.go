@@ -0,0 +1,201 @@
+package gw_gorm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// pgError は pgx / lib/pq のエラーと同じく SQLState() を持つ
+type pgError struct{ code string }
+
+func (e *pgError) Error() string    { return "pg error " + e.code }
+func (e *pgError) SQLState() string { return e.code }
+
+// mysqlError は go-sql-driver/mysql の MySQLError と同じく Number を持つ
+type mysqlError struct {
+	Number  uint16
+	Message string
+}
+
+func (e *mysqlError) Error() string { return fmt.Sprintf("Error %d: %s", e.Number, e.Message) }
+
+func TestIsRetryableTxError(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&pgError{"40001"}, true},
+		{&pgError{"40P01"}, true},
+		{fmt.Errorf("wrapped: %w", &pgError{"40001"}), true},
+		{errors.Join(errors.New("other"), &mysqlError{Number: 1213}), true},
+		{&mysqlError{Number: 1205}, true},
+		{&pgError{"23505"}, false},
+		{&mysqlError{Number: 1062}, false},
+		{errors.New("deadlock"), false},
+		{nil, false},
+	}
+	for _, c := range cases {
+		if got := IsRetryableTxError(c.err); got != c.want {
+			t.Errorf("%v: got %v", c.err, got)
+		}
+	}
+}
+
+func countTodos(t *testing.T, db *gorm.DB) int64 {
+	t.Helper()
+	var count int64
+	if err := BypassTenantGuard(db).Model(&guardedTodo{}).Count(&count).Error; err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestWithTxRetriesAndRunsHooksOnce(t *testing.T) {
+	db := openTransactionTestDB(t)
+	ctx := WithScopeContext(context.Background(), singleScope())
+
+	attempts := 0
+	var hooked []string
+	err := WithTx(ctx, db, &TxOptions{Backoff: time.Millisecond}, func(tx *gorm.DB) error {
+		attempts++
+		// Scope が引き継がれ、tenant_id が自動でセットされる
+		if err := tx.Create(&guardedTodo{Id: fmt.Sprintf("todo-%d", attempts), OrganizationId: "o1"}).Error; err != nil {
+			return err
+		}
+		AfterCommit(tx, func(context.Context) { hooked = append(hooked, fmt.Sprintf("attempt-%d", attempts)) })
+		if attempts == 1 {
+			return fmt.Errorf("update: %w", &pgError{"40001"})
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Fatalf("attempts=%d err=%v", attempts, err)
+	}
+	var todos []guardedTodo
+	BypassTenantGuard(db).Find(&todos)
+	if len(todos) != 1 || todos[0].Id != "todo-2" || todos[0].TenantId != "t1" {
+		t.Fatalf("the failed attempt must be rolled back: %+v", todos)
+	}
+	if len(hooked) != 1 || hooked[0] != "attempt-2" {
+		t.Fatalf("hooks of the failed attempt must be discarded: %v", hooked)
+	}
+}
+
+func TestWithTxStopsOnPermanentErrorsAndExhaustion(t *testing.T) {
+	db := openTransactionTestDB(t)
+	ctx := WithScopeContext(context.Background(), singleScope())
+
+	permanent := errors.New("validation failed")
+	attempts := 0
+	err := WithTx(ctx, db, nil, func(tx *gorm.DB) error {
+		attempts++
+		AfterCommit(tx, func(context.Context) { t.Error("hook must not run on rollback") })
+		return permanent
+	})
+	if !errors.Is(err, permanent) || attempts != 1 {
+		t.Fatalf("permanent error: attempts=%d err=%v", attempts, err)
+	}
+
+	attempts = 0
+	deadlock := &mysqlError{Number: 1213, Message: "Deadlock found"}
+	err = WithTx(ctx, db, &TxOptions{MaxAttempts: 3, Backoff: time.Millisecond}, func(tx *gorm.DB) error {
+		attempts++
+		return deadlock
+	})
+	if !errors.Is(err, deadlock) || attempts != 3 {
+		t.Fatalf("exhausted: attempts=%d err=%v", attempts, err)
+	}
+
+	// キャンセルされた context では待たずに終わる
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	attempts = 0
+	_ = WithTx(canceled, db, &TxOptions{Backoff: time.Hour}, func(tx *gorm.DB) error {
+		attempts++
+		return deadlock
+	})
+	if attempts > 1 {
+		t.Fatalf("canceled context must not retry: attempts=%d", attempts)
+	}
+}
+
+func TestWithTxNestedSavepoint(t *testing.T) {
+	db := openTransactionTestDB(t)
+	ctx := WithScopeContext(context.Background(), singleScope())
+
+	var hooked []string
+	inner := errors.New("inner failed")
+	err := WithTx(ctx, db, nil, func(tx *gorm.DB) error {
+		if err := tx.Create(&guardedTodo{Id: "outer", OrganizationId: "o1"}).Error; err != nil {
+			return err
+		}
+		AfterCommit(tx, func(context.Context) { hooked = append(hooked, "outer") })
+
+		err := WithTx(ctx, tx, nil, func(tx *gorm.DB) error {
+			if err := tx.Create(&guardedTodo{Id: "inner-failed", OrganizationId: "o1"}).Error; err != nil {
+				return err
+			}
+			AfterCommit(tx, func(context.Context) { hooked = append(hooked, "inner-failed") })
+			return inner
+		})
+		if !errors.Is(err, inner) {
+			return fmt.Errorf("unexpected inner result: %v", err)
+		}
+		return WithTx(ctx, tx, nil, func(tx *gorm.DB) error {
+			AfterCommit(tx, func(context.Context) {
+				if len(hooked) == 0 {
+					t.Error("inner hooks must run after the outer commit")
+				}
+				hooked = append(hooked, "inner-ok")
+			})
+			if len(hooked) != 0 {
+				t.Error("hooks must wait for the outer commit")
+			}
+			return tx.Create(&guardedTodo{Id: "inner-ok", OrganizationId: "o1"}).Error
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := countTodos(t, db); count != 2 {
+		t.Fatalf("only the failed savepoint must be rolled back: count=%d", count)
+	}
+	if len(hooked) != 2 || hooked[0] != "outer" || hooked[1] != "inner-ok" {
+		t.Fatalf("hooks=%v", hooked)
+	}
+
+	// WithTx の外の AfterCommit はその場で実行する
+	ran := false
+	AfterCommit(db.WithContext(ctx), func(context.Context) { ran = true })
+	if !ran {
+		t.Fatal("hook outside a transaction must run immediately")
+	}
+}
+
+func TestWithTxKeepsScopeOfDB(t *testing.T) {
+	db := openTransactionTestDB(t)
+	for name, scoped := range map[string]*gorm.DB{
+		"ApplyScope":  ApplyScope(db, singleScope()),
+		"WithContext": db.WithContext(WithScopeContext(context.Background(), singleScope())),
+	} {
+		id := "scoped-" + name
+		err := WithTx(context.Background(), scoped, nil, func(tx *gorm.DB) error {
+			if err := tx.Create(&guardedTodo{Id: id, OrganizationId: "o1", Title: "x"}).Error; err != nil {
+				return err
+			}
+			var todos []guardedTodo
+			return tx.Find(&todos).Error
+		})
+		if err != nil {
+			t.Fatalf("%s: the scope of db must be kept when ctx has none: %v", name, err)
+		}
+	}
+	if count := countTodos(t, db); count != 2 {
+		t.Fatalf("count=%d", count)
+	}
+}
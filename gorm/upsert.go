@@ -0,0 +1,126 @@
+package gw_gorm
+
+// このファイルは Repository.Upsert などが使う UPSERT（INSERT ... ON CONFLICT）の句の組み立てを置く。
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// upsertProtectedColumns は衝突した既存の行で書き換えないカラム。
+// Scope のカラムを書き換えると別テナント・別組織の行を乗っ取れるため、作成者と version も既存の行の値を残す。
+var upsertProtectedColumns = map[string]bool{
+	"tenant_id":       true,
+	"organization_id": true,
+	"created_by":      true,
+	"version":         true,
+}
+
+// upsertClause は衝突先と更新するカラムを検証して ON CONFLICT 句を返す。
+// updateColumns が空なら主キー・衝突先・created_at・upsertProtectedColumns 以外の全カラムを更新する。
+//
+// MySQL の ON DUPLICATE KEY UPDATE は衝突先を指定できず、どの一意キー（別テナントの行の主キーを含む）の重複でも更新が走る。
+// そのため Scope のあるモデルでは、各カラムを col = IF(tenant_id = VALUES(tenant_id), VALUES(col), col) のように
+// 既存の行の Scope が一致するときだけ書き換える（一致しない行は変わらない）。
+func upsertClause(s *schema.Schema, dialect string, conflictColumns, updateColumns []string) (clause.OnConflict, error) {
+	if len(conflictColumns) == 0 {
+		if s.PrioritizedPrimaryField == nil {
+			return clause.OnConflict{}, errors.New("upsert requires conflict columns or a primary key")
+		}
+		conflictColumns = []string{s.PrioritizedPrimaryField.DBName}
+	}
+	onConflict := clause.OnConflict{}
+	names := map[string]bool{}
+	for _, name := range conflictColumns {
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return clause.OnConflict{}, fmt.Errorf("unknown conflict column %q", name)
+		}
+		onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+		names[field.DBName] = true
+	}
+	var scopeColumns []string
+	if implementsTenantScoped(s) {
+		if !names["tenant_id"] {
+			return clause.OnConflict{}, errors.New("upsert of a tenant scoped model must include tenant_id in the conflict columns")
+		}
+		scopeColumns = append(scopeColumns, "tenant_id")
+	}
+	if implementsOrgScoped(s) {
+		if !names["organization_id"] {
+			return clause.OnConflict{}, errors.New("upsert of an organization scoped model must include organization_id in the conflict columns")
+		}
+		scopeColumns = append(scopeColumns, "organization_id")
+	}
+
+	var columns []string
+	if len(updateColumns) == 0 {
+		for _, field := range s.Fields {
+			if field.DBName == "" || !field.Creatable || !field.Updatable || field.PrimaryKey || field.AutoCreateTime > 0 ||
+				names[field.DBName] || upsertProtectedColumns[field.DBName] {
+				continue
+			}
+			if field.HasDefaultValue && field.DefaultValueInterface == nil && !strings.EqualFold(field.DefaultValue, "NULL") {
+				// DB 側で値を決めるカラム（GORM の UpdateAll と同じく対象外）
+				continue
+			}
+			columns = append(columns, field.DBName)
+		}
+	}
+	for _, name := range updateColumns {
+		field := s.LookUpField(name)
+		if field == nil || field.DBName == "" {
+			return clause.OnConflict{}, fmt.Errorf("unknown update column %q", name)
+		}
+		if field.PrimaryKey || names[field.DBName] {
+			return clause.OnConflict{}, fmt.Errorf("conflict column %q cannot be updated", name)
+		}
+		if upsertProtectedColumns[field.DBName] {
+			return clause.OnConflict{}, fmt.Errorf("column %q cannot be updated by upsert", name)
+		}
+		columns = append(columns, field.DBName)
+	}
+	if len(columns) == 0 {
+		// 更新するカラムが無ければ重複した行はそのまま残す
+		onConflict.DoNothing = true
+		return onConflict, nil
+	}
+
+	guarded := dialect == "mysql" && len(scopeColumns) > 0
+	for _, column := range columns {
+		var value any = clause.Column{Table: "excluded", Name: column}
+		if guarded {
+			value = guardedAssignment(scopeColumns, clause.Expr{SQL: "VALUES(?)", Vars: []any{clause.Column{Name: column}}}, column)
+		}
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{Column: clause.Column{Name: column}, Value: value})
+	}
+	if implements[VersionedModel](s) && s.LookUpField("version") != nil {
+		// 既存の行の version から +1 する（読み込み時の version による楽観ロックは行わない）
+		var value any = clause.Expr{SQL: "? + 1", Vars: []any{clause.Column{Table: clause.CurrentTable, Name: "version"}}}
+		if guarded {
+			value = guardedAssignment(scopeColumns, clause.Expr{SQL: "? + 1", Vars: []any{clause.Column{Name: "version"}}}, "version")
+		}
+		onConflict.DoUpdates = append(onConflict.DoUpdates, clause.Assignment{Column: clause.Column{Name: "version"}, Value: value})
+	}
+	return onConflict, nil
+}
+
+// guardedAssignment は既存の行の scopeColumns が挿入しようとした値と一致するときだけ value、違えば元の値にする MySQL の式を返す。
+func guardedAssignment(scopeColumns []string, value clause.Expr, column string) clause.Expr {
+	sql := "IF("
+	vars := []any{}
+	for i, scopeColumn := range scopeColumns {
+		if i > 0 {
+			sql += " AND "
+		}
+		sql += "? = VALUES(?)"
+		vars = append(vars, clause.Column{Name: scopeColumn}, clause.Column{Name: scopeColumn})
+	}
+	sql += ", ?, ?)"
+	vars = append(vars, value, clause.Column{Name: column})
+	return clause.Expr{SQL: sql, Vars: vars}
+}
@@ -0,0 +1,137 @@
+package gw_gorm
+
+// このファイルは version カラムによる楽観ロック（Versioned / UseOptimisticLock）を置く。
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrStaleObject は読み込んだ後に他の更新が入っていたことを表す。errors.Is で判定する。
+var ErrStaleObject = errors.New("stale object")
+
+// StaleObjectError は楽観ロックで更新できなかった行の情報。Unwrap で ErrStaleObject を返す。
+type StaleObjectError struct {
+	Table   string
+	Id      any
+	Version int64
+}
+
+func (e *StaleObjectError) Error() string {
+	return fmt.Sprintf("stale object: %s id=%v version=%d was updated by another operation", e.Table, e.Id, e.Version)
+}
+
+func (e *StaleObjectError) Unwrap() error { return ErrStaleObject }
+
+// VersionedModel は楽観ロック対象のマーカー。Versioned を埋め込めば実装される。
+type VersionedModel interface{ OptimisticLocked() }
+
+// Versioned は楽観ロック用の version カラム。BaseModel などと並べて埋め込む。
+type Versioned struct {
+	Version int64 `gorm:"not null;default:1" json:"version"`
+}
+
+func (Versioned) OptimisticLocked() {}
+
+const versionCheckedKey = "gw_gorm:version_checked"
+
+// UseOptimisticLock は VersionedModel の更新に楽観ロックを掛ける。
+//   - Create: Version が 0 なら 1 をセット
+//   - Update: 読み込んだ struct の Version を条件（WHERE version = ?）にし、version を +1 する。
+//     0 行更新なら *StaleObjectError を返し、Save の upsert へのフォールバックも起きない
+//   - Model(&T{}).Where(...).Updates(map) のように Version を持たない更新は、条件を付けずに version = version + 1 だけ行う
+//     （Version が 0 の struct を渡す Updates(struct) は対象外）
+func UseOptimisticLock(db *gorm.DB) error {
+	callbacks := db.Callback()
+	if callbacks.Create().Get("gw_gorm:version_create") == nil {
+		if err := callbacks.Create().Before("gorm:create").Register("gw_gorm:version_create", versionCreate); err != nil {
+			return err
+		}
+	}
+	if callbacks.Update().Get("gw_gorm:version_update") == nil {
+		if err := callbacks.Update().Before("gorm:update").Register("gw_gorm:version_update", versionUpdate); err != nil {
+			return err
+		}
+	}
+	if callbacks.Update().Get("gw_gorm:version_check") == nil {
+		if err := callbacks.Update().After("gorm:update").Before("gorm:after_update").Register("gw_gorm:version_check", versionCheck); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isVersioned(db *gorm.DB) bool {
+	return db.Error == nil && db.Statement != nil && db.Statement.Schema != nil &&
+		implements[VersionedModel](db.Statement.Schema) && db.Statement.Schema.LookUpField("version") != nil && !isInternalWrite(db)
+}
+
+func versionCreate(db *gorm.DB) {
+	if !isVersioned(db) {
+		return
+	}
+	field := db.Statement.Schema.LookUpField("version")
+	applyToReflectValues(db.Statement, func(v reflect.Value) {
+		if _, isZero := field.ValueOf(db.Statement.Context, v); isZero {
+			db.AddError(field.Set(db.Statement.Context, v, int64(1)))
+		}
+	})
+}
+
+func versionUpdate(db *gorm.DB) {
+	if !isVersioned(db) {
+		return
+	}
+	stmt := db.Statement
+	version, ok := currentVersion(stmt)
+	if !ok {
+		if _, isMap := stmt.Dest.(map[string]any); isMap {
+			stmt.SetColumn("version", gorm.Expr("version + ?", 1), true)
+		}
+		return
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "version"}, Value: version},
+	}})
+	stmt.SetColumn("version", version+1, true)
+	db.InstanceSet(versionCheckedKey, version)
+}
+
+// currentVersion は更新対象の struct が読み込み時に持っていた Version を返す。
+func currentVersion(stmt *gorm.Statement) (int64, bool) {
+	v := stmt.ReflectValue
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return 0, false
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return 0, false
+	}
+	value, isZero := stmt.Schema.LookUpField("version").ValueOf(stmt.Context, v)
+	version, ok := value.(int64)
+	if isZero || !ok {
+		return 0, false
+	}
+	return version, true
+}
+
+func versionCheck(db *gorm.DB) {
+	checked, ok := db.InstanceGet(versionCheckedKey)
+	if !ok || db.Error != nil || db.DryRun || db.RowsAffected != 0 {
+		return
+	}
+	version, _ := checked.(int64)
+	var id any
+	if field := db.Statement.Schema.PrioritizedPrimaryField; field != nil && db.Statement.ReflectValue.Kind() == reflect.Struct {
+		id, _ = field.ValueOf(db.Statement.Context, db.Statement.ReflectValue)
+	}
+	// 更新できなかったので、呼び出し側の struct の Version を読み込み時の値に戻す
+	db.Statement.SetColumn("version", version, true)
+	db.AddError(&StaleObjectError{Table: db.Statement.Table, Id: id, Version: version})
+}
@@ -0,0 +1,98 @@
+package gw_gorm
+
+import (
+	"errors"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+type versionedDoc struct {
+	BaseModelUlid
+	Versioned
+	Title string
+}
+
+func openVersionTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db := openTransactionTestDB(t)
+	if err := UseOptimisticLock(db); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&versionedDoc{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestOptimisticLockDetectsConcurrentUpdate(t *testing.T) {
+	db := openVersionTestDB(t)
+	doc := versionedDoc{Title: "draft"}
+	if err := db.Create(&doc).Error; err != nil {
+		t.Fatal(err)
+	}
+	if doc.Version != 1 {
+		t.Fatalf("version after create=%d", doc.Version)
+	}
+
+	// 2つのタブが同じ version を読み込む
+	var tabA, tabB versionedDoc
+	db.First(&tabA, "id = ?", doc.Id)
+	db.First(&tabB, "id = ?", doc.Id)
+
+	if err := db.Model(&tabA).Update("title", "from A").Error; err != nil {
+		t.Fatal(err)
+	}
+	if tabA.Version != 2 {
+		t.Fatalf("version after update=%d", tabA.Version)
+	}
+
+	tabB.Title = "from B"
+	err := db.Save(&tabB).Error
+	var stale *StaleObjectError
+	if !errors.Is(err, ErrStaleObject) || !errors.As(err, &stale) || stale.Version != 1 || stale.Id != doc.Id {
+		t.Fatalf("stale save must fail: %v", err)
+	}
+	if tabB.Version != 1 {
+		t.Fatalf("failed update must keep the read version: %d", tabB.Version)
+	}
+	var stored versionedDoc
+	db.First(&stored, "id = ?", doc.Id)
+	if stored.Title != "from A" || stored.Version != 2 {
+		t.Fatalf("stored=%+v", stored)
+	}
+	var count int64
+	db.Model(&versionedDoc{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("stale save must not fall back to insert: count=%d", count)
+	}
+
+	// 読み直せば更新できる
+	db.First(&tabB, "id = ?", doc.Id)
+	tabB.Title = "from B"
+	if err := db.Save(&tabB).Error; err != nil || tabB.Version != 3 {
+		t.Fatalf("save after reload: version=%d err=%v", tabB.Version, err)
+	}
+}
+
+func TestOptimisticLockBulkUpdateBumpsVersion(t *testing.T) {
+	db := openVersionTestDB(t)
+	docs := []versionedDoc{{Title: "a"}, {Title: "b"}}
+	if err := db.Create(&docs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Model(&versionedDoc{}).Where("title IN ?", []string{"a", "b"}).Updates(map[string]any{"title": "bulk"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	var stored []versionedDoc
+	db.Order("id").Find(&stored)
+	for _, doc := range stored {
+		if doc.Title != "bulk" || doc.Version != 2 {
+			t.Fatalf("bulk update must bump version: %+v", doc)
+		}
+	}
+	// 古い version の struct での更新は失敗する
+	if err := db.Model(&docs[0]).Update("title", "stale").Error; !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("err=%v", err)
+	}
+}
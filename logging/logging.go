@@ -1,6 +1,6 @@
-// Package gw_log は slog による構造化ロギングと、リクエストID/ユーザーIDの
+// Package gw_log は slog による構造化ロギングと、リクエストID/ユーザーID/テナントIDの
 // context 伝搬を提供する。Init 後は、どの層でも slog.InfoContext(ctx, ...) と
-// 書くだけで request_id / user_id がログへ自動付与される（横ぐし検索の基盤）。
+// 書くだけで request_id / user_id / tenant_id がログへ自動付与される（横ぐし検索の基盤）。
 //
 // 使い方:
 //
@@ -22,6 +22,7 @@ type ctxKey int
 const (
 	requestIdKey ctxKey = iota
 	userIdKey
+	tenantIdKey
 )
 
 // WithRequestId はリクエストIDを context に載せる。
@@ -52,8 +53,23 @@ func UserIdFromContext(ctx context.Context) string {
 	return v
 }
 
+// WithTenantId はリクエストの対象テナントIDを context に載せる（gw_web.TenantResolver が呼ぶ）。
+// 機能フラグの対象判定・outbox の記録など振り分け用の値で、認可には使わない（認可は gw_gorm の Tenant Guard が行う）。
+func WithTenantId(ctx context.Context, tenantId string) context.Context {
+	return context.WithValue(ctx, tenantIdKey, tenantId)
+}
+
+// TenantIdFromContext は context からテナントIDを取り出す（無ければ空文字）。
+func TenantIdFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	v, _ := ctx.Value(tenantIdKey).(string)
+	return v
+}
+
 // contextHandler は slog.Handler をラップし、Handle 時に context から
-// request_id / user_id を読み取って属性として自動付与する。
+// request_id / user_id / tenant_id を読み取って属性として自動付与する。
 // これにより slog.XxxContext 系の呼び出し全てに横ぐしキーが乗る。
 //
 // 横ぐしキーは WithGroup 適用後の logger からのログでも常に**トップレベル**に出る
@@ -82,6 +98,9 @@ func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
 	if uid := UserIdFromContext(ctx); uid != "" {
 		ids = append(ids, slog.String("user_id", uid))
 	}
+	if tid := TenantIdFromContext(ctx); tid != "" {
+		ids = append(ids, slog.String("tenant_id", tid))
+	}
 	if len(ids) == 0 {
 		return h.assembled.Handle(ctx, r)
 	}
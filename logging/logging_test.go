@@ -27,6 +27,7 @@ func TestContextHandlerInjectsRequestIdAndUserId(t *testing.T) {
 
 	ctx := WithRequestId(context.Background(), "req-123")
 	ctx = WithUserId(ctx, "user-456")
+	ctx = WithTenantId(ctx, "tenant-789")
 	logger.InfoContext(ctx, "hello", slog.String("k", "v"))
 
 	m := parseLine(t, buf.String())
@@ -36,6 +37,9 @@ func TestContextHandlerInjectsRequestIdAndUserId(t *testing.T) {
 	if m["user_id"] != "user-456" {
 		t.Errorf("user_id = %v, want user-456", m["user_id"])
 	}
+	if m["tenant_id"] != "tenant-789" {
+		t.Errorf("tenant_id = %v, want tenant-789", m["tenant_id"])
+	}
 	if m["k"] != "v" {
 		t.Errorf("k = %v, want v", m["k"])
 	}
@@ -86,6 +90,9 @@ func TestRequestIdFromContextEmpty(t *testing.T) {
 	if got := UserIdFromContext(nil); got != "" {
 		t.Errorf("got %q, want empty", got)
 	}
+	if got := TenantIdFromContext(nil); got != "" {
+		t.Errorf("got %q, want empty", got)
+	}
 }
 
 func TestInitSetsDefaultAndFormatsUTCTime(t *testing.T) {
@@ -1,7 +1,9 @@
 package gw_models
 
 import (
+	"context"
 	"fmt"
+	gw_log "github.com/generalworksinc/goutil/logging"
 	gw_uuid "github.com/generalworksinc/goutil/uuid"
 	"github.com/google/uuid"
 	"time"
@@ -122,3 +124,64 @@ func (entity *BaseModelSimpleUlid) BeforeInsert() {
 		entity.Id = gw_uuid.GetUlid()
 	}
 }
+
+// /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// 作成者・更新者・削除者。xorm のイベントは context を受け取らないため、保存前に Stamp* を呼んでユーザーIDを埋める。
+type Actors struct {
+	CreatedBy string `xorm:"varchar(64)" json:"createdBy"`
+	UpdatedBy string `xorm:"varchar(64)" json:"updatedBy"`
+}
+
+// StampCreate は context のユーザーIDを created_by / updated_by にセットする（明示済みの値は上書きしない）。
+func (entity *Actors) StampCreate(ctx context.Context) {
+	userId := gw_log.UserIdFromContext(ctx)
+	if userId == "" {
+		return
+	}
+	if entity.CreatedBy == "" {
+		entity.CreatedBy = userId
+	}
+	if entity.UpdatedBy == "" {
+		entity.UpdatedBy = userId
+	}
+}
+
+// StampUpdate は context のユーザーIDを updated_by にセットする。Cols で列を絞る場合は updated_by も含めること。
+func (entity *Actors) StampUpdate(ctx context.Context) {
+	if userId := gw_log.UserIdFromContext(ctx); userId != "" {
+		entity.UpdatedBy = userId
+	}
+}
+
+type ActorsLogicalDel struct {
+	Actors    `xorm:"extends"`
+	DeletedBy string `xorm:"varchar(64)" json:"deletedBy"`
+}
+
+// StampDelete は context のユーザーIDを deleted_by にセットする。
+// xorm の論理削除は deleted 列しか更新しないため、Delete の前に Cols("deleted_by").Update で保存しておく。
+func (entity *ActorsLogicalDel) StampDelete(ctx context.Context) {
+	if userId := gw_log.UserIdFromContext(ctx); userId != "" {
+		entity.DeletedBy = userId
+	}
+}
+
+type BaseModelWithActors struct {
+	BaseModel `xorm:"extends"`
+	Actors    `xorm:"extends"`
+}
+
+type BaseModelLogicalDelWithActors struct {
+	BaseModelLogicalDel `xorm:"extends"`
+	ActorsLogicalDel    `xorm:"extends"`
+}
+
+type BaseModelUlidWithActors struct {
+	BaseModelUlid `xorm:"extends"`
+	Actors        `xorm:"extends"`
+}
+
+type BaseModelLogicalDelUlidWithActors struct {
+	BaseModelLogicalDelUlid `xorm:"extends"`
+	ActorsLogicalDel        `xorm:"extends"`
+}
@@ -1,6 +1,11 @@
 package gw_models
 
-import "testing"
+import (
+	"context"
+	"testing"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+)
 
 func TestBeforeInsertUUID(t *testing.T) {
 	b := &BaseModel{}
@@ -17,3 +22,29 @@ func TestBeforeInsertUlid(t *testing.T) {
 		t.Fatalf("ulid not set")
 	}
 }
+
+func TestActorsStamp(t *testing.T) {
+	alice := gw_log.WithUserId(context.Background(), "alice")
+	m := &BaseModelLogicalDelUlidWithActors{}
+	m.CreatedBy = "system"
+	m.StampCreate(alice)
+	m.BeforeInsert()
+	if m.Id == "" || m.CreatedBy != "system" || m.UpdatedBy != "alice" {
+		t.Fatalf("created=%+v", m)
+	}
+
+	bob := gw_log.WithUserId(context.Background(), "bob")
+	m.StampUpdate(bob)
+	m.StampDelete(bob)
+	if m.UpdatedBy != "bob" || m.DeletedBy != "bob" {
+		t.Fatalf("updated=%+v", m)
+	}
+
+	// ユーザーの無い context では触らない
+	a := &BaseModelWithActors{}
+	a.StampCreate(context.Background())
+	a.StampUpdate(context.Background())
+	if a.CreatedBy != "" || a.UpdatedBy != "" {
+		t.Fatalf("batch=%+v", a)
+	}
+}
@@ -0,0 +1,44 @@
+package gw_mongo
+
+// このファイルはリクエストの context への Client の保存と、context 付きの Database の取り出しを置く。
+
+import (
+	"context"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+)
+
+type clientContextKey struct{}
+
+// WithClient は c を context に保存する。リクエスト開始時のミドルウェア（gw_web.Databases）で呼ぶ。
+func WithClient(ctx context.Context, c *Client) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, clientContextKey{}, c)
+}
+
+// ClientFromContext は WithClient で保存した Client を返す。
+func ClientFromContext(ctx context.Context) (*Client, error) {
+	if ctx == nil {
+		return nil, gw_errors.New("mongo client is not set in context")
+	}
+	c, ok := ctx.Value(clientContextKey{}).(*Client)
+	if !ok || c == nil {
+		return nil, gw_errors.New("mongo client is not set in context")
+	}
+	return c, nil
+}
+
+// DatabaseFromContext は WithClient で保存した Client の Database を ctx 付き（WithContext(ctx)）で返す。
+// ctx の deadline / キャンセルが OperationTimeout より優先して各操作に効く。
+func DatabaseFromContext[T Model](ctx context.Context) (*Database[T], error) {
+	c, err := ClientFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return NewDatabase[T](c).WithContext(ctx), nil
+}
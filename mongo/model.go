@@ -35,3 +35,9 @@ type BaseModelUUIDSimple struct {
 	//idは自動的にprimary keyに設定される（※UUIDをセット）
 	ID string `json:"id" bson:"_id,omitempty"`
 }
+
+// Versioned は楽観ロック用の version フィールド。BaseModel と並べて inline で埋め込む。
+// UpdateOne / UpsertOne は読み込んだ Version を条件にして +1 し、一致しなければ ErrStaleObject を返す。
+type Versioned struct {
+	Version int64 `json:"version" bson:"version"`
+}
@@ -55,6 +55,7 @@ type Database[T Model] struct {
 	session          *Session
 	idValue          interface{} // 条件filterに `_id` を追加するための値
 	operationTimeout time.Duration
+	ctx              context.Context // 操作の親context（リクエストのdeadline・キャンセルを引き継ぐ）
 }
 
 func NewClient(conf Config) (*Client, error) {
@@ -179,6 +180,15 @@ func (db *Database[T]) Session(session *Session) *Database[T] {
 	return db
 }
 
+// WithContext は以降の操作の親 context を設定する。
+// リクエストの context を渡すと、その deadline / キャンセルが OperationTimeout より優先して効く。
+// 呼ばなければ context.Background() の OperationTimeout だけで動く。
+// gw_web.Databases でリクエストの context に Client を載せ、DatabaseFromContext で取り出せば自動で設定される。
+func (db *Database[T]) WithContext(ctx context.Context) *Database[T] {
+	db.ctx = ctx
+	return db
+}
+
 func (db *Database[T]) Id(id string) *Database[T] {
 	if modelUsesStringID[T]() {
 		db.idValue = id
@@ -226,12 +236,30 @@ func (db *Database[T]) UpdateOne(filter interface{}, update interface{}, opts ..
 	if err != nil {
 		return 0, gw_errors.Wrap(err)
 	}
+	updateDoc := bson.D{{Key: "$set", Value: updateVal}}
+	var expectedVersion int64
+	if modelIsVersioned[T]() {
+		// 楽観ロック: 読み込み時の version を条件にし、version は $inc で上げる
+		updateVal, expectedVersion = splitVersion(updateVal)
+		if expectedVersion > 0 {
+			condFilter = withVersion(condFilter, expectedVersion)
+		}
+		updateDoc = bson.D{{Key: "$set", Value: updateVal}, {Key: "$inc", Value: bson.D{{Key: versionKey, Value: 1}}}}
+	}
 	ctx, cancel := db.operationContext()
 	defer cancel()
-	result, err := collection.UpdateOne(ctx, condFilter, bson.D{{"$set", updateVal}}, opts...)
+	result, err := collection.UpdateOne(ctx, condFilter, updateDoc, opts...)
 	if err != nil {
 		return 0, gw_errors.Wrap(err)
 	}
+	if expectedVersion > 0 {
+		if result.MatchedCount == 0 {
+			return 0, gw_errors.Wrap(ErrStaleObject)
+		}
+		if t, ok := update.(*T); ok {
+			versionField(t).SetInt(expectedVersion + 1)
+		}
+	}
 	return result.ModifiedCount, nil
 }
 
@@ -240,6 +268,8 @@ func (db *Database[T]) UpdateOne(filter interface{}, update interface{}, opts ..
 // →指定したカラムに加えて、updatedAtを強制的に更新する
 // 更新対象のカラムが指定されていない場合
 // → 全カラムが対象、ただし値が初期値（Zero）のカラムは、更新対象にしない
+// Versioned を埋め込んだモデルは entity の Version を条件にし（0 なら条件なし）、一致する document が無ければ
+// insert せず ErrStaleObject を返す
 func (db *Database[T]) UpsertOne(entity *T, filter interface{}, updateFields []string, opts ...*options.FindOneAndUpdateOptions) (*T, error) {
 	collection := db.database.Collection(collectionName[T]())
 	idValue, err := applyBaseModelFields(entity, nil, false, true)
@@ -285,12 +315,29 @@ func (db *Database[T]) UpsertOne(entity *T, filter interface{}, updateFields []s
 		return nil, gw_errors.Wrap(err)
 	}
 
+	updateDoc := bson.D{{Key: "$set", Value: updateParams}}
+	var expectedVersion int64
+	if modelIsVersioned[T]() {
+		expectedVersion = versionField(entity).Int()
+		setParams, _ := splitVersion(updateParams)
+		updateDoc = bson.D{{Key: "$set", Value: setParams}, {Key: "$inc", Value: bson.D{{Key: versionKey, Value: 1}}}}
+		if expectedVersion > 0 {
+			condFilter = withVersion(condFilter, expectedVersion)
+		}
+	}
+
 	ctx, cancel := db.operationContext()
 	defer cancel()
-	result := collection.FindOneAndUpdate(ctx, condFilter, bson.D{{"$set", updateParams}}, opts...)
+	result := collection.FindOneAndUpdate(ctx, condFilter, updateDoc, opts...)
 	if err := result.Err(); err == nil {
+		if expectedVersion > 0 {
+			versionField(entity).SetInt(expectedVersion + 1)
+		}
 		return entity, nil
 	} else if errors.Is(err, mongo.ErrNoDocuments) {
+		if expectedVersion > 0 {
+			return nil, gw_errors.Wrap(ErrStaleObject)
+		}
 		// データが存在しないので、insert処理を行う
 		if _, updateErr := applyBaseModelFields(entity, nil, true, true); updateErr != nil {
 			return nil, gw_errors.Wrap(updateErr)
@@ -354,6 +401,9 @@ func (db *Database[T]) InsertOne(entity *T, opts ...*options.InsertOneOptions) (
 	if _, err := applyBaseModelFields(entity, nil, true, true); err != nil {
 		return nil, gw_errors.Wrap(err)
 	}
+	if modelIsVersioned[T]() && versionField(entity).Int() == 0 {
+		versionField(entity).SetInt(1)
+	}
 	ctx, cancel := db.operationContext()
 	defer cancel()
 	result, err := collection.InsertOne(ctx, entity, opts...)
@@ -367,7 +417,11 @@ func (db *Database[T]) InsertOne(entity *T, opts ...*options.InsertOneOptions) (
 }
 
 func (db *Database[T]) operationContext() (context.Context, context.CancelFunc) {
-	ctx, cancel := context.WithTimeout(context.Background(), db.operationTimeout)
+	parent := db.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, db.operationTimeout)
 	if db.session == nil {
 		return ctx, cancel
 	}
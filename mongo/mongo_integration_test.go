@@ -2,6 +2,7 @@ package gw_mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
@@ -10,6 +11,7 @@ import (
 	"testing"
 	"time"
 
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
 	"go.mongodb.org/mongo-driver/bson"
@@ -143,6 +145,96 @@ func TestMongoIntegration_StringIDCRUD(t *testing.T) {
 	}
 }
 
+type itVersionedModel struct {
+	BaseModel `bson:",inline"`
+	Versioned `bson:",inline"`
+	Name      string `bson:"name"`
+}
+
+func (itVersionedModel) StructName() string {
+	return "goutilMongoItVersioned"
+}
+
+func TestMongoIntegration_OptimisticLock(t *testing.T) {
+	client := mustIntegrationClient(t)
+	inserted, err := NewDatabase[itVersionedModel](client).InsertOne(&itVersionedModel{Name: "alice"})
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	if inserted.Version != 1 {
+		t.Fatalf("version after insert=%d", inserted.Version)
+	}
+	id := inserted.ID.Hex()
+	t.Cleanup(func() {
+		_, _ = NewDatabase[itVersionedModel](client).Id(id).DeleteOne(nil)
+	})
+
+	// 2つのタブが同じ version を読み込む
+	tabA, _ := NewDatabase[itVersionedModel](client).Id(id).FindOne(nil)
+	tabB, _ := NewDatabase[itVersionedModel](client).Id(id).FindOne(nil)
+
+	tabA.Name = "from A"
+	if _, err := NewDatabase[itVersionedModel](client).Id(id).UpdateOne(nil, tabA); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if tabA.Version != 2 {
+		t.Fatalf("version after update=%d", tabA.Version)
+	}
+
+	tabB.Name = "from B"
+	if _, err := NewDatabase[itVersionedModel](client).UpsertOne(tabB, nil, []string{"name"}); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("stale upsert must fail: %v", err)
+	}
+	if _, err := NewDatabase[itVersionedModel](client).Id(id).UpdateOne(nil, bson.D{{Key: "name", Value: "from B"}, {Key: "version", Value: int64(1)}}); !errors.Is(err, ErrStaleObject) {
+		t.Fatalf("stale update must fail: %v", err)
+	}
+
+	found, _ := NewDatabase[itVersionedModel](client).Id(id).FindOne(nil)
+	if found == nil || found.Name != "from A" || found.Version != 2 {
+		t.Fatalf("unexpected document: %#v", found)
+	}
+	count, _ := client.database.Collection("goutil_mongo_it_versioned").CountDocuments(context.Background(), bson.D{})
+	if count != 1 {
+		t.Fatalf("stale upsert must not insert: count=%d", count)
+	}
+}
+
+func TestMongoIntegration_FindPage(t *testing.T) {
+	client := mustIntegrationClient(t)
+	gw_pagination.SetCursorKey([]byte("it-cursor-key"))
+	tag := "page-" + strconv.FormatInt(time.Now().UnixNano(), 10)
+	var ids []string
+	for i := 0; i < 5; i++ {
+		inserted, err := NewDatabase[itObjectModel](client).InsertOne(&itObjectModel{Name: tag})
+		if err != nil {
+			t.Fatalf("insert failed: %v", err)
+		}
+		ids = append(ids, inserted.ID.Hex())
+	}
+	t.Cleanup(func() {
+		_, _ = client.database.Collection("goutil_mongo_it_object").DeleteMany(context.Background(), bson.D{{Key: "name", Value: tag}})
+	})
+
+	req := gw_pagination.PageRequest{Limit: 2, Sort: []gw_pagination.SortField{{Column: "_id", Desc: true}}}
+	var got []string
+	for {
+		page, err := NewDatabase[itObjectModel](client).FindPage(bson.D{{Key: "name", Value: tag}}, req)
+		if err != nil {
+			t.Fatalf("find page failed: %v", err)
+		}
+		for _, item := range page.Items {
+			got = append(got, item.ID.Hex())
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+	if len(got) != 5 || got[0] != ids[4] || got[4] != ids[0] {
+		t.Fatalf("pages=%v ids=%v", got, ids)
+	}
+}
+
 func mustIntegrationClient(t *testing.T) *Client {
 	t.Helper()
 
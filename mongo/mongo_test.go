@@ -1,6 +1,7 @@
 package gw_mongo
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -216,3 +217,52 @@ func dToMap(d primitive.D) map[string]interface{} {
 	}
 	return m
 }
+
+func TestOperationContextInheritsRequestContext(t *testing.T) {
+	db := &Database[unitObjectModel]{operationTimeout: time.Minute}
+	ctx, cancel := db.operationContext()
+	deadline, ok := ctx.Deadline()
+	cancel()
+	if !ok || time.Until(deadline) < 50*time.Second {
+		t.Fatalf("operation timeout must apply without parent. deadline=%v ok=%v", deadline, ok)
+	}
+
+	// 親（リクエスト）の deadline が短ければそちらが効く
+	parent, parentCancel := context.WithTimeout(context.WithValue(context.Background(), ctxMarkerKey{}, "req"), time.Second)
+	defer parentCancel()
+	ctx, cancel = db.WithContext(parent).operationContext()
+	defer cancel()
+	deadline, _ = ctx.Deadline()
+	if time.Until(deadline) > 2*time.Second {
+		t.Fatalf("request deadline must win. deadline=%v", deadline)
+	}
+	if ctx.Value(ctxMarkerKey{}) != "req" {
+		t.Fatal("request context values must be inherited")
+	}
+
+	parentCancel()
+	if ctx.Err() == nil {
+		t.Fatal("request cancellation must propagate to the operation")
+	}
+}
+
+type ctxMarkerKey struct{}
+
+func TestDatabaseFromContextUsesRequestDeadline(t *testing.T) {
+	if _, err := DatabaseFromContext[unitObjectModel](context.Background()); err == nil {
+		t.Fatal("missing client must be an error")
+	}
+	client := &Client{operationTimeout: time.Minute}
+	ctx, cancel := context.WithTimeout(WithClient(context.Background(), client), time.Second)
+	defer cancel()
+	db, err := DatabaseFromContext[unitObjectModel](ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opCtx, opCancel := db.operationContext()
+	defer opCancel()
+	want, _ := ctx.Deadline()
+	if got, ok := opCtx.Deadline(); !ok || !got.Equal(want) {
+		t.Fatalf("deadline=%v want %v", got, want)
+	}
+}
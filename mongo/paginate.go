@@ -0,0 +1,122 @@
+package gw_mongo
+
+import (
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// FindPage は req.Sort（bson のキー）の順でカーソル方式のページングを行う。skip は使わない。
+// Sort に _id が含まれなければ _id の昇順を末尾に補う。opts の Sort / Limit / Skip は上書きされる。
+// 不正・改ざん・別のソート順のカーソルは gw_pagination.ErrInvalidCursor。
+func (db *Database[T]) FindPage(filter interface{}, req gw_pagination.PageRequest, opts ...*options.FindOptions) (*gw_pagination.Page[*T], error) {
+	req = req.WithTieBreaker("_id")
+	var cursor *gw_pagination.Cursor
+	if req.Cursor != "" {
+		var err error
+		if cursor, err = gw_pagination.DecodeCursor(req.Sort, req.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	backward := cursor != nil && cursor.Direction == gw_pagination.Prev
+
+	if cursor != nil {
+		keyset, err := keysetFilter[T](req.Sort, cursor.Values, backward)
+		if err != nil {
+			return nil, gw_errors.Wrap(err)
+		}
+		filter = andFilter(filter, keyset)
+	}
+	sort := bson.D{}
+	for _, s := range req.Sort {
+		order := 1
+		if s.Desc != backward {
+			order = -1
+		}
+		sort = append(sort, bson.E{Key: s.Column, Value: order})
+	}
+	pageOpts := options.Find().SetSort(sort).SetLimit(int64(req.PageLimit() + 1)).SetSkip(0)
+	rows, err := db.Find(filter, append(opts, pageOpts)...)
+	if err != nil {
+		return nil, gw_errors.Wrap(err)
+	}
+	return gw_pagination.NewPage(req, cursor, rows, func(row *T) ([]any, error) {
+		return sortValues(row, req.Sort)
+	})
+}
+
+// keysetFilter は「カーソルの行より後ろ」の条件を作る。
+// {a: 1, b: 1} なら {$or: [{a: {$gt: va}}, {a: va, b: {$gt: vb}}]}。降順のキーと逆方向（backward）では比較を反転する。
+func keysetFilter[T Model](sort []gw_pagination.SortField, values []any, backward bool) (bson.D, error) {
+	values = append([]any(nil), values...)
+	for i, s := range sort {
+		// ObjectID はカーソル内では hex 文字列になるため戻す
+		if str, ok := values[i].(string); ok && s.Column == "_id" && !modelUsesStringID[T]() {
+			oid, err := primitive.ObjectIDFromHex(str)
+			if err != nil {
+				return nil, gw_errors.Wrap(gw_pagination.ErrInvalidCursor)
+			}
+			values[i] = oid
+		}
+	}
+	or := bson.A{}
+	for i, s := range sort {
+		term := bson.D{}
+		for j := 0; j < i; j++ {
+			term = append(term, bson.E{Key: sort[j].Column, Value: values[j]})
+		}
+		op := "$gt"
+		if s.Desc != backward {
+			op = "$lt"
+		}
+		term = append(term, bson.E{Key: s.Column, Value: bson.D{{Key: op, Value: values[i]}}})
+		or = append(or, term)
+	}
+	return bson.D{{Key: "$or", Value: or}}, nil
+}
+
+// andFilter は利用者の filter と条件を $and でまとめる（_id の付与は cond が行う）。
+func andFilter(filter interface{}, cond bson.D) interface{} {
+	switch f := filter.(type) {
+	case nil:
+		return cond
+	case primitive.E:
+		return bson.D{{Key: "$and", Value: bson.A{bson.D{f}, cond}}}
+	case primitive.A:
+		return bson.D{{Key: "$and", Value: append(append(bson.A{}, f...), cond)}}
+	default:
+		return bson.D{{Key: "$and", Value: bson.A{f, cond}}}
+	}
+}
+
+func sortValues[T any](row *T, sort []gw_pagination.SortField) ([]any, error) {
+	doc, err := marshalToPrimitiveD(row)
+	if err != nil {
+		return nil, gw_errors.Wrap(err)
+	}
+	fields := dToMapValues(doc)
+	values := make([]any, len(sort))
+	for i, s := range sort {
+		value, ok := fields[s.Column]
+		if !ok {
+			return nil, gw_errors.Errorf("sort key %q is not in the document", s.Column)
+		}
+		if dt, ok := value.(primitive.DateTime); ok {
+			value = dt.Time().In(time.UTC)
+		}
+		values[i] = value
+	}
+	return values, nil
+}
+
+func dToMapValues(d primitive.D) map[string]interface{} {
+	m := make(map[string]interface{}, len(d))
+	for _, e := range d {
+		m[e.Key] = e.Value
+	}
+	return m
+}
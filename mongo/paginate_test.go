@@ -0,0 +1,67 @@
+package gw_mongo
+
+import (
+	"testing"
+	"time"
+
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestKeysetFilter(t *testing.T) {
+	oid := primitive.NewObjectID()
+	sort := []gw_pagination.SortField{{Column: "name", Desc: true}, {Column: "_id"}}
+
+	filter, err := keysetFilter[unitObjectModel](sort, []any{"bob", oid.Hex()}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	or := filter[0].Value.(bson.A)
+	first := or[0].(bson.D)
+	if filter[0].Key != "$or" || len(or) != 2 || first[0].Key != "name" || first[0].Value.(bson.D)[0].Key != "$lt" {
+		t.Fatalf("unexpected filter: %#v", filter)
+	}
+	second := or[1].(bson.D)
+	if second[0].Value != "bob" || second[1].Value.(bson.D)[0].Key != "$gt" || second[1].Value.(bson.D)[0].Value != oid {
+		t.Fatalf("_id must be compared as ObjectID: %#v", second)
+	}
+
+	// 逆方向は比較を反転する
+	filter, _ = keysetFilter[unitObjectModel](sort, []any{"bob", oid.Hex()}, true)
+	if op := filter[0].Value.(bson.A)[0].(bson.D)[0].Value.(bson.D)[0].Key; op != "$gt" {
+		t.Fatalf("backward op=%s", op)
+	}
+	// 文字列IDのモデルはそのまま
+	filter, _ = keysetFilter[unitStringModel]([]gw_pagination.SortField{{Column: "_id"}}, []any{"s1"}, false)
+	if v := filter[0].Value.(bson.A)[0].(bson.D)[0].Value.(bson.D)[0].Value; v != "s1" {
+		t.Fatalf("string id=%#v", v)
+	}
+	if _, err := keysetFilter[unitObjectModel]([]gw_pagination.SortField{{Column: "_id"}}, []any{"broken"}, false); err == nil {
+		t.Fatal("broken object id must be rejected")
+	}
+}
+
+func TestAndFilterAndSortValues(t *testing.T) {
+	cond := bson.D{{Key: "$or", Value: bson.A{}}}
+	if got := andFilter(nil, cond); len(got.(bson.D)) != 1 || got.(bson.D)[0].Key != "$or" {
+		t.Fatalf("nil filter=%#v", got)
+	}
+	got := andFilter(primitive.E{Key: "name", Value: "bob"}, cond).(bson.D)
+	if got[0].Key != "$and" || len(got[0].Value.(bson.A)) != 2 {
+		t.Fatalf("E filter=%#v", got)
+	}
+
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	row := &unitObjectModel{BaseModel: BaseModel{ID: primitive.NewObjectID(), CreatedAt: at}, Name: "bob"}
+	values, err := sortValues(row, []gw_pagination.SortField{{Column: "createdAt"}, {Column: "_id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values[0] != at || values[1] != row.ID {
+		t.Fatalf("values=%#v", values)
+	}
+	if _, err := sortValues(row, []gw_pagination.SortField{{Column: "missing"}}); err == nil {
+		t.Fatal("missing sort key must be an error")
+	}
+}
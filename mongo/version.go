@@ -0,0 +1,89 @@
+package gw_mongo
+
+import (
+	"errors"
+	"reflect"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrStaleObject は読み込んだ後に他の更新が入っていた（version が一致しない）ことを表す。errors.Is で判定する。
+var ErrStaleObject = errors.New("stale object")
+
+const versionKey = "version"
+
+func modelIsVersioned[T any]() bool {
+	modelType := reflect.TypeOf((*T)(nil)).Elem()
+	for modelType.Kind() == reflect.Ptr {
+		modelType = modelType.Elem()
+	}
+	if modelType.Kind() != reflect.Struct {
+		return false
+	}
+	field, ok := modelType.FieldByName("Versioned")
+	return ok && field.Type == reflect.TypeOf(Versioned{})
+}
+
+func versionField[T any](entity *T) reflect.Value {
+	if entity == nil {
+		return reflect.Value{}
+	}
+	return reflect.ValueOf(entity).Elem().FieldByName("Versioned").FieldByName("Version")
+}
+
+// splitVersion は $set の値から version を取り除き、指定されていた値（読み込み時の version）を返す。
+func splitVersion(update interface{}) (interface{}, int64) {
+	var expected int64
+	switch u := update.(type) {
+	case primitive.D:
+		rest := primitive.D{}
+		for _, elem := range u {
+			if elem.Key == versionKey {
+				expected = toInt64(elem.Value)
+				continue
+			}
+			rest = append(rest, elem)
+		}
+		return rest, expected
+	case map[string]interface{}:
+		expected = toInt64(u[versionKey])
+		delete(u, versionKey)
+		return u, expected
+	case primitive.M:
+		expected = toInt64(u[versionKey])
+		delete(u, versionKey)
+		return u, expected
+	default:
+		return update, 0
+	}
+}
+
+// withVersion は条件 filter に version の一致を加える。
+func withVersion(filter interface{}, version int64) interface{} {
+	switch f := filter.(type) {
+	case primitive.D:
+		return append(append(primitive.D{}, f...), primitive.E{Key: versionKey, Value: version})
+	case primitive.E:
+		return bson.D{f, {Key: versionKey, Value: version}}
+	case primitive.M:
+		return bson.D{{Key: "$and", Value: bson.A{f}}, {Key: versionKey, Value: version}}
+	case primitive.A:
+		return bson.D{{Key: "$and", Value: f}, {Key: versionKey, Value: version}}
+	default:
+		return bson.D{{Key: "$and", Value: bson.A{f}}, {Key: versionKey, Value: version}}
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,63 @@
+package gw_mongo
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type unitVersionedModel struct {
+	BaseModel `bson:",inline"`
+	Versioned `bson:",inline"`
+	Name      string `bson:"name"`
+}
+
+func (unitVersionedModel) StructName() string {
+	return "unitVersionedModel"
+}
+
+func TestModelIsVersioned(t *testing.T) {
+	if !modelIsVersioned[unitVersionedModel]() || modelIsVersioned[unitObjectModel]() {
+		t.Fatal("only models embedding Versioned are versioned")
+	}
+	entity := &unitVersionedModel{Versioned: Versioned{Version: 3}}
+	if versionField(entity).Int() != 3 {
+		t.Fatal("version field must be reachable")
+	}
+}
+
+func TestSplitVersion(t *testing.T) {
+	db := &Database[unitVersionedModel]{}
+	val, err := db.buildUpdateValue(&unitVersionedModel{Versioned: Versioned{Version: 2}, Name: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rest, expected := splitVersion(val)
+	if expected != 2 {
+		t.Fatalf("expected version=%d", expected)
+	}
+	if _, exists := dToMap(rest.(primitive.D))["version"]; exists {
+		t.Fatalf("version must be removed from $set: %#v", rest)
+	}
+
+	m, expected := splitVersion(map[string]interface{}{"name": "bob", "version": 5})
+	if expected != 5 || len(m.(map[string]interface{})) != 1 {
+		t.Fatalf("map split=%v expected=%d", m, expected)
+	}
+	if _, expected := splitVersion(bson.M{"name": "carol"}); expected != 0 {
+		t.Fatalf("missing version must be 0: %d", expected)
+	}
+}
+
+func TestWithVersion(t *testing.T) {
+	oid := primitive.NewObjectID()
+	d, ok := withVersion(bson.D{{Key: "_id", Value: oid}}, 4).(bson.D)
+	if !ok || len(d) != 2 || d[1].Key != "version" || d[1].Value != int64(4) {
+		t.Fatalf("unexpected filter: %#v", d)
+	}
+	d, ok = withVersion(bson.M{"name": "alice"}, 4).(bson.D)
+	if !ok || d[0].Key != "$and" || d[1].Key != "version" {
+		t.Fatalf("unexpected filter for M: %#v", d)
+	}
+}
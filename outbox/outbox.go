@@ -0,0 +1,136 @@
+// Package gw_outbox はトランザクショナル・アウトボックスでドメインイベントを確実に配送する。
+//
+// コミット後に直接イベントを送ると、コミットと送信の間でプロセスが落ちたときにイベントが失われる。
+// Enqueue は業務データと同じ gorm トランザクションで outbox_message に1行書き込むだけにし、
+// Relay が別の goroutine（またはプロセス）から未配送の行を読んで Publisher に渡す。
+//   - 業務データがロールバックされればイベントも残らず、コミットされれば必ず配送される
+//   - 配送は at-least-once（配送後の状態更新前に落ちると再送される）。受け手は Message.Id で重複を除く
+//   - 失敗した行はバックオフを空けて再送し、MaxAttempts を超えたら dead（デッドレター）にして止める
+//   - テナントは Enqueue 時の gw_log のテナントIDから記録し、配送時の context にテナントIDと Scope として戻す
+package gw_outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	gw_log "github.com/generalworksinc/goutil/logging"
+	gw_uuid "github.com/generalworksinc/goutil/uuid"
+	"gorm.io/gorm"
+)
+
+// メッセージの状態。
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+	// StatusProcessing は Relay が確保して配送中の状態。NextAttemptAt が確保の期限になる
+	StatusProcessing = "processing"
+)
+
+// Message はアウトボックスのテーブル（outbox_message）。マイグレーションで AutoMigrate に渡す。
+// Relay がテナント横断で読むためテナントガードのマーカーは実装しない。
+type Message struct {
+	Id       string `gorm:"type:varchar(46);primaryKey" json:"id"`
+	TenantId string `gorm:"type:varchar(64);index" json:"tenantId"`
+	Topic    string `gorm:"type:varchar(128)" json:"topic"`
+	// Payload は JSON。Decode で取り出す
+	Payload   string `gorm:"type:text" json:"payload"`
+	ActorId   string `gorm:"type:varchar(64)" json:"actorId"`
+	RequestId string `gorm:"type:varchar(64)" json:"requestId"`
+	Status    string `gorm:"type:varchar(16);index:idx_outbox_message_due,priority:1" json:"status"`
+	// Attempts は失敗した配送の回数
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index:idx_outbox_message_due,priority:2" json:"nextAttemptAt"`
+	LastError     string     `gorm:"type:text" json:"lastError"`
+	CreatedAt     time.Time  `json:"createdAt"`
+	DeliveredAt   *time.Time `json:"deliveredAt"`
+	// LockToken は Relay が確保したときの識別子（processing の間だけ入る）
+	LockToken string `gorm:"type:varchar(46)" json:"-"`
+}
+
+func (Message) TableName() string { return "outbox_message" }
+
+// Decode は Payload を v に復号する。
+func (m *Message) Decode(v any) error {
+	return gw_errors.Wrap(json.Unmarshal([]byte(m.Payload), v))
+}
+
+// Enqueue は tx と同じトランザクションでイベントを outbox_message に書き込む。
+// payload は JSON にする（[]byte / json.RawMessage はそのまま使う）。
+// テナント・操作者・リクエストIDは tx の context の gw_log の値（テナントは gw_web.TenantResolver が載せたもの）を記録する。
+//
+// tx はトランザクション（gw_gorm.WithTx / Transaction の tx）を渡す。トランザクション外の db を渡すと即座に書き込まれ、
+// 業務データとの一貫性は保証されない。
+func Enqueue(tx *gorm.DB, topic string, payload any) error {
+	if topic == "" {
+		return gw_errors.New("outbox topic is required")
+	}
+	var body []byte
+	switch p := payload.(type) {
+	case json.RawMessage:
+		body = p
+	case []byte:
+		body = p
+	default:
+		var err error
+		if body, err = json.Marshal(payload); err != nil {
+			return gw_errors.Wrap(err)
+		}
+	}
+	if !json.Valid(body) {
+		return gw_errors.New("outbox payload must be JSON")
+	}
+	ctx := tx.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	now := tx.NowFunc()
+	message := &Message{
+		Id:            gw_uuid.GetUlid(),
+		TenantId:      gw_log.TenantIdFromContext(ctx),
+		Topic:         topic,
+		Payload:       string(body),
+		ActorId:       gw_log.UserIdFromContext(ctx),
+		RequestId:     gw_log.RequestIdFromContext(ctx),
+		Status:        StatusPending,
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	return gw_errors.Wrap(tx.Session(&gorm.Session{NewDB: true}).Create(message).Error)
+}
+
+// Requeue は dead になったメッセージを再送待ちに戻す（原因を取り除いた後の手動リトライ用）。
+func Requeue(ctx context.Context, db *gorm.DB, ids ...string) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := db.WithContext(ctx).Model(&Message{}).
+		Where("id IN ? AND status = ?", ids, StatusDead).
+		Updates(map[string]any{"status": StatusPending, "attempts": 0, "next_attempt_at": db.NowFunc()})
+	return result.RowsAffected, gw_errors.Wrap(result.Error)
+}
+
+// PurgeDelivered は before より前に配送済みになったメッセージを削除する（定期的に実行してテーブルの肥大を防ぐ）。
+// dead のメッセージは調査用に残す。
+func PurgeDelivered(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	result := db.WithContext(ctx).Where("status = ? AND delivered_at < ?", StatusDelivered, before).Delete(&Message{})
+	return result.RowsAffected, gw_errors.Wrap(result.Error)
+}
+
+// deliveryContext は配送時の context に、Enqueue したときのテナント・操作者・リクエストIDを戻す。
+func deliveryContext(ctx context.Context, message *Message) context.Context {
+	if message.TenantId != "" {
+		ctx = gw_gorm.WithScopeContext(ctx, &gw_gorm.Scope{TenantIds: []string{message.TenantId}})
+		ctx = gw_log.WithTenantId(ctx, message.TenantId)
+	}
+	if message.ActorId != "" {
+		ctx = gw_log.WithUserId(ctx, message.ActorId)
+	}
+	if message.RequestId != "" {
+		ctx = gw_log.WithRequestId(ctx, message.RequestId)
+	}
+	return ctx
+}
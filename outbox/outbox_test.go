@@ -0,0 +1,331 @@
+package gw_outbox
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type orderPlaced struct {
+	OrderId string `json:"orderId"`
+}
+
+type order struct {
+	Id string
+}
+
+func openOutboxTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	config := gw_gorm.DefaultConfig(false)
+	config.Logger = logger.Default.LogMode(logger.Silent)
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+	if err := db.AutoMigrate(&Message{}, &order{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func tenantContext() context.Context {
+	ctx := gw_gorm.WithScopeContext(context.Background(), &gw_gorm.Scope{TenantIds: []string{"t1"}})
+	ctx = gw_log.WithUserId(ctx, "u1")
+	ctx = gw_log.WithTenantId(ctx, "t1")
+	return gw_log.WithRequestId(ctx, "req-1")
+}
+
+func placeOrder(ctx context.Context, db *gorm.DB, id string, fail bool) error {
+	return gw_gorm.WithTx(ctx, db, nil, func(tx *gorm.DB) error {
+		if err := tx.Create(&order{Id: id}).Error; err != nil {
+			return err
+		}
+		if err := Enqueue(tx, "order.placed", orderPlaced{OrderId: id}); err != nil {
+			return err
+		}
+		if fail {
+			return errors.New("payment failed")
+		}
+		return nil
+	})
+}
+
+func TestEnqueueFollowsTransaction(t *testing.T) {
+	db := openOutboxTestDB(t)
+	ctx := tenantContext()
+	if err := placeOrder(ctx, db, "o1", true); err == nil {
+		t.Fatal("expected rollback")
+	}
+	if err := placeOrder(ctx, db, "o2", false); err != nil {
+		t.Fatal(err)
+	}
+	var messages []Message
+	db.Find(&messages)
+	if len(messages) != 1 {
+		t.Fatalf("the rolled back event must not remain: %+v", messages)
+	}
+	m := messages[0]
+	if m.Topic != "order.placed" || m.TenantId != "t1" || m.ActorId != "u1" || m.RequestId != "req-1" || m.Status != StatusPending {
+		t.Fatalf("message=%+v", m)
+	}
+	var payload orderPlaced
+	if err := m.Decode(&payload); err != nil || payload.OrderId != "o2" {
+		t.Fatalf("payload=%+v err=%v", payload, err)
+	}
+
+	if err := Enqueue(db, "", nil); err == nil {
+		t.Fatal("topic is required")
+	}
+	if err := Enqueue(db, "raw", []byte("not json")); err == nil {
+		t.Fatal("payload must be JSON")
+	}
+}
+
+func TestRelayDeliversWithTenantContext(t *testing.T) {
+	db := openOutboxTestDB(t)
+	if err := placeOrder(tenantContext(), db, "o1", false); err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter()
+	var got []string
+	router.Subscribe("order.placed", func(ctx context.Context, m *Message) error {
+		got = append(got, gw_log.TenantIdFromContext(ctx)+"/"+gw_log.UserIdFromContext(ctx)+"/"+gw_log.RequestIdFromContext(ctx))
+		return nil
+	})
+	relay := NewRelay(db, router, nil)
+	if n, err := relay.ProcessBatch(context.Background()); err != nil || n != 1 {
+		t.Fatalf("n=%d err=%v", n, err)
+	}
+	if len(got) != 1 || got[0] != "t1/u1/req-1" {
+		t.Fatalf("delivery context=%v", got)
+	}
+	var m Message
+	db.First(&m)
+	if m.Status != StatusDelivered || m.DeliveredAt == nil {
+		t.Fatalf("message=%+v", m)
+	}
+	// 配送済みは再送しない
+	if n, _ := relay.ProcessBatch(context.Background()); n != 0 || len(got) != 1 {
+		t.Fatalf("delivered message must not be resent: n=%d", n)
+	}
+	if purged, err := PurgeDelivered(context.Background(), db, time.Now().Add(time.Minute)); err != nil || purged != 1 {
+		t.Fatalf("purged=%d err=%v", purged, err)
+	}
+}
+
+func TestRelayRetriesAndDeadLetters(t *testing.T) {
+	db := openOutboxTestDB(t)
+	if err := placeOrder(tenantContext(), db, "o1", false); err != nil {
+		t.Fatal(err)
+	}
+	calls := 0
+	var dead []string
+	publisher := PublisherFunc(func(ctx context.Context, m *Message) error {
+		calls++
+		if calls == 2 {
+			panic("broken publisher")
+		}
+		return errors.New("broker unavailable")
+	})
+	relay := NewRelay(db, publisher, &RelayOptions{
+		MaxAttempts: 3,
+		Backoff:     time.Minute,
+		OnDeadLetter: func(ctx context.Context, m *Message, err error) {
+			dead = append(dead, m.Id)
+		},
+	})
+	now := time.Now()
+	relay.now = func() time.Time { return now }
+
+	relay.ProcessBatch(context.Background())
+	var m Message
+	db.First(&m)
+	if m.Status != StatusPending || m.Attempts != 1 || m.LastError == "" || !m.NextAttemptAt.After(now) {
+		t.Fatalf("first failure must be retried later: %+v", m)
+	}
+	// バックオフ中は配送しない
+	if n, _ := relay.ProcessBatch(context.Background()); n != 0 || calls != 1 {
+		t.Fatalf("message must wait for the backoff: n=%d calls=%d", n, calls)
+	}
+	if d := relay.backoff(2); d != 2*time.Minute {
+		t.Fatalf("backoff=%v", d)
+	}
+
+	now = now.Add(time.Hour)
+	relay.ProcessBatch(context.Background())
+	now = now.Add(time.Hour)
+	relay.ProcessBatch(context.Background())
+	db.First(&m)
+	if m.Status != StatusDead || m.Attempts != 3 || calls != 3 || len(dead) != 1 {
+		t.Fatalf("message must be dead-lettered: %+v calls=%d dead=%v", m, calls, dead)
+	}
+
+	if n, err := Requeue(context.Background(), db, m.Id); err != nil || n != 1 {
+		t.Fatalf("requeue n=%d err=%v", n, err)
+	}
+	db.First(&m)
+	if m.Status != StatusPending || m.Attempts != 0 {
+		t.Fatalf("requeued=%+v", m)
+	}
+}
+
+func TestRelayRunStopsWithContext(t *testing.T) {
+	db := openOutboxTestDB(t)
+	ch := make(chan Message, 1)
+	relay := NewRelay(db, ChannelPublisher(ch), &RelayOptions{PollInterval: time.Hour})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	if err := placeOrder(tenantContext(), db, "o1", false); err != nil {
+		t.Fatal(err)
+	}
+	relay.Wake()
+	select {
+	case m := <-ch:
+		if m.Topic != "order.placed" {
+			t.Fatalf("message=%+v", m)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wake must trigger delivery")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run must return after cancel")
+	}
+}
+
+func TestRelayKeepsDeliveredMessagesWhenBatchStops(t *testing.T) {
+	for _, stop := range []string{"cancel", "update"} {
+		t.Run(stop, func(t *testing.T) {
+			db := openOutboxTestDB(t)
+			for _, id := range []string{"o1", "o2", "o3"} {
+				if err := placeOrder(tenantContext(), db, id, false); err != nil {
+					t.Fatal(err)
+				}
+			}
+			failUpdate := false
+			db.Callback().Update().Before("gorm:update").Register("test:fail_update", func(tx *gorm.DB) {
+				if failUpdate {
+					failUpdate = false
+					tx.AddError(errors.New("connection lost"))
+				}
+			})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			calls := 0
+			publisher := PublisherFunc(func(ctx context.Context, m *Message) error {
+				calls++
+				if calls == 2 {
+					if stop == "cancel" {
+						cancel()
+						return ctx.Err()
+					}
+					failUpdate = true
+				}
+				return nil
+			})
+			relay := NewRelay(db, publisher, nil)
+			if n, err := relay.ProcessBatch(ctx); err == nil || n != 1 {
+				t.Fatalf("n=%d err=%v", n, err)
+			}
+
+			var messages []Message
+			db.Order("next_attempt_at, id").Find(&messages)
+			delivered := 0
+			for _, m := range messages {
+				switch m.Status {
+				case StatusDelivered:
+					delivered++
+				case StatusPending:
+					if m.Attempts != 0 || m.LockToken != "" {
+						t.Fatalf("unsent message must be released without counting a failure: %+v", m)
+					}
+				default:
+					t.Fatalf("message=%+v", m)
+				}
+			}
+			if delivered != 1 || calls != 2 {
+				t.Fatalf("the first message must stay delivered: delivered=%d calls=%d", delivered, calls)
+			}
+		})
+	}
+}
+
+func TestRelayReclaimsExpiredLease(t *testing.T) {
+	db := openOutboxTestDB(t)
+	if err := placeOrder(tenantContext(), db, "o1", false); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	stalled := NewRelay(db, PublisherFunc(func(context.Context, *Message) error { return errors.New("timeout") }), &RelayOptions{Lease: time.Minute})
+	stalled.now = func() time.Time { return now }
+	messages, token, err := stalled.claim(context.Background())
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("messages=%+v err=%v", messages, err)
+	}
+
+	calls := 0
+	relay := NewRelay(db, PublisherFunc(func(context.Context, *Message) error { calls++; return nil }), nil)
+	relay.now = func() time.Time { return now.Add(30 * time.Second) }
+	if n, _ := relay.ProcessBatch(context.Background()); n != 0 {
+		t.Fatal("leased message must not be claimed twice")
+	}
+	relay.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if n, err := relay.ProcessBatch(context.Background()); err != nil || n != 1 || calls != 1 {
+		t.Fatalf("expired lease must be reclaimed: n=%d calls=%d err=%v", n, calls, err)
+	}
+	// 期限切れの後に届いた古い結果は上書きしない
+	if err := stalled.deliver(context.Background(), token, &messages[0]); err != nil {
+		t.Fatal(err)
+	}
+	var m Message
+	db.First(&m)
+	if m.Status != StatusDelivered || m.Attempts != 1 || m.LockToken != "" {
+		t.Fatalf("message=%+v", m)
+	}
+}
+
+func TestRelayDeadLettersRepeatedlyExpiredLease(t *testing.T) {
+	db := openOutboxTestDB(t)
+	if err := placeOrder(tenantContext(), db, "o1", false); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	var deadErr error
+	relay := NewRelay(db, PublisherFunc(func(context.Context, *Message) error { return nil }), &RelayOptions{
+		Lease:        time.Minute,
+		MaxAttempts:  2,
+		OnDeadLetter: func(_ context.Context, _ *Message, err error) { deadErr = err },
+	})
+	// 確保したまま結果を書かずに落ちるプロセスを2回繰り返す
+	for i := range 2 {
+		relay.now = func() time.Time { return now.Add(time.Duration(i) * 2 * time.Minute) }
+		if messages, _, err := relay.claim(context.Background()); err != nil || len(messages) != 1 {
+			t.Fatalf("claim %d: messages=%+v err=%v", i, messages, err)
+		}
+	}
+	relay.now = func() time.Time { return now.Add(4 * time.Minute) }
+	if messages, _, err := relay.claim(context.Background()); err != nil || len(messages) != 0 {
+		t.Fatalf("message over MaxAttempts must not be claimed: messages=%+v err=%v", messages, err)
+	}
+	var m Message
+	db.First(&m)
+	if m.Status != StatusDead || m.Attempts != 2 || m.LockToken != "" || !errors.Is(deadErr, errLeaseExpired) {
+		t.Fatalf("message=%+v deadErr=%v", m, deadErr)
+	}
+}
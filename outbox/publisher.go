@@ -0,0 +1,135 @@
+package gw_outbox
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+)
+
+// Publisher はメッセージの配送先。エラーを返すと Relay がバックオフ後に再送する。
+// ctx には Enqueue したときのテナント（Scope）・操作者・リクエストIDが入っている。
+type Publisher interface {
+	Publish(ctx context.Context, message *Message) error
+}
+
+// PublisherFunc は関数を Publisher として使うためのアダプタ。
+type PublisherFunc func(ctx context.Context, message *Message) error
+
+func (f PublisherFunc) Publish(ctx context.Context, message *Message) error {
+	return f(ctx, message)
+}
+
+// Router はトピックごとにプロセス内のハンドラへ配送する Publisher。
+// 1つのトピックに複数のハンドラを登録でき、どれかが失敗すると全ハンドラが再実行されるため、ハンドラは冪等にする。
+// ハンドラの無いトピックは配送済みとして扱う。
+type Router struct {
+	mu       sync.RWMutex
+	handlers map[string][]PublisherFunc
+}
+
+var _ Publisher = (*Router)(nil)
+
+func NewRouter() *Router {
+	return &Router{handlers: map[string][]PublisherFunc{}}
+}
+
+// Subscribe は topic のハンドラを登録する。
+func (r *Router) Subscribe(topic string, handler PublisherFunc) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handlers[topic] = append(r.handlers[topic], handler)
+}
+
+func (r *Router) Publish(ctx context.Context, message *Message) error {
+	r.mu.RLock()
+	handlers := r.handlers[message.Topic]
+	r.mu.RUnlock()
+	for _, handler := range handlers {
+		if err := handler(ctx, message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ChannelPublisher は ch へメッセージを送る Publisher を返す（別の goroutine で処理する場合やテスト用）。
+// ch が受け取られないまま ctx が終わると失敗として再送する。
+func ChannelPublisher(ch chan<- Message) Publisher {
+	return PublisherFunc(func(ctx context.Context, message *Message) error {
+		select {
+		case ch <- *message:
+			return nil
+		case <-ctx.Done():
+			return gw_errors.Wrap(ctx.Err())
+		}
+	})
+}
+
+// Webhook のリクエストヘッダ。
+const (
+	HeaderMessageId = "X-Outbox-Id"
+	HeaderTopic     = "X-Outbox-Topic"
+	HeaderTenantId  = "X-Outbox-Tenant-Id"
+	// HeaderSignature は本文の HMAC-SHA256（"sha256=" + hex）。受け手は同じ Secret で検証する
+	HeaderSignature = "X-Outbox-Signature"
+)
+
+// WebhookPublisher は Payload を本文にして URL へ POST する Publisher。2xx 以外は失敗として再送する。
+type WebhookPublisher struct {
+	URL string
+	// Secret があれば本文の署名を HeaderSignature に付ける
+	Secret []byte
+	// Client が nil なら10秒でタイムアウトするクライアントを使う
+	Client *http.Client
+}
+
+var _ Publisher = (*WebhookPublisher)(nil)
+
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func (w *WebhookPublisher) Publish(ctx context.Context, message *Message) error {
+	body := []byte(message.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return gw_errors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderMessageId, message.Id)
+	req.Header.Set(HeaderTopic, message.Topic)
+	if message.TenantId != "" {
+		req.Header.Set(HeaderTenantId, message.TenantId)
+	}
+	if len(w.Secret) > 0 {
+		req.Header.Set(HeaderSignature, SignWebhook(w.Secret, body))
+	}
+	client := w.Client
+	if client == nil {
+		client = defaultWebhookClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return gw_errors.Wrap(err)
+	}
+	defer resp.Body.Close()
+	// 接続を再利用できるよう本文を読み捨てる（巨大な応答は途中まで）
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return gw_errors.Errorf("webhook %s responded %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// SignWebhook は本文の署名（HeaderSignature の値）を返す。受け手は hmac.Equal で比較する。
+func SignWebhook(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
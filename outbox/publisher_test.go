@@ -0,0 +1,59 @@
+package gw_outbox
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebhookPublisher(t *testing.T) {
+	secret := []byte("webhook-secret")
+	var received http.Header
+	var body string
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received, body = r.Header, string(b)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	publisher := &WebhookPublisher{URL: server.URL, Secret: secret}
+	message := &Message{Id: "m1", TenantId: "t1", Topic: "order.placed", Payload: `{"orderId":"o1"}`}
+	if err := publisher.Publish(context.Background(), message); err != nil {
+		t.Fatal(err)
+	}
+	if body != message.Payload || received.Get(HeaderMessageId) != "m1" || received.Get(HeaderTopic) != "order.placed" ||
+		received.Get(HeaderTenantId) != "t1" || received.Get(HeaderSignature) != SignWebhook(secret, []byte(body)) {
+		t.Fatalf("headers=%v body=%s", received, body)
+	}
+
+	status = http.StatusServiceUnavailable
+	if err := publisher.Publish(context.Background(), message); err == nil {
+		t.Fatal("non-2xx must be a failure")
+	}
+}
+
+func TestRouterRunsAllHandlers(t *testing.T) {
+	router := NewRouter()
+	var calls []string
+	router.Subscribe("a", func(context.Context, *Message) error { calls = append(calls, "a1"); return nil })
+	router.Subscribe("a", func(context.Context, *Message) error { calls = append(calls, "a2"); return errors.New("fail") })
+	if err := router.Publish(context.Background(), &Message{Topic: "a"}); err == nil || len(calls) != 2 {
+		t.Fatalf("calls=%v err=%v", calls, err)
+	}
+	if err := router.Publish(context.Background(), &Message{Topic: "unknown"}); err != nil {
+		t.Fatalf("topics without handlers are delivered: %v", err)
+	}
+}
+
+func TestChannelPublisherHonorsContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := ChannelPublisher(make(chan Message)).Publish(ctx, &Message{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err=%v", err)
+	}
+}
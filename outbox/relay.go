@@ -0,0 +1,283 @@
+package gw_outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_uuid "github.com/generalworksinc/goutil/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// RelayOptions は Relay の設定。0 の項目は既定値を使う。
+type RelayOptions struct {
+	// PollInterval は未配送の行が無いときの待ち時間（1秒）
+	PollInterval time.Duration
+	// BatchSize は1回に読む行数（100）
+	BatchSize int
+	// MaxAttempts は dead にするまでの配送の試行回数（10）
+	MaxAttempts int
+	// Backoff は再送までの待ち時間の初期値（1秒）。失敗ごとに倍にし、MaxBackoff（1時間）で止める
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease は確保した行を processing にしておく期間（5分）。1件の配送はこの時間で打ち切る。
+	// 期限を過ぎた行は確保したプロセスが落ちたものとみなし、別の Relay が確保し直す（再送される）
+	Lease time.Duration
+	// OnDeadLetter は dead にしたときに呼ばれる（通知用）
+	OnDeadLetter func(ctx context.Context, message *Message, err error)
+}
+
+// Relay は outbox_message の未配送の行を Publisher へ配送するワーカー。
+// 行は短いトランザクションの SELECT ... FOR UPDATE SKIP LOCKED で確保して processing にし、
+// Publisher はトランザクションの外で呼び、配送結果は1件ずつ書き込む。
+// 複数のプロセスで同時に動かしても同じ行を二重に確保しない（SKIP LOCKED の無い SQLite では1プロセスで動かす）。
+type Relay struct {
+	db        *gorm.DB
+	publisher Publisher
+	options   RelayOptions
+	now       func() time.Time
+	wake      chan struct{}
+}
+
+// NewRelay は db の outbox_message を publisher へ配送する Relay を返す。opts が nil なら既定値。
+func NewRelay(db *gorm.DB, publisher Publisher, opts *RelayOptions) *Relay {
+	options := RelayOptions{}
+	if opts != nil {
+		options = *opts
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = time.Second
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 100
+	}
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 10
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = time.Second
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = time.Hour
+	}
+	if options.Lease <= 0 {
+		options.Lease = 5 * time.Minute
+	}
+	return &Relay{db: db, publisher: publisher, options: options, now: time.Now, wake: make(chan struct{}, 1)}
+}
+
+// Run は ctx が終わるまで配送を繰り返す。バッチが埋まっていれば待たずに次を読む。
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		processed, err := r.ProcessBatch(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			slog.WarnContext(ctx, "outbox relay failed", slog.String("error", err.Error()))
+		}
+		if err == nil && processed >= r.options.BatchSize {
+			continue
+		}
+		timer := time.NewTimer(r.options.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Wake は PollInterval を待たずに次の配送を始めさせる（gw_gorm.AfterCommit から呼ぶと遅延を減らせる）。
+func (r *Relay) Wake() {
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ProcessBatch は配送時刻を過ぎた行を最大 BatchSize 件確保して配送し、処理した件数を返す。
+// 配送結果は1件ずつ書き込むため、途中で失敗・停止してもそれまでに配送した行は delivered のまま残る。
+// 配送しなかった残りの行は pending に戻す。
+func (r *Relay) ProcessBatch(ctx context.Context) (int, error) {
+	messages, token, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+	processed := 0
+	for i := range messages {
+		if err := r.deliver(ctx, token, &messages[i]); err != nil {
+			r.release(ctx, token, messages[i:])
+			return processed, err
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// errLeaseExpired は Lease の期限が切れた processing の行を確保し直したときの失敗（確保したプロセスが落ちたとみなす）。
+var errLeaseExpired = gw_errors.New("outbox lease expired before delivery was recorded")
+
+// claim は配送時刻を過ぎた pending の行と期限切れの processing の行を確保し、token を付けて processing にする。
+// 期限切れの processing の行は前の配送が失敗したものとして試行回数を1つ増やし、MaxAttempts に達したら配送せず dead にする。
+func (r *Relay) claim(ctx context.Context) ([]Message, string, error) {
+	token := gw_uuid.GetUlid()
+	now := r.now()
+	var claimed, dead []Message
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var messages []Message
+		err := tx.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+			Where("status IN ? AND next_attempt_at <= ?", []string{StatusPending, StatusProcessing}, now).
+			Order("next_attempt_at, id").
+			Limit(r.options.BatchSize).
+			Find(&messages).Error
+		if err != nil || len(messages) == 0 {
+			return err
+		}
+		var ids, reclaimedIds, deadIds []string
+		for _, message := range messages {
+			if message.Status == StatusProcessing {
+				message.Attempts++
+				if message.Attempts >= r.options.MaxAttempts {
+					message.Status = StatusDead
+					message.LastError = errLeaseExpired.Error()
+					dead = append(dead, message)
+					deadIds = append(deadIds, message.Id)
+					continue
+				}
+				reclaimedIds = append(reclaimedIds, message.Id)
+			}
+			claimed = append(claimed, message)
+			ids = append(ids, message.Id)
+		}
+		if len(deadIds) > 0 {
+			err := tx.Model(&Message{}).Where("id IN ?", deadIds).
+				Updates(map[string]any{"status": StatusDead, "lock_token": "", "attempts": gorm.Expr("attempts + 1"), "last_error": errLeaseExpired.Error()}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(reclaimedIds) > 0 {
+			err := tx.Model(&Message{}).Where("id IN ?", reclaimedIds).
+				Updates(map[string]any{"attempts": gorm.Expr("attempts + 1"), "last_error": errLeaseExpired.Error()}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		return tx.Model(&Message{}).Where("id IN ?", ids).
+			Updates(map[string]any{"status": StatusProcessing, "lock_token": token, "next_attempt_at": now.Add(r.options.Lease)}).Error
+	})
+	if err != nil {
+		return nil, "", gw_errors.Wrap(err)
+	}
+	for i := range dead {
+		r.deadLettered(deliveryContext(ctx, &dead[i]), &dead[i], errLeaseExpired)
+	}
+	return claimed, token, nil
+}
+
+// release は確保したまま配送しなかった行を pending に戻す（試行回数には数えない）。
+func (r *Relay) release(ctx context.Context, token string, messages []Message) {
+	ids := make([]string, len(messages))
+	for i := range messages {
+		ids[i] = messages[i].Id
+	}
+	err := r.db.WithContext(context.WithoutCancel(ctx)).Model(&Message{}).
+		Where("id IN ? AND lock_token = ?", ids, token).
+		Updates(map[string]any{"status": StatusPending, "lock_token": "", "next_attempt_at": r.now()}).Error
+	if err != nil {
+		// 戻せなかった行も Lease の期限が過ぎれば確保し直される
+		slog.WarnContext(ctx, "outbox release failed", slog.String("error", err.Error()))
+	}
+}
+
+// deliver は1件を配送し、結果をその行だけの UPDATE で書き込む。
+func (r *Relay) deliver(ctx context.Context, token string, message *Message) error {
+	deliveryCtx := deliveryContext(ctx, message)
+	publishCtx, cancel := context.WithTimeout(deliveryCtx, r.options.Lease)
+	err := r.publish(publishCtx, message)
+	cancel()
+	if err != nil && ctx.Err() != nil {
+		// 停止による中断は失敗に数えない（呼び出し元が pending に戻す）
+		return ctx.Err()
+	}
+	now := r.now()
+	updates := map[string]any{"lock_token": ""}
+	dead := false
+	switch {
+	case err == nil:
+		updates["status"] = StatusDelivered
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	case message.Attempts+1 >= r.options.MaxAttempts:
+		dead = true
+		updates["status"] = StatusDead
+		updates["attempts"] = message.Attempts + 1
+		updates["last_error"] = err.Error()
+	default:
+		updates["status"] = StatusPending
+		updates["attempts"] = message.Attempts + 1
+		updates["last_error"] = err.Error()
+		updates["next_attempt_at"] = now.Add(r.backoff(message.Attempts + 1))
+	}
+	// 配送が済んだ結果は停止後も書き込む。token が違う行（期限切れで別の Relay が確保し直した行）は上書きしない
+	result := r.db.WithContext(context.WithoutCancel(ctx)).Model(&Message{}).
+		Where("id = ? AND lock_token = ?", message.Id, token).
+		Updates(updates)
+	if result.Error != nil {
+		return gw_errors.Wrap(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		slog.WarnContext(deliveryCtx, "outbox lease expired before the result was recorded",
+			slog.String("id", message.Id), slog.String("topic", message.Topic))
+		return nil
+	}
+	switch {
+	case dead:
+		r.deadLettered(deliveryCtx, message, err)
+	case err != nil:
+		slog.WarnContext(deliveryCtx, "outbox delivery failed",
+			slog.String("id", message.Id), slog.String("topic", message.Topic),
+			slog.Int("attempts", message.Attempts+1), slog.String("error", err.Error()))
+	}
+	return nil
+}
+
+// deadLettered は dead にした行を記録し、OnDeadLetter に通知する。
+func (r *Relay) deadLettered(ctx context.Context, message *Message, err error) {
+	slog.ErrorContext(ctx, "outbox message dead-lettered",
+		slog.String("id", message.Id), slog.String("topic", message.Topic), slog.String("error", err.Error()))
+	if r.options.OnDeadLetter != nil {
+		r.options.OnDeadLetter(ctx, message, err)
+	}
+}
+
+// publish は Publisher の panic を失敗として扱う（1件の panic で Relay 全体を止めない）。
+func (r *Relay) publish(ctx context.Context, message *Message) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = gw_errors.New(fmt.Sprintf("panic in outbox publisher: %v", rec))
+		}
+	}()
+	return r.publisher.Publish(ctx, message)
+}
+
+func (r *Relay) backoff(attempts int) time.Duration {
+	d := r.options.Backoff
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= r.options.MaxBackoff {
+			return r.options.MaxBackoff
+		}
+	}
+	return min(d, r.options.MaxBackoff)
+}
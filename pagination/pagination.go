@@ -0,0 +1,336 @@
+// Package gw_pagination はカーソル方式（keyset）のページングで使う共通の型と、改ざん検知付きカーソルの符号化を提供する。
+//
+// OFFSET は読み飛ばす行数に比例して遅くなるため、最後に返した行のソートキーをカーソルにして
+// 「そのキーより後ろ」を取得する。カーソルはソートキーの値を JSON にして HMAC-SHA256 で署名したもので、
+// クライアントからは不透明な文字列として扱わせる（値の書き換えや別のソート順のカーソルは ErrInvalidCursor）。
+//
+// DB ごとの取得は gw_gorm.Paginate / gw_mongo.Database[T].FindPage、リクエストからの取得は gw_web の BindPageRequest を使う。
+package gw_pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+)
+
+const (
+	// DefaultLimit は PageRequest.Limit が 0 のときの件数。
+	DefaultLimit = 20
+	// MaxLimit は 1 ページの上限。これを超える Limit は MaxLimit に丸める。
+	MaxLimit = 100
+)
+
+var (
+	// ErrInvalidCursor はカーソルの形式・署名・ソート順が一致しないことを表す（400 として返す想定）。
+	ErrInvalidCursor = errors.New("invalid cursor")
+	// ErrCursorKeyNotSet は SetCursorKey が呼ばれていないことを表す。
+	ErrCursorKeyNotSet = errors.New("cursor key is not set")
+)
+
+// SortField は1つのソートキー。Column は gorm ではカラム名、Mongo では bson のキー。
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// PageRequest は1ページ分の取得条件。
+// Sort の最後は一意なキーにする（含まれなければ各実装が主キーを昇順で補う）。ソートキーの値は NULL にならないこと。
+type PageRequest struct {
+	Cursor string
+	Limit  int
+	Sort   []SortField
+}
+
+// PageLimit は丸め済みの件数を返す。
+func (r PageRequest) PageLimit() int {
+	switch {
+	case r.Limit <= 0:
+		return DefaultLimit
+	case r.Limit > MaxLimit:
+		return MaxLimit
+	default:
+		return r.Limit
+	}
+}
+
+// Page は取得結果。次（前）のページが無ければカーソルは空文字。
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
+
+// Direction はカーソルの向き。
+type Direction string
+
+const (
+	Next Direction = "next"
+	Prev Direction = "prev"
+)
+
+// Cursor は復号したカーソル。Values は Sort と同じ順のソートキーの値。
+type Cursor struct {
+	Direction Direction
+	Values    []any
+}
+
+var (
+	keyMu     sync.RWMutex
+	cursorKey []byte
+)
+
+// SetCursorKey はカーソルの署名鍵を設定する。起動時に1回、全インスタンスで同じ鍵を設定する。
+// 鍵を変えると発行済みのカーソルは無効になる（ErrInvalidCursor）。
+func SetCursorKey(key []byte) {
+	keyMu.Lock()
+	defer keyMu.Unlock()
+	cursorKey = append([]byte(nil), key...)
+}
+
+func currentKey() ([]byte, error) {
+	keyMu.RLock()
+	defer keyMu.RUnlock()
+	if len(cursorKey) == 0 {
+		return nil, gw_errors.Wrap(ErrCursorKeyNotSet)
+	}
+	return cursorKey, nil
+}
+
+// cursorPayload はカーソルの中身。s はソート順の署名で、別のソート順のカーソルを弾く。
+type cursorPayload struct {
+	D Direction     `json:"d"`
+	S string        `json:"s"`
+	K []cursorValue `json:"k"`
+}
+
+// cursorValue は型付きの値。時刻は JSON にすると文字列になってしまうため型を残す。
+type cursorValue struct {
+	T string          `json:"t"`
+	V json.RawMessage `json:"v"`
+}
+
+// EncodeCursor はソートキーの値を署名付きカーソルにする。
+// 値は string / bool / 整数 / 浮動小数 / time.Time / encoding.TextMarshaler（ObjectID 等。復号後は string）に対応する。
+func EncodeCursor(sort []SortField, direction Direction, values []any) (string, error) {
+	key, err := currentKey()
+	if err != nil {
+		return "", err
+	}
+	payload := cursorPayload{D: direction, S: sortSignature(sort)}
+	for _, value := range values {
+		v, err := encodeValue(value)
+		if err != nil {
+			return "", err
+		}
+		payload.K = append(payload.K, v)
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", gw_errors.Wrap(err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(body)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(sign(key, encoded)), nil
+}
+
+// VerifyCursor はカーソルの形式と署名だけを検証する（ソート順は見ない）。リクエストの入口での早期チェック用。
+func VerifyCursor(cursor string) error {
+	_, err := verifiedPayload(cursor)
+	return err
+}
+
+func verifiedPayload(cursor string) (string, error) {
+	key, err := currentKey()
+	if err != nil {
+		return "", err
+	}
+	encoded, signature, ok := strings.Cut(cursor, ".")
+	if !ok {
+		return "", gw_errors.Wrap(ErrInvalidCursor)
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, sign(key, encoded)) {
+		return "", gw_errors.Wrap(ErrInvalidCursor)
+	}
+	return encoded, nil
+}
+
+// DecodeCursor は署名とソート順を検証してカーソルを復号する。
+func DecodeCursor(sort []SortField, cursor string) (*Cursor, error) {
+	encoded, err := verifiedPayload(cursor)
+	if err != nil {
+		return nil, err
+	}
+	body, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, gw_errors.Wrap(ErrInvalidCursor)
+	}
+	var payload cursorPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return nil, gw_errors.Wrap(ErrInvalidCursor)
+	}
+	if payload.S != sortSignature(sort) || len(payload.K) != len(sort) || (payload.D != Next && payload.D != Prev) {
+		return nil, gw_errors.Wrap(ErrInvalidCursor)
+	}
+	decoded := &Cursor{Direction: payload.D}
+	for _, v := range payload.K {
+		value, err := decodeValue(v)
+		if err != nil {
+			return nil, err
+		}
+		decoded.Values = append(decoded.Values, value)
+	}
+	return decoded, nil
+}
+
+func sign(key []byte, encoded string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
+
+func sortSignature(sort []SortField) string {
+	parts := make([]string, 0, len(sort))
+	for _, s := range sort {
+		if s.Desc {
+			parts = append(parts, "-"+s.Column)
+		} else {
+			parts = append(parts, s.Column)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func encodeValue(value any) (cursorValue, error) {
+	var typ string
+	switch v := value.(type) {
+	case string:
+		typ = "s"
+	case bool:
+		typ = "b"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		typ = "i"
+	case float32, float64:
+		typ = "f"
+	case time.Time:
+		typ, value = "t", v.UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		if v == nil {
+			return cursorValue{}, gw_errors.New("sort key must not be null")
+		}
+		typ, value = "t", v.UTC().Format(time.RFC3339Nano)
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return cursorValue{}, gw_errors.Wrap(err)
+		}
+		typ, value = "s", string(text)
+	case nil:
+		return cursorValue{}, gw_errors.New("sort key must not be null")
+	default:
+		return cursorValue{}, gw_errors.Errorf("unsupported sort key type: %T", value)
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return cursorValue{}, gw_errors.Wrap(err)
+	}
+	return cursorValue{T: typ, V: raw}, nil
+}
+
+func decodeValue(v cursorValue) (any, error) {
+	var err error
+	switch v.T {
+	case "s":
+		var s string
+		err = json.Unmarshal(v.V, &s)
+		return s, wrapInvalid(err)
+	case "b":
+		var b bool
+		err = json.Unmarshal(v.V, &b)
+		return b, wrapInvalid(err)
+	case "i":
+		var i int64
+		err = json.Unmarshal(v.V, &i)
+		return i, wrapInvalid(err)
+	case "f":
+		var f float64
+		err = json.Unmarshal(v.V, &f)
+		return f, wrapInvalid(err)
+	case "t":
+		var s string
+		if err = json.Unmarshal(v.V, &s); err != nil {
+			return nil, wrapInvalid(err)
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		return t, wrapInvalid(err)
+	default:
+		return nil, gw_errors.Wrap(ErrInvalidCursor)
+	}
+}
+
+func wrapInvalid(err error) error {
+	if err != nil {
+		return gw_errors.Wrap(ErrInvalidCursor, err.Error())
+	}
+	return nil
+}
+
+// NewPage は limit+1 件まで取得した rows からページを組み立てる。rows は cursor の向きの順（Prev なら逆順）で渡す。
+// keys は行からソートキーの値を取り出す関数。
+func NewPage[T any](req PageRequest, cursor *Cursor, rows []T, keys func(T) ([]any, error)) (*Page[T], error) {
+	limit := req.PageLimit()
+	hasMore := len(rows) > limit
+	if hasMore {
+		rows = rows[:limit]
+	}
+	backward := cursor != nil && cursor.Direction == Prev
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	page := &Page[T]{Items: rows}
+	if len(rows) == 0 {
+		return page, nil
+	}
+	// 前方向に続きがあるのは「カーソルで進んできた」か「逆方向に読んで余りがあった」とき
+	hasPrev := (cursor != nil && !backward) || (backward && hasMore)
+	hasNext := (!backward && hasMore) || backward
+	if hasNext {
+		values, err := keys(rows[len(rows)-1])
+		if err != nil {
+			return nil, err
+		}
+		if page.NextCursor, err = EncodeCursor(req.Sort, Next, values); err != nil {
+			return nil, err
+		}
+	}
+	if hasPrev {
+		values, err := keys(rows[0])
+		if err != nil {
+			return nil, err
+		}
+		if page.PrevCursor, err = EncodeCursor(req.Sort, Prev, values); err != nil {
+			return nil, err
+		}
+	}
+	return page, nil
+}
+
+// WithTieBreaker は Sort に column が含まれていなければ昇順で末尾に加えた PageRequest を返す。
+func (r PageRequest) WithTieBreaker(column string) PageRequest {
+	for _, s := range r.Sort {
+		if s.Column == column {
+			return r
+		}
+	}
+	r.Sort = append(append([]SortField(nil), r.Sort...), SortField{Column: column})
+	return r
+}
@@ -0,0 +1,110 @@
+package gw_pagination
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	SetCursorKey([]byte("k1"))
+	sort := []SortField{{Column: "created_at", Desc: true}, {Column: "rank"}, {Column: "id"}}
+	at := time.Date(2026, 3, 4, 5, 6, 7, 891, time.FixedZone("JST", 9*60*60))
+
+	cursor, err := EncodeCursor(sort, Prev, []any{at, 42, "e1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeCursor(sort, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := decoded.Values[0].(time.Time)
+	if decoded.Direction != Prev || !ok || !got.Equal(at) || decoded.Values[1] != int64(42) || decoded.Values[2] != "e1" {
+		t.Fatalf("decoded=%+v", decoded)
+	}
+
+	if _, err := EncodeCursor(sort, Next, []any{nil, 1, "e1"}); err == nil {
+		t.Fatal("null sort key must be rejected")
+	}
+}
+
+func TestCursorRejectsTampering(t *testing.T) {
+	SetCursorKey([]byte("k1"))
+	sort := []SortField{{Column: "id"}}
+	cursor, err := EncodeCursor(sort, Next, []any{"e1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, signature, _ := strings.Cut(cursor, ".")
+	cases := map[string]string{
+		"payload":   payload[:len(payload)-1] + "A." + signature,
+		"signature": payload + "." + signature[:len(signature)-1] + "A",
+		"format":    "not-a-cursor",
+	}
+	for name, c := range cases {
+		if _, err := DecodeCursor(sort, c); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("%s: err=%v", name, err)
+		}
+	}
+	if _, err := DecodeCursor([]SortField{{Column: "id", Desc: true}}, cursor); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("another sort: err=%v", err)
+	}
+
+	// 鍵を変えると発行済みのカーソルは無効
+	SetCursorKey([]byte("k2"))
+	if _, err := DecodeCursor(sort, cursor); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("rotated key: err=%v", err)
+	}
+}
+
+func TestPageLimitAndTieBreaker(t *testing.T) {
+	if (PageRequest{}).PageLimit() != DefaultLimit || (PageRequest{Limit: 1000}).PageLimit() != MaxLimit || (PageRequest{Limit: 5}).PageLimit() != 5 {
+		t.Fatal("limit must be clamped")
+	}
+	req := PageRequest{Sort: []SortField{{Column: "rank", Desc: true}}}
+	if got := req.WithTieBreaker("id").Sort; len(got) != 2 || got[1].Column != "id" || got[1].Desc {
+		t.Fatalf("tie breaker=%+v", got)
+	}
+	if len(req.Sort) != 1 {
+		t.Fatal("original sort must not be modified")
+	}
+	if got := (PageRequest{Sort: []SortField{{Column: "id", Desc: true}}}).WithTieBreaker("id").Sort; len(got) != 1 {
+		t.Fatalf("existing key must be kept: %+v", got)
+	}
+}
+
+func TestNewPageCursors(t *testing.T) {
+	SetCursorKey([]byte("k1"))
+	req := PageRequest{Limit: 2, Sort: []SortField{{Column: "id"}}}
+	keys := func(id string) ([]any, error) { return []any{id}, nil }
+
+	page, err := NewPage(req, nil, []string{"a", "b", "c"}, keys)
+	if err != nil || len(page.Items) != 2 || page.NextCursor == "" || page.PrevCursor != "" {
+		t.Fatalf("first page=%+v err=%v", page, err)
+	}
+	// 逆方向は降順で取得した行を並べ直す
+	page, err = NewPage(req, &Cursor{Direction: Prev}, []string{"d", "c", "b"}, keys)
+	if err != nil || strings.Join(page.Items, "") != "cd" || page.NextCursor == "" || page.PrevCursor == "" {
+		t.Fatalf("prev page=%+v err=%v", page, err)
+	}
+	page, err = NewPage(req, &Cursor{Direction: Next}, []string{}, keys)
+	if err != nil || page.NextCursor != "" || page.PrevCursor != "" {
+		t.Fatalf("empty page=%+v err=%v", page, err)
+	}
+}
+
+func TestVerifyCursor(t *testing.T) {
+	SetCursorKey([]byte("k1"))
+	cursor, err := EncodeCursor([]SortField{{Column: "id"}}, Next, []any{"e1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCursor(cursor); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyCursor(cursor + "x"); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("err=%v", err)
+	}
+}
@@ -0,0 +1,304 @@
+package gw_web
+
+// このファイルはデバッグログ用のリクエスト/レスポンス本文キャプチャと秘匿化（redaction）を置く。
+// キャプチャ結果は Locals に載せ、AccessLog と CustomHTTPErrorHandler が参照する。
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+// RedactedValue は秘匿化した値の置き換え文字列。
+const RedactedValue = "[REDACTED]"
+
+// defaultCaptureMaxRunes は本文を記録する最大文字数（CustomHTTPErrorHandler の従来の上限と同じ）。
+const defaultCaptureMaxRunes = 2000
+
+// Redactor はログに残す本文・ヘッダから秘密情報を取り除く。
+// JSON とフォーム（application/x-www-form-urlencoded）はキー名で、それ以外の値はカード番号らしき数字列で秘匿化する。
+type Redactor struct {
+	// Fields は秘匿化するキー名。大文字小文字と "_" / "-" は区別しない（refresh_token と refreshToken は同じ）。
+	Fields []string
+	// FieldPatterns はキー名に対する正規表現。どれかにマッチしたキーを秘匿化する。
+	FieldPatterns []*regexp.Regexp
+	// Headers は値を秘匿化するヘッダ名（大文字小文字は区別しない）。
+	Headers []string
+	// KeepCardNumbers が true なら、カード番号らしき値（Luhn を満たす 13〜19 桁）を残す。
+	KeepCardNumbers bool
+}
+
+// DefaultRedactor はパスワード・トークン・カード番号と Authorization / Cookie 系ヘッダを秘匿化する Redactor を返す。
+func DefaultRedactor() *Redactor {
+	return &Redactor{
+		Fields: []string{
+			"password", "passwd", "secret", "token", "access_token", "refresh_token", "id_token",
+			"api_key", "authorization", "card_number", "cvc", "cvv", "security_code",
+		},
+		FieldPatterns: []*regexp.Regexp{regexp.MustCompile(`(?i)(password|secret|token)`)},
+		Headers: []string{
+			fiber.HeaderAuthorization, fiber.HeaderProxyAuthorization, fiber.HeaderCookie, fiber.HeaderSetCookie,
+			"X-Api-Key",
+		},
+	}
+}
+
+// defaultRedactor はエラーログなど Redactor の指定が無い箇所で使う DefaultRedactor（正規表現のコンパイルを1回にする）。
+// 書き換えないこと。
+var defaultRedactor = DefaultRedactor()
+
+func normalizeRedactKey(key string) string {
+	return strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(key))
+}
+
+func (r *Redactor) isSecretKey(key string) bool {
+	normalized := normalizeRedactKey(key)
+	for _, field := range r.Fields {
+		if normalizeRedactKey(field) == normalized {
+			return true
+		}
+	}
+	for _, pattern := range r.FieldPatterns {
+		if pattern.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Redactor) isSecretHeader(name string) bool {
+	for _, header := range r.Headers {
+		if strings.EqualFold(header, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// RedactBody は contentType に応じて body を秘匿化した文字列を返す。
+// JSON / フォームとして読めない本文はそのまま（カード番号のみ伏せる）、UTF-8 でない本文は長さだけを返す。
+func (r *Redactor) RedactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == MIMEApplicationJSON || strings.HasSuffix(mediaType, "+json"):
+		var decoded interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&decoded); err == nil {
+			if redacted, err := json.Marshal(r.redactJSON(decoded)); err == nil {
+				return string(redacted)
+			}
+		}
+	case mediaType == MIMEApplicationForm:
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			for key, vs := range values {
+				for i := range vs {
+					if r.isSecretKey(key) {
+						vs[i] = RedactedValue
+					} else {
+						vs[i] = r.redactValue(vs[i])
+					}
+				}
+			}
+			return values.Encode()
+		}
+	case mediaType == MIMEMultipartForm:
+		return fmt.Sprintf("[multipart %d bytes]", len(body))
+	}
+	if !utf8.Valid(body) {
+		return fmt.Sprintf("[binary %d bytes]", len(body))
+	}
+	return r.redactValue(string(body))
+}
+
+func (r *Redactor) redactJSON(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for key, child := range val {
+			if r.isSecretKey(key) {
+				val[key] = RedactedValue
+				continue
+			}
+			val[key] = r.redactJSON(child)
+		}
+		return val
+	case []interface{}:
+		for i, child := range val {
+			val[i] = r.redactJSON(child)
+		}
+		return val
+	case string:
+		return r.redactValue(val)
+	case json.Number:
+		// 数値で送られたカード番号
+		if !r.KeepCardNumbers && looksLikeCardNumber(val.String()) {
+			return RedactedValue
+		}
+		return val
+	}
+	return v
+}
+
+var cardNumberCandidate = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+func (r *Redactor) redactValue(s string) string {
+	if r.KeepCardNumbers {
+		return s
+	}
+	return cardNumberCandidate.ReplaceAllStringFunc(s, func(m string) string {
+		if looksLikeCardNumber(m) {
+			return RedactedValue
+		}
+		return m
+	})
+}
+
+// looksLikeCardNumber は区切り（空白・ハイフン）を除いて 13〜19 桁で Luhn チェックを満たすかを返す。
+func looksLikeCardNumber(s string) bool {
+	digits := make([]int, 0, len(s))
+	for _, c := range s {
+		switch {
+		case c >= '0' && c <= '9':
+			digits = append(digits, int(c-'0'))
+		case c == ' ' || c == '-':
+		default:
+			return false
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := digits[i]
+		if (len(digits)-1-i)%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// RedactHeaders は headers を「名前 → カンマ区切りの値」にして、秘匿対象の値を伏せたものを返す。
+func (r *Redactor) RedactHeaders(headers map[string][]string) map[string]string {
+	out := make(map[string]string, len(headers))
+	for name, values := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		if r.isSecretHeader(canonical) {
+			out[canonical] = RedactedValue
+			continue
+		}
+		out[canonical] = strings.Join(values, ", ")
+	}
+	return out
+}
+
+// BodyCaptureConfig は BodyCapture の設定。
+type BodyCaptureConfig struct {
+	// Filter が false を返したリクエストはキャプチャしない。nil なら全リクエスト。
+	// 特定ルートだけにしたい場合は app.With(BodyCapture(cfg)).Post(...) のようにルート単位で付けてもよい。
+	Filter func(ctx *WebCtx) bool
+	// SkipResponse が true ならレスポンス本文は記録しない。
+	SkipResponse bool
+	// MaxBodyRunes は記録する本文の最大文字数（秘匿化後に切り詰める）。0 なら 2000。
+	MaxBodyRunes int
+	// Redactor は秘匿化のルール。nil なら DefaultRedactor()。
+	Redactor *Redactor
+}
+
+// CapturedExchange は BodyCapture が記録した秘匿化済みのリクエスト/レスポンス。
+type CapturedExchange struct {
+	RequestHeaders map[string]string
+	RequestBody    string
+	ResponseBody   string
+}
+
+type capturedExchangeKey struct{}
+
+// CapturedExchangeOf は BodyCapture が記録した内容を返す。キャプチャ対象外なら nil。
+func CapturedExchangeOf(ctx *WebCtx) *CapturedExchange {
+	captured, _ := ctx.Locals(capturedExchangeKey{}).(*CapturedExchange)
+	return captured
+}
+
+// BodyCapture はリクエスト/レスポンスの本文とリクエストヘッダを秘匿化して記録するミドルウェア。
+// AccessLog はこの内容をアクセスログに、CustomHTTPErrorHandler はエラーログ/Sentry に含める。
+// AccessLog より内側（後）に登録すること: app.Use(RequestId(), AccessLog(), BodyCapture(cfg))。
+// ストリーミング応答（SendStreamWriter / SendStream）の本文は読み出さない。
+func BodyCapture(cfg BodyCaptureConfig) WebHandler {
+	redactor := cfg.Redactor
+	if redactor == nil {
+		redactor = defaultRedactor
+	}
+	maxRunes := cfg.MaxBodyRunes
+	if maxRunes <= 0 {
+		maxRunes = defaultCaptureMaxRunes
+	}
+	return func(ctx *WebCtx) error {
+		if cfg.Filter != nil && !cfg.Filter(ctx) {
+			return ctx.Next()
+		}
+		fc := ctx.Ctx.(fiber.Ctx)
+		captured := &CapturedExchange{
+			RequestHeaders: redactor.RedactHeaders(fc.GetReqHeaders()),
+			RequestBody:    truncateRunes(redactor.RedactBody(ctx.Get(fiber.HeaderContentType), ctx.Body()), maxRunes),
+		}
+		ctx.Locals(capturedExchangeKey{}, captured)
+		err := ctx.Next()
+		if !cfg.SkipResponse {
+			res := fc.Response()
+			if res.IsBodyStream() {
+				captured.ResponseBody = "[stream]"
+			} else {
+				captured.ResponseBody = truncateRunes(redactor.RedactBody(string(res.Header.ContentType()), res.Body()), maxRunes)
+			}
+		}
+		return err
+	}
+}
+
+// captureLogAttrs は記録済みの内容をログ属性にする。キャプチャしていなければ nil。
+func captureLogAttrs(ctx *WebCtx) []slog.Attr {
+	captured := CapturedExchangeOf(ctx)
+	if captured == nil {
+		return nil
+	}
+	names := make([]string, 0, len(captured.RequestHeaders))
+	for name := range captured.RequestHeaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	headerAttrs := make([]any, 0, len(names))
+	for _, name := range names {
+		headerAttrs = append(headerAttrs, slog.String(name, captured.RequestHeaders[name]))
+	}
+	return []slog.Attr{
+		slog.Group("request_headers", headerAttrs...),
+		slog.String("request_body", captured.RequestBody),
+		slog.String("response_body", captured.ResponseBody),
+	}
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:max])
+}
@@ -0,0 +1,158 @@
+package gw_web
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestRedactorRedactsJSONFormAndHeaders(t *testing.T) {
+	r := DefaultRedactor()
+
+	body := `{"user":"taro","password":"p@ss","nested":{"refreshToken":"rt","items":[{"api-key":"k","memo":"card 4111 1111 1111 1111"}]},"card":4242424242424242,"orderId":1234567890123}`
+	got := r.RedactBody("application/json; charset=utf-8", []byte(body))
+	var m map[string]any
+	if err := json.Unmarshal([]byte(got), &m); err != nil {
+		t.Fatalf("redacted JSON must stay valid: %v (%s)", err, got)
+	}
+	for _, secret := range []string{"p@ss", `"rt"`, `"k"`, "4111", "4242424242424242"} {
+		if strings.Contains(got, secret) {
+			t.Fatalf("secret %s leaked: %s", secret, got)
+		}
+	}
+	// Luhn を満たさない数値 ID はそのまま残ること
+	if !strings.Contains(got, `"user":"taro"`) || !strings.Contains(got, "1234567890123") {
+		t.Fatalf("non-secret values must be kept: %s", got)
+	}
+
+	form := r.RedactBody(MIMEApplicationForm, []byte("login=hanako&Password=x&access_token=y"))
+	if form != "Password=%5BREDACTED%5D&access_token=%5BREDACTED%5D&login=hanako" {
+		t.Fatalf("form = %q", form)
+	}
+	if got := r.RedactBody("application/octet-stream", []byte{0xff, 0xfe}); got != "[binary 2 bytes]" {
+		t.Fatalf("binary = %q", got)
+	}
+
+	headers := r.RedactHeaders(map[string][]string{
+		"authorization": {"Bearer abc"},
+		"Cookie":        {"sid=1"},
+		"Accept":        {"text/html", "application/json"},
+	})
+	if headers["Authorization"] != RedactedValue || headers["Cookie"] != RedactedValue {
+		t.Fatalf("secret headers not redacted: %v", headers)
+	}
+	if headers["Accept"] != "text/html, application/json" {
+		t.Fatalf("Accept = %q", headers["Accept"])
+	}
+}
+
+func TestRedactorCustomRules(t *testing.T) {
+	r := &Redactor{
+		Fields:          []string{"my_number"},
+		FieldPatterns:   []*regexp.Regexp{regexp.MustCompile(`^x-`)},
+		KeepCardNumbers: true,
+	}
+	got := r.RedactBody(MIMEApplicationJSON, []byte(`{"myNumber":"123","x-sig":"s","password":"kept","card":"4111111111111111"}`))
+	if got != `{"card":"4111111111111111","myNumber":"[REDACTED]","password":"kept","x-sig":"[REDACTED]"}` {
+		t.Fatalf("custom redaction = %s", got)
+	}
+}
+
+func TestBodyCaptureFeedsAccessLog(t *testing.T) {
+	buf := captureSlog(t)
+	app := newLoggingTestApp()
+	app.Use(RequestId(), AccessLog(), BodyCapture(BodyCaptureConfig{
+		Filter:       func(ctx *WebCtx) bool { return strings.HasPrefix(ctx.Path(), "/api/") },
+		MaxBodyRunes: 80,
+	}))
+	app.Post("/api/login", func(ctx *WebCtx) error {
+		return ctx.JSON(map[string]string{"access_token": "issued-token", "name": "太郎"})
+	})
+	app.Post("/health", func(ctx *WebCtx) error { return ctx.SendString("ok") })
+
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"id":"taro","password":"secret-pass"}`))
+	req.Header.Set(fiber.HeaderContentType, MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer very-secret")
+	if _, err := app.App.(*fiber.App).Test(req); err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	req = httptest.NewRequest(http.MethodPost, "/health", strings.NewReader(`{"password":"other"}`))
+	if _, err := app.App.(*fiber.App).Test(req); err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+
+	out := buf.String()
+	for _, secret := range []string{"secret-pass", "issued-token", "very-secret", "other"} {
+		if strings.Contains(out, secret) {
+			t.Fatalf("secret %q leaked into access log: %s", secret, out)
+		}
+	}
+	var loginLine, healthLine map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var m map[string]any
+		if err := json.Unmarshal([]byte(line), &m); err != nil || m["msg"] != "access" {
+			continue
+		}
+		switch m["path"] {
+		case "/api/login":
+			loginLine = m
+		case "/health":
+			healthLine = m
+		}
+	}
+	if loginLine == nil || healthLine == nil {
+		t.Fatalf("access lines missing: %s", out)
+	}
+	if loginLine["request_body"] != `{"id":"taro","password":"[REDACTED]"}` {
+		t.Fatalf("request_body = %v", loginLine["request_body"])
+	}
+	if loginLine["response_body"] != `{"access_token":"[REDACTED]","name":"太郎"}` {
+		t.Fatalf("response_body = %v", loginLine["response_body"])
+	}
+	headers, _ := loginLine["request_headers"].(map[string]any)
+	if headers["Authorization"] != RedactedValue {
+		t.Fatalf("request_headers = %v", loginLine["request_headers"])
+	}
+	if _, ok := healthLine["request_body"]; ok {
+		t.Fatalf("filtered route must not capture: %v", healthLine)
+	}
+}
+
+func TestCustomHTTPErrorHandlerUsesRedactedCapture(t *testing.T) {
+	buf := captureSlog(t)
+	app := NewApp(CustomHTTPErrorHandler("v1", func(ctx *WebCtx) string { return "u1" }))
+	app.Use(BodyCapture(BodyCaptureConfig{SkipResponse: true}))
+	app.Post("/fail", func(ctx *WebCtx) error { return fiber.ErrBadGateway })
+
+	req := httptest.NewRequest(http.MethodPost, "/fail", strings.NewReader(`{"refresh_token":"rt-123","q":"x"}`))
+	req.Header.Set(fiber.HeaderContentType, MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderCookie, "session=abc")
+	resp, err := app.App.(*fiber.App).Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	out := buf.String()
+	if strings.Contains(out, "rt-123") || strings.Contains(out, "session=abc") {
+		t.Fatalf("secret leaked into error log: %s", out)
+	}
+	if !strings.Contains(out, `"request_body":"{\"q\":\"x\",\"refresh_token\":\"[REDACTED]\"}"`) {
+		t.Fatalf("error log should include redacted body: %s", out)
+	}
+}
+
+func TestTruncateRunesKeepsMultibyteBoundaries(t *testing.T) {
+	if got := truncateRunes("あいうえお", 3); got != "あいう" {
+		t.Fatalf("truncateRunes = %q", got)
+	}
+	if got := truncateRunes("abc", 3); got != "abc" {
+		t.Fatalf("truncateRunes = %q", got)
+	}
+}
@@ -12,13 +12,13 @@ import (
 
 	"github.com/getsentry/sentry-go"
 	"github.com/gofiber/fiber/v3"
-	"golang.org/x/exp/utf8string"
 )
 
 type ErrorData struct {
 	Message    string
 	StackTrace string
 	Body       string
+	Headers    map[string]string
 	Code       int
 	Error      string
 	Url        string
@@ -68,12 +68,14 @@ func CustomHTTPErrorHandler(version string, getUserIdFunc func(ctx *WebCtx) stri
 		}
 
 		userId := getUserIdFunc(ctx)
-		bodyStrUtf8 := utf8string.NewString(string(ctx.Body()))
+		// 本文はパスワード・トークン等を秘匿化してから記録する（BodyCapture 済みならその結果を使う）
 		bodyStr := ""
-		if bodyStrUtf8.RuneCount() > 2000 {
-			bodyStr = bodyStrUtf8.Slice(0, 2000)
+		var headers map[string]string
+		if captured := CapturedExchangeOf(ctx); captured != nil {
+			bodyStr = captured.RequestBody
+			headers = captured.RequestHeaders
 		} else {
-			bodyStr = bodyStrUtf8.String()
+			bodyStr = truncateRunes(defaultRedactor.RedactBody(ctx.Get(fiber.HeaderContentType), ctx.Body()), defaultCaptureMaxRunes)
 		}
 
 		errorData := ErrorData{
@@ -89,6 +91,7 @@ func CustomHTTPErrorHandler(version string, getUserIdFunc func(ctx *WebCtx) stri
 			UserId:     userId,
 			Version:    version,
 			Body:       bodyStr,
+			Headers:    headers,
 			// FullString: ctx.String(),
 		}
 
@@ -97,7 +100,7 @@ func CustomHTTPErrorHandler(version string, getUserIdFunc func(ctx *WebCtx) stri
 		if code >= 500 {
 			level = slog.LevelError
 		}
-		slog.LogAttrs(reqCtx, level, "request error",
+		attrs := []slog.Attr{
 			slog.Int("status", code),
 			slog.String("error", errorData.Error),
 			slog.String("message", message),
@@ -108,7 +111,9 @@ func CustomHTTPErrorHandler(version string, getUserIdFunc func(ctx *WebCtx) stri
 			slog.String("error_user_id", userId),
 			slog.String("version", version),
 			slog.String("stack_trace", stackTrace),
-		)
+		}
+		attrs = append(attrs, captureLogAttrs(ctx)...)
+		slog.LogAttrs(reqCtx, level, "request error", attrs...)
 
 		isSentToLogger := gw_errors.CheckSentToLogger(err)
 		if !isSentToLogger {
@@ -0,0 +1,33 @@
+package gw_web
+
+// このファイルはアプリの DB（gorm / Mongo）をリクエストの context に載せるミドルウェアと、
+// ctx.Context() 付きで取り出す参照口を置く。Timeout の deadline・TenantResolver の Scope はここから取り出した DB に自動で効く。
+
+import (
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	gw_mongo "github.com/generalworksinc/goutil/mongo"
+	"gorm.io/gorm"
+)
+
+// Databases はアプリの db（gw_gorm.WithDB）と Mongo の client（gw_mongo.WithClient）をリクエストの context に載せるミドルウェア。
+// nil のものは載せない。ハンドラは ctx.DB() / MongoDatabase[T](ctx) で取り出すだけで、
+// 後から登録した Timeout の deadline・キャンセルと Scope が SQL / Mongo の操作に伝搬する。
+// gw_gorm.Repository・gw_gorm.DBFromContext・gw_mongo.DatabaseFromContext も同じ値を使う。
+//
+//	app.Use(gw_web.Databases(db, mongoClient), gw_web.Timeout(5*time.Second))
+func Databases(db *gorm.DB, mongo *gw_mongo.Client) WebHandler {
+	return func(ctx *WebCtx) error {
+		ctx.SetContext(gw_mongo.WithClient(gw_gorm.WithDB(ctx.Context(), db), mongo))
+		return ctx.Next()
+	}
+}
+
+// DB は Databases で載せた db を ctx.Context() 付きで返す（gw_gorm.DBFromContext と同じ）。
+func (ctx WebCtx) DB() (*gorm.DB, error) {
+	return gw_gorm.DBFromContext(ctx.Context())
+}
+
+// MongoDatabase は Databases で載せた client の Database[T] を ctx.Context() 付きで返す（gw_mongo.DatabaseFromContext と同じ）。
+func MongoDatabase[T gw_mongo.Model](ctx *WebCtx) (*gw_mongo.Database[T], error) {
+	return gw_mongo.DatabaseFromContext[T](ctx.Context())
+}
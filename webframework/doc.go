@@ -176,6 +176,34 @@ func (app WebApp) DeleteDoc(path string, doc RouteDoc, handlers ...WebHandler) {
 	app.docs.register(MethodDelete, path, doc)
 }
 
+// HeadDoc registers a HEAD endpoint with OpenAPI documentation.
+func (app WebApp) HeadDoc(path string, doc RouteDoc, handlers ...WebHandler) {
+	app.Head(path, handlers...)
+	app.docs.register(MethodHead, path, doc)
+}
+
+// OptionsDoc registers an OPTIONS endpoint with OpenAPI documentation.
+func (app WebApp) OptionsDoc(path string, doc RouteDoc, handlers ...WebHandler) {
+	app.Options(path, handlers...)
+	app.docs.register(MethodOptions, path, doc)
+}
+
+// AnyDoc registers an endpoint for all methods and documents it under every documentable method.
+func (app WebApp) AnyDoc(path string, doc RouteDoc, handlers ...WebHandler) {
+	app.Any(path, handlers...)
+	for _, method := range anyDocMethods {
+		app.docs.register(method, path, doc)
+	}
+}
+
+// MatchDoc registers an endpoint for the given methods with OpenAPI documentation.
+func (app WebApp) MatchDoc(methods []string, path string, doc RouteDoc, handlers ...WebHandler) {
+	app.Match(methods, path, handlers...)
+	for _, method := range methods {
+		app.docs.register(method, path, doc)
+	}
+}
+
 // Doc methods on WebGroup //////////////////////////////////////////////////
 
 // GetDoc registers a GET endpoint on the group with OpenAPI documentation.
@@ -208,6 +236,37 @@ func (group WebGroup) DeleteDoc(path string, doc RouteDoc, handlers ...WebHandle
 	group.docs.register(MethodDelete, group.fullPath(path), doc)
 }
 
+// HeadDoc registers a HEAD endpoint on the group with OpenAPI documentation.
+func (group WebGroup) HeadDoc(path string, doc RouteDoc, handlers ...WebHandler) {
+	group.Head(path, handlers...)
+	group.docs.register(MethodHead, group.fullPath(path), doc)
+}
+
+// OptionsDoc registers an OPTIONS endpoint on the group with OpenAPI documentation.
+func (group WebGroup) OptionsDoc(path string, doc RouteDoc, handlers ...WebHandler) {
+	group.Options(path, handlers...)
+	group.docs.register(MethodOptions, group.fullPath(path), doc)
+}
+
+// AnyDoc registers an endpoint on the group for all methods and documents it under every documentable method.
+func (group WebGroup) AnyDoc(path string, doc RouteDoc, handlers ...WebHandler) {
+	group.Any(path, handlers...)
+	for _, method := range anyDocMethods {
+		group.docs.register(method, group.fullPath(path), doc)
+	}
+}
+
+// MatchDoc registers an endpoint on the group for the given methods with OpenAPI documentation.
+func (group WebGroup) MatchDoc(methods []string, path string, doc RouteDoc, handlers ...WebHandler) {
+	group.Match(methods, path, handlers...)
+	for _, method := range methods {
+		group.docs.register(method, group.fullPath(path), doc)
+	}
+}
+
+// anyDocMethods are the OpenAPI operations emitted for Any routes (CONNECT is not an OpenAPI operation).
+var anyDocMethods = []string{MethodGet, MethodHead, MethodPost, MethodPut, MethodPatch, MethodDelete, MethodOptions, MethodTrace}
+
 func (group WebGroup) fullPath(path string) string {
 	prefix := strings.TrimRight(group.prefix, "/")
 	if path == "" {
@@ -0,0 +1,248 @@
+package gw_web
+
+// このファイルは Excel で開ける CSV ダウンロード（ストリーミング出力）を置く。
+// 行はイテレータから 1 行ずつ読み出して書き出すので、件数が多くても全件をメモリに載せない。
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/csv"
+	"io"
+	"iter"
+	"log/slog"
+	"reflect"
+	"strings"
+
+	gw_encode "github.com/generalworksinc/goutil/encode"
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	"github.com/gofiber/fiber/v3"
+)
+
+// CSVEncoding は CSV エクスポートの文字コード。
+type CSVEncoding int
+
+const (
+	// CSVEncodingUTF8BOM は BOM 付き UTF-8（既定。Excel で文字化けしない）。
+	CSVEncodingUTF8BOM CSVEncoding = iota
+	// CSVEncodingUTF8 は BOM なし UTF-8。
+	CSVEncodingUTF8
+	// CSVEncodingShiftJIS は Shift_JIS（Windows-31J 相当）。
+	CSVEncodingShiftJIS
+	// CSVEncodingEUCJP は EUC-JP。
+	CSVEncodingEUCJP
+)
+
+// csvExportFlushRows ごとにクライアントへ書き出す。
+const csvExportFlushRows = 500
+
+// CSVExport は SendCSV の出力設定。
+type CSVExport struct {
+	// Filename はダウンロード時のファイル名（日本語可）。空なら Content-Disposition を付けない。
+	Filename string
+	// Encoding は出力する文字コード。
+	Encoding CSVEncoding
+	// Header はヘッダ行。nil なら出力しない。
+	Header []string
+	// Replacement は Shift_JIS / EUC-JP で表せない文字（絵文字など）の置き換え文字。空なら "?"。
+	Replacement string
+}
+
+// SendCSV は rows を CSV（改行は CRLF）としてストリーミングで返す。
+// rows は応答の書き出し中（ハンドラを抜けた後）に読まれるため、*sql.Rows などのカーソルは
+// ハンドラ内で Close せず、イテレータ側で閉じること（CSVRowsFromSQL はそうなっている）。
+// 書き出し開始後に rows がエラーを返した場合はステータスを変えられないため、ログに出して打ち切る。
+func (ctx WebCtx) SendCSV(opts CSVExport, rows iter.Seq2[[]string, error]) error {
+	fc := ctx.Ctx.(fiber.Ctx)
+	charset := "utf-8"
+	switch opts.Encoding {
+	case CSVEncodingShiftJIS:
+		charset = "Shift_JIS"
+	case CSVEncodingEUCJP:
+		charset = "EUC-JP"
+	}
+	fc.Set(fiber.HeaderContentType, MIMETextCSV+"; charset="+charset)
+	if opts.Filename != "" {
+		fc.Set(fiber.HeaderContentDisposition, ContentDispositionAttachment(opts.Filename))
+	}
+	reqCtx := ctx.Context()
+	return fc.SendStreamWriter(func(w *bufio.Writer) {
+		if err := writeCSVExport(w, opts, rows); err != nil {
+			slog.ErrorContext(reqCtx, "csv export aborted", slog.String("error", err.Error()))
+		}
+	})
+}
+
+func writeCSVExport(w *bufio.Writer, opts CSVExport, rows iter.Seq2[[]string, error]) (err error) {
+	replacement := opts.Replacement
+	if replacement == "" {
+		replacement = "?"
+	}
+	var out io.Writer = w
+	var sanitize func(string) string
+	switch opts.Encoding {
+	case CSVEncodingUTF8BOM:
+		if _, err := w.WriteString("\uFEFF"); err != nil {
+			return gw_errors.Wrap(err)
+		}
+	case CSVEncodingShiftJIS:
+		enc := gw_encode.NewUtf8ToSjisWriter(w)
+		defer closeCSVEncoder(enc, &err)
+		out = enc
+		sanitize = func(s string) string { return gw_encode.ReplaceUnsupportedSjis(s, replacement) }
+	case CSVEncodingEUCJP:
+		enc := gw_encode.NewUtf8ToEucjpWriter(w)
+		defer closeCSVEncoder(enc, &err)
+		out = enc
+		sanitize = func(s string) string { return gw_encode.ReplaceUnsupportedEucjp(s, replacement) }
+	}
+
+	cw := csv.NewWriter(out)
+	cw.UseCRLF = true
+	write := func(record []string) error {
+		if sanitize != nil {
+			for i := range record {
+				record[i] = sanitize(record[i])
+			}
+		}
+		return cw.Write(record)
+	}
+	if opts.Header != nil {
+		if err := write(append([]string(nil), opts.Header...)); err != nil {
+			return gw_errors.Wrap(err)
+		}
+	}
+	count := 0
+	for record, rowErr := range rows {
+		if rowErr != nil {
+			cw.Flush()
+			return gw_errors.Wrap(rowErr)
+		}
+		if err := write(record); err != nil {
+			return gw_errors.Wrap(err)
+		}
+		count++
+		if count%csvExportFlushRows == 0 {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return gw_errors.Wrap(err)
+			}
+			// クライアントが切断していればここでエラーになり、残りの行は読まない
+			if err := w.Flush(); err != nil {
+				return gw_errors.Wrap(err)
+			}
+		}
+	}
+	cw.Flush()
+	return gw_errors.Wrap(cw.Error())
+}
+
+func closeCSVEncoder(enc io.Closer, err *error) {
+	if closeErr := enc.Close(); closeErr != nil && *err == nil {
+		*err = gw_errors.Wrap(closeErr)
+	}
+}
+
+// CSVRowsFromSQL は *sql.Rows（gorm の db.Rows() も同じ）を列名と CSV 行のイテレータにする。
+// NULL は空欄。イテレータを最後まで回すか途中で抜けた時点で rows を Close する。
+func CSVRowsFromSQL(rows *sql.Rows) ([]string, iter.Seq2[[]string, error], error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, nil, gw_errors.Wrap(err)
+	}
+	seq := func(yield func([]string, error) bool) {
+		defer rows.Close()
+		values := make([]sql.NullString, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(dest...); err != nil {
+				yield(nil, gw_errors.Wrap(err))
+				return
+			}
+			record := make([]string, len(columns))
+			for i, v := range values {
+				record[i] = v.String
+			}
+			if !yield(record, nil) {
+				return
+			}
+		}
+		if err := rows.Err(); err != nil {
+			yield(nil, gw_errors.Wrap(err))
+		}
+	}
+	return columns, seq, nil
+}
+
+// CSVRowsOf は構造体のイテレータを列名と CSV 行のイテレータにする。
+// 列は Negotiate の CSV と同じく csv タグ → json タグ → フィールド名で決まる。
+func CSVRowsOf[T any](items iter.Seq2[T, error]) ([]string, iter.Seq2[[]string, error], error) {
+	columns, err := csvColumnsOf(reflect.TypeFor[T]())
+	if err != nil {
+		return nil, nil, err
+	}
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	seq := func(yield func([]string, error) bool) {
+		for item, err := range items {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			record, err := csvRecordOf(reflect.ValueOf(&item).Elem(), columns)
+			if !yield(record, err) || err != nil {
+				return
+			}
+		}
+	}
+	return header, seq, nil
+}
+
+// ContentDispositionAttachment は filename をダウンロードさせる Content-Disposition の値を返す。
+// 古いクライアント向けの filename には ASCII 以外を "_" にした名前を、
+// filename* には RFC 5987 形式（UTF-8 のパーセントエンコード）で元の名前を入れる。
+func ContentDispositionAttachment(filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+	var fallback strings.Builder
+	ascii := true
+	for _, r := range filename {
+		switch {
+		case r < 0x20 || r == 0x7f || r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		case r > 0x7e:
+			ascii = false
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+	disposition := `attachment; filename="` + fallback.String() + `"`
+	if !ascii {
+		disposition += "; filename*=UTF-8''" + rfc5987Escape(filename)
+	}
+	return disposition
+}
+
+// rfc5987Escape は RFC 5987 の attr-char 以外をパーセントエンコードする。
+func rfc5987Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			strings.IndexByte("!#$&+-.^_`|~", c) >= 0 {
+			b.WriteByte(c)
+			continue
+		}
+		b.WriteByte('%')
+		b.WriteByte("0123456789ABCDEF"[c>>4])
+		b.WriteByte("0123456789ABCDEF"[c&0x0f])
+	}
+	return b.String()
+}
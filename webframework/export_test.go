@@ -0,0 +1,156 @@
+package gw_web
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	gw_encode "github.com/generalworksinc/goutil/encode"
+	"github.com/gofiber/fiber/v3"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type exportRow struct {
+	Code  string `json:"code"`
+	Name  string `csv:"商品名"`
+	Price int    `json:"price"`
+}
+
+func exportRequest(t *testing.T, app *WebApp, path string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := app.App.(*fiber.App).Test(httptest.NewRequest(http.MethodGet, path, http.NoBody))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return resp, body
+}
+
+func TestSendCSVStructRowsWithBOMAndJapaneseFilename(t *testing.T) {
+	app := NewApp(nil)
+	app.Get("/export", func(ctx *WebCtx) error {
+		items := func(yield func(exportRow, error) bool) {
+			for i := 1; i <= 1200; i++ {
+				if !yield(exportRow{Code: "A" + strconv.Itoa(i), Name: "商品,名", Price: i * 10}, nil) {
+					return
+				}
+			}
+		}
+		header, rows, err := CSVRowsOf[exportRow](items)
+		if err != nil {
+			return err
+		}
+		return ctx.SendCSV(CSVExport{Filename: "売上 2026.csv", Header: header}, rows)
+	})
+
+	resp, body := exportRequest(t, app, "/export")
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "text/csv; charset=utf-8" {
+		t.Fatalf("content type = %q", ct)
+	}
+	wantDisposition := `attachment; filename="__ 2026.csv"; filename*=UTF-8''%E5%A3%B2%E4%B8%8A%202026.csv`
+	if cd := resp.Header.Get(fiber.HeaderContentDisposition); cd != wantDisposition {
+		t.Fatalf("content disposition = %q", cd)
+	}
+	if !strings.HasPrefix(string(body), "\uFEFFcode,商品名,price\r\nA1,\"商品,名\",10\r\n") {
+		t.Fatalf("unexpected head: %q", body[:60])
+	}
+	// ヘッダ + 1200 行（途中でフラッシュしても行が欠けないこと）
+	if lines := strings.Count(string(body), "\r\n"); lines != 1201 {
+		t.Fatalf("lines = %d, want 1201", lines)
+	}
+}
+
+func TestSendCSVShiftJISReplacesUnsupportedRunes(t *testing.T) {
+	app := NewApp(nil)
+	app.Get("/export", func(ctx *WebCtx) error {
+		rows := func(yield func([]string, error) bool) {
+			yield([]string{"髙橋", "よろしく😀"}, nil)
+		}
+		return ctx.SendCSV(CSVExport{Encoding: CSVEncodingShiftJIS, Header: []string{"氏名", "メモ"}}, rows)
+	})
+
+	resp, body := exportRequest(t, app, "/export")
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != "text/csv; charset=Shift_JIS" {
+		t.Fatalf("content type = %q", ct)
+	}
+	if resp.Header.Get(fiber.HeaderContentDisposition) != "" {
+		t.Fatal("Content-Disposition must not be set without filename")
+	}
+	decoded, err := gw_encode.SjisByteToUtf8Byte(body)
+	if err != nil {
+		t.Fatalf("decode sjis: %v", err)
+	}
+	if string(decoded) != "氏名,メモ\r\n髙橋,よろしく?\r\n" {
+		t.Fatalf("decoded = %q", decoded)
+	}
+}
+
+func TestSendCSVStopsOnIteratorError(t *testing.T) {
+	app := NewApp(nil)
+	app.Get("/export", func(ctx *WebCtx) error {
+		var rows iter.Seq2[[]string, error] = func(yield func([]string, error) bool) {
+			if !yield([]string{"ok"}, nil) {
+				return
+			}
+			if !yield(nil, errors.New("cursor broken")) {
+				return
+			}
+			yield([]string{"never"}, nil)
+		}
+		return ctx.SendCSV(CSVExport{Encoding: CSVEncodingEUCJP}, rows)
+	})
+
+	_, body := exportRequest(t, app, "/export")
+	if string(body) != "ok\r\n" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestCSVRowsFromSQLStreamsCursorAndCloses(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`CREATE TABLE items (id INTEGER, name TEXT, note TEXT);
+		INSERT INTO items VALUES (1, 'りんご', NULL), (2, 'みかん', 'S');`); err != nil {
+		t.Fatal(err)
+	}
+
+	app := NewApp(nil)
+	app.Get("/export", func(ctx *WebCtx) error {
+		sqlRows, err := db.QueryContext(ctx.Context(), `SELECT id, name, note FROM items ORDER BY id`)
+		if err != nil {
+			return err
+		}
+		header, rows, err := CSVRowsFromSQL(sqlRows)
+		if err != nil {
+			return err
+		}
+		return ctx.SendCSV(CSVExport{Encoding: CSVEncodingUTF8, Header: header}, rows)
+	})
+
+	_, body := exportRequest(t, app, "/export")
+	if string(body) != "id,name,note\r\n1,りんご,\r\n2,みかん,S\r\n" {
+		t.Fatalf("body = %q", body)
+	}
+	// カーソルが閉じられていれば接続は再利用でき、open connection は残らない
+	if stats := db.Stats(); stats.InUse != 0 {
+		t.Fatalf("connections in use = %d, rows not closed", stats.InUse)
+	}
+}
+
+func TestContentDispositionAttachmentASCII(t *testing.T) {
+	if got := ContentDispositionAttachment(`../report "q".csv`); got != `attachment; filename="report _q_.csv"` {
+		t.Fatalf("ascii disposition = %q", got)
+	}
+}
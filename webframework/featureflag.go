@@ -0,0 +1,33 @@
+package gw_web
+
+// このファイルは機能フラグの参照口（FeatureFlags ミドルウェアと WebCtx.FlagEnabled）を置く。
+// 判定の実装は gw_featureflag.Flags 等が持ち、gw_web は FlagEvaluator インターフェースにだけ依存する。
+
+import "context"
+
+// FlagEvaluator は context（テナント・ユーザー）に対して機能フラグが有効かを返す。gw_featureflag.Flags が満たす。
+type FlagEvaluator interface {
+	Enabled(ctx context.Context, name string) bool
+}
+
+type flagEvaluatorKey struct{}
+
+// FeatureFlags はハンドラから ctx.FlagEnabled を使えるようにするミドルウェア。
+// テナント・ユーザーは ctx.Context() の gw_log のテナントID・ユーザーIDから評価するので、
+// TenantResolver・認証ミドルウェアより後に登録すること。
+func FeatureFlags(evaluator FlagEvaluator) WebHandler {
+	return func(ctx *WebCtx) error {
+		ctx.Locals(flagEvaluatorKey{}, evaluator)
+		return ctx.Next()
+	}
+}
+
+// FlagEnabled はリクエストのテナント・ユーザーに対して name の機能フラグが有効かを返す。
+// FeatureFlags ミドルウェアが登録されていなければ常に false。
+func (ctx WebCtx) FlagEnabled(name string) bool {
+	evaluator, ok := ctx.Locals(flagEvaluatorKey{}).(FlagEvaluator)
+	if !ok || evaluator == nil {
+		return false
+	}
+	return evaluator.Enabled(ctx.Context(), name)
+}
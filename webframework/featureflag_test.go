@@ -0,0 +1,59 @@
+package gw_web
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"github.com/gofiber/fiber/v3"
+)
+
+// userFlags は user_id が一致するフラグだけを有効にする評価器
+type userFlags map[string]string
+
+func (f userFlags) Enabled(ctx context.Context, name string) bool {
+	return f[name] != "" && f[name] == gw_log.UserIdFromContext(ctx)
+}
+
+func TestFlagEnabledUsesRequestContext(t *testing.T) {
+	app := newRouteTestApp()
+	app.Use(func(ctx *WebCtx) error {
+		ctx.SetContext(gw_log.WithUserId(ctx.Context(), ctx.Get("X-User")))
+		return ctx.Next()
+	}, FeatureFlags(userFlags{"new-ui": "u1"}))
+	app.Get("/", func(ctx *WebCtx) error {
+		if ctx.FlagEnabled("new-ui") {
+			return ctx.SendString("new")
+		}
+		return ctx.SendString("old")
+	})
+
+	for user, want := range map[string]string{"u1": "new", "u2": "old"} {
+		req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+		req.Header.Set("X-User", user)
+		resp, err := app.App.(*fiber.App).Test(req)
+		if err != nil {
+			t.Fatalf("app.Test error: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != want {
+			t.Fatalf("user %s got %q want %q", user, body, want)
+		}
+	}
+}
+
+func TestFlagEnabledWithoutMiddlewareIsOff(t *testing.T) {
+	app := newRouteTestApp()
+	app.Get("/", func(ctx *WebCtx) error {
+		if ctx.FlagEnabled("anything") {
+			return ctx.Status(http.StatusTeapot).SendString("on")
+		}
+		return ctx.SendString("off")
+	})
+	if got := routeTestStatus(t, app, http.MethodGet, "/"); got != http.StatusOK {
+		t.Fatalf("status = %d", got)
+	}
+}
@@ -0,0 +1,31 @@
+package gw_web
+
+// このファイルは一覧APIの絞り込み・ソート（?status=&sort=）のクエリを gw_gorm.QueryFilter にする binder を置く。
+
+import (
+	"errors"
+	"net/url"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+)
+
+// BindQueryFilter はクエリ文字列（?status=open&created_at[gte]=...&sort=-createdAt）を
+// T の filter タグで許可したカラムだけの条件にする（gw_gorm.ParseQueryFilter）。
+// 未知・未許可のカラムや不正な値は 400。ソートを Paginate に渡す場合は filter.Sort を PageRequest.Sort に使う。
+func BindQueryFilter[T any](ctx *WebCtx, db *gorm.DB) (*gw_gorm.QueryFilter, error) {
+	query, err := url.ParseQuery(string(ctx.Ctx.(fiber.Ctx).Request().URI().QueryString()))
+	if err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "invalid query string")
+	}
+	filter, err := gw_gorm.ParseQueryFilter[T](db, query)
+	if errors.Is(err, gw_gorm.ErrInvalidFilter) {
+		return nil, fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return nil, gw_errors.Wrap(err)
+	}
+	return filter, nil
+}
@@ -0,0 +1,56 @@
+package gw_web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils/tests"
+)
+
+type filterTestTask struct {
+	Id       string
+	Status   string `filter:"eq,in,sort"`
+	Priority int    `filter:"range"`
+	Secret   string
+}
+
+func TestBindQueryFilter(t *testing.T) {
+	db, err := gorm.Open(tests.DummyDialector{}, &gorm.Config{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := newRouteTestApp()
+	app.Get("/tasks", func(ctx *WebCtx) error {
+		filter, err := BindQueryFilter[filterTestTask](ctx, db)
+		if err != nil {
+			return err
+		}
+		return ctx.SendString(fmt.Sprintf("%d:%d", len(filter.Conditions), len(filter.Sort)))
+	})
+
+	cases := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"?status[in]=open,closed&priority[gte]=2&sort=-status&limit=10", http.StatusOK, "2:1"},
+		{"?secret=x", http.StatusBadRequest, ""},
+		{"?priority[gte]=high", http.StatusBadRequest, ""},
+		{"?status=a;b", http.StatusBadRequest, ""},
+	}
+	for _, c := range cases {
+		resp, err := app.App.(*fiber.App).Test(httptest.NewRequest(http.MethodGet, "/tasks"+c.query, http.NoBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != c.status || (c.body != "" && string(body) != c.body) {
+			t.Fatalf("%s: status=%d body=%s", c.query, resp.StatusCode, body)
+		}
+	}
+}
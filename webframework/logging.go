@@ -46,14 +46,17 @@ func AccessLog() WebHandler {
 		} else if status >= 400 {
 			level = slog.LevelWarn
 		}
-		slog.LogAttrs(ctx.Context(), level, "access",
+		attrs := []slog.Attr{
 			slog.String("method", ctx.Method()),
 			slog.String("path", ctx.OriginalURL()),
 			slog.Int("status", status),
 			slog.Int64("latency_ms", time.Since(start).Milliseconds()),
 			slog.String("ip", ctx.IP()),
 			slog.String("ua", ctx.UserAgent()),
-		)
+		}
+		// BodyCapture 対象のリクエストは秘匿化済みのヘッダ・本文も出す
+		attrs = append(attrs, captureLogAttrs(ctx)...)
+		slog.LogAttrs(ctx.Context(), level, "access", attrs...)
 		return err
 	}
 }
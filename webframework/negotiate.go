@@ -0,0 +1,385 @@
+package gw_web
+
+// このファイルは Accept / Content-Type による表現形式の切り替え（コンテントネゴシエーション）を置く。
+// JSON 以外のエンコーダ（MessagePack / CBOR）は newAppInternal で fiber.Config に設定し、
+// CSV は fiber のカスタムバインダーとして登録する。
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	"github.com/gofiber/fiber/v3"
+)
+
+// MIME types used by content negotiation.
+const (
+	MIMEApplicationMsgPack = "application/vnd.msgpack"
+	MIMEApplicationCBOR    = "application/cbor"
+	MIMETextCSV            = "text/csv"
+	MIMETextCSVCharsetUTF8 = "text/csv; charset=utf-8"
+)
+
+// negotiableTypes は Negotiate が応答できる形式。先頭が Accept 未指定時・ワイルドカード時の既定（JSON）。
+var negotiableTypes = []string{
+	MIMEApplicationJSON,
+	MIMEApplicationMsgPack,
+	MIMEApplicationCBOR,
+	MIMEApplicationXML,
+	MIMETextXML,
+	MIMETextCSV,
+}
+
+// Negotiate は Accept ヘッダに従って data を JSON / MessagePack / CBOR / XML / CSV のいずれかで返す。
+// Accept が無い・*/* の場合は JSON。どれにも合わなければ 406 Not Acceptable を返す。
+// CSV は構造体（またはそのスライス）と [][]string に対応する（列名は csv タグ → json タグ → フィールド名）。
+func (ctx WebCtx) Negotiate(data interface{}) error {
+	fc := ctx.Ctx.(fiber.Ctx)
+	fc.Vary(fiber.HeaderAccept)
+	accept := MIMEApplicationJSON
+	if fc.Get(fiber.HeaderAccept) != "" {
+		accept = fc.Accepts(negotiableTypes...)
+	}
+	switch accept {
+	case MIMEApplicationJSON:
+		return fc.JSON(data)
+	case MIMEApplicationMsgPack:
+		return fc.MsgPack(data)
+	case MIMEApplicationCBOR:
+		return fc.CBOR(data)
+	case MIMEApplicationXML:
+		return fc.XML(data)
+	case MIMETextXML:
+		if err := fc.XML(data); err != nil {
+			return err
+		}
+		fc.Set(fiber.HeaderContentType, MIMETextXMLCharsetUTF8)
+		return nil
+	case MIMETextCSV:
+		body, err := marshalCSV(data)
+		if err != nil {
+			return gw_errors.Wrap(err)
+		}
+		fc.Set(fiber.HeaderContentType, MIMETextCSVCharsetUTF8)
+		return fc.Send(body)
+	default:
+		return fiber.ErrNotAcceptable
+	}
+}
+
+// BindBody は Content-Type に従ってリクエストボディを out へデコードする。
+// JSON / XML / フォーム / MessagePack / CBOR / CSV（out は構造体スライスか [][]string のポインタ）に対応する。
+func (ctx WebCtx) BindBody(out interface{}) error {
+	return ctx.Ctx.(fiber.Ctx).Bind().Body(out)
+}
+
+// MsgPack は data を MessagePack で返す。
+func (ctx WebCtx) MsgPack(data interface{}) error {
+	return ctx.Ctx.(fiber.Ctx).MsgPack(data)
+}
+
+// CBOR は data を CBOR で返す。
+func (ctx WebCtx) CBOR(data interface{}) error {
+	return ctx.Ctx.(fiber.Ctx).CBOR(data)
+}
+
+// XML は data を XML で返す。
+func (ctx WebCtx) XML(data interface{}) error {
+	return ctx.Ctx.(fiber.Ctx).XML(data)
+}
+
+// csvBinder は text/csv のリクエストボディを Bind().Body で扱えるようにする fiber カスタムバインダー。
+type csvBinder struct{}
+
+func (csvBinder) Name() string        { return "csv" }
+func (csvBinder) MIMETypes() []string { return []string{MIMETextCSV} }
+func (csvBinder) Parse(c fiber.Ctx, out any) error {
+	return unmarshalCSV(c.Body(), out)
+}
+
+// marshalCSV は data をヘッダ行付きの CSV にする。[][]string はそのまま書き出す。
+func marshalCSV(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if records, ok := data.([][]string); ok {
+		if err := w.WriteAll(records); err != nil {
+			return nil, gw_errors.Wrap(err)
+		}
+		return buf.Bytes(), nil
+	}
+	v := reflect.ValueOf(data)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return []byte{}, nil
+		}
+		v = v.Elem()
+	}
+	var rows []reflect.Value
+	var elemType reflect.Type
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		elemType = v.Type().Elem()
+		for i := 0; i < v.Len(); i++ {
+			rows = append(rows, v.Index(i))
+		}
+	case reflect.Struct:
+		elemType = v.Type()
+		rows = append(rows, v)
+	default:
+		return nil, gw_errors.Errorf("csv: unsupported type %T", data)
+	}
+	columns, err := csvColumnsOf(elemType)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]string, len(columns))
+	for i, col := range columns {
+		header[i] = col.name
+	}
+	if err := w.Write(header); err != nil {
+		return nil, gw_errors.Wrap(err)
+	}
+	for _, row := range rows {
+		record, err := csvRecordOf(row, columns)
+		if err != nil {
+			return nil, err
+		}
+		if err := w.Write(record); err != nil {
+			return nil, gw_errors.Wrap(err)
+		}
+	}
+	w.Flush()
+	return buf.Bytes(), gw_errors.Wrap(w.Error())
+}
+
+// unmarshalCSV はヘッダ行付き CSV を out（*[]T / *[]*T / *[][]string）へ読み込む。
+// 列はヘッダ名で対応付け、構造体に無い列は無視する。
+func unmarshalCSV(body []byte, out interface{}) error {
+	records, err := csv.NewReader(bytes.NewReader(body)).ReadAll()
+	if err != nil {
+		return gw_errors.Wrap(err)
+	}
+	if raw, ok := out.(*[][]string); ok {
+		*raw = records
+		return nil
+	}
+	ptr := reflect.ValueOf(out)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Slice {
+		return gw_errors.Errorf("csv: out must be a pointer to a slice, got %T", out)
+	}
+	slice := ptr.Elem()
+	elemType := slice.Type().Elem()
+	structType := elemType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+	columns, err := csvColumnsOf(structType)
+	if err != nil {
+		return err
+	}
+	result := reflect.MakeSlice(slice.Type(), 0, len(records))
+	if len(records) == 0 {
+		slice.Set(result)
+		return nil
+	}
+	byName := map[string]csvColumn{}
+	for _, col := range columns {
+		byName[col.name] = col
+	}
+	header := records[0]
+	for line, record := range records[1:] {
+		item := reflect.New(structType).Elem()
+		for i, value := range record {
+			if i >= len(header) {
+				break
+			}
+			col, ok := byName[strings.TrimSpace(header[i])]
+			if !ok {
+				continue
+			}
+			field, err := csvFieldForSet(item, col.index)
+			if err == nil {
+				err = setCSVValue(field, value)
+			}
+			if err != nil {
+				return gw_errors.Errorf("csv: line %d column %q: %w", line+2, col.name, err)
+			}
+		}
+		if elemType.Kind() == reflect.Ptr {
+			result = reflect.Append(result, item.Addr())
+		} else {
+			result = reflect.Append(result, item)
+		}
+	}
+	slice.Set(result)
+	return nil
+}
+
+type csvColumn struct {
+	name  string
+	index []int
+}
+
+// csvColumnsOf は構造体の公開フィールドから CSV 列を決める（埋め込み構造体は展開する）。
+func csvColumnsOf(t reflect.Type) ([]csvColumn, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, gw_errors.Errorf("csv: element type must be a struct, got %s", t)
+	}
+	var columns []csvColumn
+	for _, field := range reflect.VisibleFields(t) {
+		if !field.IsExported() {
+			continue
+		}
+		if field.Anonymous {
+			// 埋め込み構造体（*T を含む）は昇格したフィールドが列になる
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				continue
+			}
+		}
+		name := csvFieldName(field)
+		if name == "-" {
+			continue
+		}
+		columns = append(columns, csvColumn{name: name, index: field.Index})
+	}
+	return columns, nil
+}
+
+// csvFieldForSet は index のフィールドを返す。途中の nil の埋め込みポインタは確保する。
+// 非公開の型への埋め込みポインタは確保できないためエラーにする（encoding/json と同じ）。
+func csvFieldForSet(v reflect.Value, index []int) (reflect.Value, error) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, gw_errors.Errorf("cannot set embedded pointer to unexported struct %s", v.Type().Elem())
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, nil
+}
+
+func csvFieldName(field reflect.StructField) string {
+	for _, key := range []string{"csv", "json"} {
+		if tag, ok := field.Tag.Lookup(key); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if name != "" {
+				return name
+			}
+		}
+	}
+	return field.Name
+}
+
+func csvRecordOf(row reflect.Value, columns []csvColumn) ([]string, error) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		if row.IsNil() {
+			return make([]string, len(columns)), nil
+		}
+		row = row.Elem()
+	}
+	record := make([]string, len(columns))
+	for i, col := range columns {
+		field, err := row.FieldByIndexErr(col.index)
+		if err != nil {
+			// nil の埋め込みポインタ経由のフィールドは空欄
+			continue
+		}
+		record[i] = csvString(field)
+	}
+	return record, nil
+}
+
+func csvString(v reflect.Value) string {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch val := v.Interface().(type) {
+	case time.Time:
+		if val.IsZero() {
+			return ""
+		}
+		return val.Format(time.RFC3339)
+	case fmt.Stringer:
+		return val.String()
+	case encoding.TextMarshaler:
+		text, err := val.MarshalText()
+		if err != nil {
+			return ""
+		}
+		return string(text)
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+func setCSVValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Ptr {
+		if value == "" {
+			return nil
+		}
+		field.Set(reflect.New(field.Type().Elem()))
+		field = field.Elem()
+	}
+	if field.CanAddr() {
+		if u, ok := field.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			if value == "" {
+				return nil
+			}
+			return u.UnmarshalText([]byte(value))
+		}
+	}
+	if value == "" {
+		return nil
+	}
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
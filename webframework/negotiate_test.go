@@ -0,0 +1,209 @@
+package gw_web
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gofiber/fiber/v3"
+	"github.com/shamaton/msgpack/v3"
+)
+
+type negotiateItem struct {
+	XMLName   xml.Name  `json:"-" msgpack:"-" cbor:"-" xml:"item"`
+	Id        string    `json:"id" msgpack:"id" cbor:"id" xml:"id"`
+	Name      string    `json:"name" msgpack:"name" cbor:"name" xml:"name" csv:"item_name"`
+	Count     int       `json:"count" msgpack:"count" cbor:"count" xml:"count"`
+	CreatedAt time.Time `json:"createdAt" msgpack:"-" cbor:"-" xml:"-"`
+	Secret    string    `json:"-" msgpack:"-" cbor:"-" xml:"-"`
+}
+
+var negotiateCreatedAt = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newNegotiateTestApp() *WebApp {
+	app := NewApp(func(ctx *WebCtx, err error) error {
+		return ctx.Status(errorStatusCode(err, ctx.StatusCode())).SendString(err.Error())
+	})
+	app.Get("/item", func(ctx *WebCtx) error {
+		return ctx.Negotiate(negotiateItem{Id: "i1", Name: "りんご", Count: 3, CreatedAt: negotiateCreatedAt, Secret: "s"})
+	})
+	return app
+}
+
+func negotiateRequest(t *testing.T, app *WebApp, accept string) (*http.Response, []byte) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/item", http.NoBody)
+	if accept != "" {
+		req.Header.Set(fiber.HeaderAccept, accept)
+	}
+	resp, err := app.App.(*fiber.App).Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read body: %v", err)
+	}
+	return resp, body
+}
+
+func TestNegotiateSelectsFormatByAccept(t *testing.T) {
+	app := newNegotiateTestApp()
+
+	resp, body := negotiateRequest(t, app, "")
+	if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, MIMEApplicationJSON) {
+		t.Fatalf("default content type = %q, want JSON", ct)
+	}
+	var fromJSON negotiateItem
+	if err := json.Unmarshal(body, &fromJSON); err != nil || fromJSON.Name != "りんご" {
+		t.Fatalf("json body=%s err=%v", body, err)
+	}
+
+	resp, body = negotiateRequest(t, app, MIMEApplicationMsgPack)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != MIMEApplicationMsgPack {
+		t.Fatalf("msgpack content type = %q", ct)
+	}
+	var fromMsgPack negotiateItem
+	if err := msgpack.Unmarshal(body, &fromMsgPack); err != nil || fromMsgPack.Count != 3 {
+		t.Fatalf("msgpack decoded=%+v err=%v", fromMsgPack, err)
+	}
+
+	resp, body = negotiateRequest(t, app, "application/cbor;q=0.9, application/json;q=0.1")
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != MIMEApplicationCBOR {
+		t.Fatalf("cbor content type = %q", ct)
+	}
+	var fromCBOR negotiateItem
+	if err := cbor.Unmarshal(body, &fromCBOR); err != nil || fromCBOR.Id != "i1" {
+		t.Fatalf("cbor decoded=%+v err=%v", fromCBOR, err)
+	}
+
+	resp, body = negotiateRequest(t, app, MIMEApplicationXML)
+	if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, MIMEApplicationXML) {
+		t.Fatalf("xml content type = %q", ct)
+	}
+	if !strings.Contains(string(body), "<name>りんご</name>") {
+		t.Fatalf("xml body = %s", body)
+	}
+
+	resp, body = negotiateRequest(t, app, MIMETextCSV)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != MIMETextCSVCharsetUTF8 {
+		t.Fatalf("csv content type = %q", ct)
+	}
+	want := "id,item_name,count,createdAt\ni1,りんご,3,2026-01-02T03:04:05Z\n"
+	if string(body) != want {
+		t.Fatalf("csv body = %q, want %q", body, want)
+	}
+	if vary := resp.Header.Get(fiber.HeaderVary); !strings.Contains(vary, fiber.HeaderAccept) {
+		t.Fatalf("Vary should include Accept, got %q", vary)
+	}
+}
+
+func TestNegotiateRejectsUnsupportedAccept(t *testing.T) {
+	app := newNegotiateTestApp()
+	resp, _ := negotiateRequest(t, app, "image/png")
+	if resp.StatusCode != http.StatusNotAcceptable {
+		t.Fatalf("status = %d, want 406", resp.StatusCode)
+	}
+}
+
+func TestBindBodyDecodesAlternativeEncodings(t *testing.T) {
+	app := NewApp(func(ctx *WebCtx, err error) error {
+		return ctx.Status(http.StatusBadRequest).SendString(err.Error())
+	})
+	app.Post("/items", func(ctx *WebCtx) error {
+		var items []negotiateItem
+		if err := ctx.BindBody(&items); err != nil {
+			return err
+		}
+		return ctx.JSON(items)
+	})
+
+	source := []negotiateItem{{Id: "a", Name: "みかん", Count: 1}, {Id: "b", Name: "ぶどう", Count: 2}}
+	msgpackBody, err := msgpack.Marshal(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cborBody, err := cbor.Marshal(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csvBody := "id,item_name,count,unknown\na,みかん,1,x\nb,ぶどう,2,y\n"
+
+	for _, c := range []struct {
+		contentType string
+		body        []byte
+	}{
+		{MIMEApplicationMsgPack, msgpackBody},
+		{MIMEApplicationCBOR, cborBody},
+		{MIMETextCSV, []byte(csvBody)},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewReader(c.body))
+		req.Header.Set(fiber.HeaderContentType, c.contentType)
+		resp, err := app.App.(*fiber.App).Test(req)
+		if err != nil {
+			t.Fatalf("%s: app.Test error: %v", c.contentType, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status=%d body=%s", c.contentType, resp.StatusCode, body)
+		}
+		var got []negotiateItem
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Fatalf("%s: decode echo: %v", c.contentType, err)
+		}
+		if len(got) != 2 || got[0].Name != "みかん" || got[1].Count != 2 {
+			t.Fatalf("%s: decoded=%+v", c.contentType, got)
+		}
+	}
+}
+
+func TestMarshalCSVSupportsRawRecordsAndPointers(t *testing.T) {
+	raw, err := marshalCSV([][]string{{"a", "b"}, {"1", "x,y"}})
+	if err != nil || string(raw) != "a,b\n1,\"x,y\"\n" {
+		t.Fatalf("raw records=%q err=%v", raw, err)
+	}
+	rows, err := marshalCSV([]*negotiateItem{{Id: "p", Count: 7}, nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,item_name,count,createdAt\np,,7,\n,,,\n"; string(rows) != want {
+		t.Fatalf("pointer rows=%q want=%q", rows, want)
+	}
+	if _, err := marshalCSV(42); err == nil {
+		t.Fatal("unsupported type must fail")
+	}
+}
+
+type CSVBase struct {
+	Id string `json:"id"`
+}
+
+type csvEmbedded struct {
+	*CSVBase
+	Name string `json:"name"`
+}
+
+func TestCSVExpandsPointerEmbeddedStructs(t *testing.T) {
+	rows, err := marshalCSV([]csvEmbedded{{CSVBase: &CSVBase{Id: "a"}, Name: "x"}, {Name: "y"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "id,name\na,x\n,y\n"; string(rows) != want {
+		t.Fatalf("rows=%q want=%q", rows, want)
+	}
+
+	var items []csvEmbedded
+	if err := unmarshalCSV([]byte("id,name\nb,z\n"), &items); err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 1 || items[0].CSVBase == nil || items[0].Id != "b" || items[0].Name != "z" {
+		t.Fatalf("items=%+v", items)
+	}
+}
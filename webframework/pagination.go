@@ -0,0 +1,36 @@
+package gw_web
+
+import (
+	"strconv"
+	"strings"
+
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"github.com/gofiber/fiber/v3"
+)
+
+// ErrInvalidPageRequest は ?cursor= / ?limit= が不正なことを表す（400）。
+var ErrInvalidPageRequest = fiber.NewError(fiber.StatusBadRequest, "invalid page request")
+
+// BindPageRequest はクエリの ?cursor=&limit= から gw_pagination.PageRequest を作る。
+// sort はサーバー側で決めたソート順。cursor はここでは署名だけを検証し、ソート順との一致は Paginate / FindPage が確かめる。
+// limit は省略時 DefaultLimit、上限 MaxLimit に丸める。数値でない・負の limit や不正なカーソルは ErrInvalidPageRequest。
+func (ctx WebCtx) BindPageRequest(sort ...gw_pagination.SortField) (gw_pagination.PageRequest, error) {
+	req := gw_pagination.PageRequest{
+		Cursor: strings.TrimSpace(ctx.Query("cursor")),
+		Sort:   sort,
+	}
+	if limit := strings.TrimSpace(ctx.Query("limit")); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return gw_pagination.PageRequest{}, ErrInvalidPageRequest
+		}
+		req.Limit = n
+	}
+	req.Limit = req.PageLimit()
+	if req.Cursor != "" {
+		if err := gw_pagination.VerifyCursor(req.Cursor); err != nil {
+			return gw_pagination.PageRequest{}, ErrInvalidPageRequest
+		}
+	}
+	return req, nil
+}
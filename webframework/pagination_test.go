@@ -0,0 +1,53 @@
+package gw_web
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	gw_pagination "github.com/generalworksinc/goutil/pagination"
+	"github.com/gofiber/fiber/v3"
+)
+
+func TestBindPageRequest(t *testing.T) {
+	gw_pagination.SetCursorKey([]byte("test-cursor-key"))
+	cursor, err := gw_pagination.EncodeCursor([]gw_pagination.SortField{{Column: "created_at", Desc: true}, {Column: "id"}}, gw_pagination.Next, []any{"2026-01-01", "e1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := newRouteTestApp()
+	app.Get("/items", func(ctx *WebCtx) error {
+		req, err := ctx.BindPageRequest(gw_pagination.SortField{Column: "created_at", Desc: true})
+		if err != nil {
+			return err
+		}
+		return ctx.SendString(fmt.Sprintf("%d:%t:%s", req.Limit, req.Cursor != "", req.Sort[0].Column))
+	})
+
+	cases := []struct {
+		query  string
+		status int
+		body   string
+	}{
+		{"", http.StatusOK, "20:false:created_at"},
+		{"?limit=5&cursor=" + url.QueryEscape(cursor), http.StatusOK, "5:true:created_at"},
+		{"?limit=1000", http.StatusOK, "100:false:created_at"},
+		{"?limit=abc", http.StatusBadRequest, ""},
+		{"?limit=-1", http.StatusBadRequest, ""},
+		{"?cursor=tampered." + url.QueryEscape(cursor), http.StatusBadRequest, ""},
+	}
+	for _, c := range cases {
+		resp, err := app.App.(*fiber.App).Test(httptest.NewRequest(http.MethodGet, "/items"+c.query, http.NoBody))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != c.status || (c.body != "" && string(body) != c.body) {
+			t.Fatalf("%s: status=%d body=%s", c.query, resp.StatusCode, body)
+		}
+	}
+}
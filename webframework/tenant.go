@@ -0,0 +1,182 @@
+package gw_web
+
+// このファイルはマルチテナントのリクエスト解決（テナントの特定 → 所属の確認 → gw_gorm.Scope の設定）を置く。
+// 所属・ロールの真実の源はアプリ側にあるため、読み込みは TenantConfig.Loader に委ねる。
+
+import (
+	"net"
+	"strings"
+
+	gw_errors "github.com/generalworksinc/goutil/errors"
+	gw_gorm "github.com/generalworksinc/goutil/gorm"
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"github.com/gofiber/fiber/v3"
+)
+
+// HeaderTenantId はテナントを指定するリクエストヘッダの既定名。
+const HeaderTenantId = "X-Tenant-Id"
+
+// テナント解決の失敗。CustomHTTPErrorHandler 等で 401 / 403 として返る。
+var (
+	ErrTenantAuthRequired = fiber.NewError(fiber.StatusUnauthorized, "authentication required")
+	ErrTenantForbidden    = fiber.NewError(fiber.StatusForbidden, "tenant access denied")
+)
+
+// TenantSource はリクエストから対象テナントの識別子を取り出す。見つからなければ ""。
+// 不正な入力（検証できないトークン等）はエラーを返す（401 になる）。
+type TenantSource func(ctx *WebCtx) (string, error)
+
+// TenantFromSubdomain は baseDomain 直下のサブドメインをテナント識別子にする（acme.example.com → "acme"）。
+// baseDomain 自体や 2 階層以上のサブドメインは対象外（""）。
+func TenantFromSubdomain(baseDomain string) TenantSource {
+	suffix := "." + strings.ToLower(strings.Trim(baseDomain, "."))
+	return func(ctx *WebCtx) (string, error) {
+		host := strings.ToLower(ctx.Ctx.(fiber.Ctx).Hostname())
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		sub, ok := strings.CutSuffix(host, suffix)
+		if !ok || sub == "" || strings.Contains(sub, ".") {
+			return "", nil
+		}
+		return sub, nil
+	}
+}
+
+// TenantFromHeader はリクエストヘッダ name（空なら X-Tenant-Id）の値をテナント識別子にする。
+// ヘッダはクライアントが自由に付けられるため、所属の確認（Loader）を必ず通す前提の「選択」として扱う。
+func TenantFromHeader(name string) TenantSource {
+	if name == "" {
+		name = HeaderTenantId
+	}
+	return func(ctx *WebCtx) (string, error) {
+		return strings.TrimSpace(ctx.Get(name)), nil
+	}
+}
+
+// TenantFromTokenClaim は Authorization: Bearer のアクセストークン（CreateAccessToken 形式）を検証し、
+// claim の値をテナント識別子にする。トークンが無ければ ""、検証に失敗すればエラー。
+func TenantFromTokenClaim(hexKey string, claim string) TenantSource {
+	return func(ctx *WebCtx) (string, error) {
+		tokenStr, ok := strings.CutPrefix(ctx.Get(HeaderAuthorization), "Bearer ")
+		if !ok || tokenStr == "" {
+			return "", nil
+		}
+		token, err := VerifyData(hexKey, tokenStr)
+		if err != nil {
+			return "", err
+		}
+		value, err := token.GetString(claim)
+		if err != nil {
+			return "", nil
+		}
+		return value, nil
+	}
+}
+
+// TenantMembership は Loader が返すユーザーのテナント所属。TenantResolver が Scope に変換する。
+type TenantMembership struct {
+	UserId string
+	// TenantId はこのリクエストの対象テナント（authz の dom）。
+	TenantId string
+	// Role は authz に渡すロール名。
+	Role string
+	// TenantIds は参照可能テナント。nil なら TenantId の1件。
+	TenantIds []string
+	// OrgIds は参照可能 organization。
+	OrgIds []string
+	// AllTenants はシステム管理者用（gw_gorm.Scope.AllTenants）。
+	AllTenants bool
+}
+
+// Scope は所属を gw_gorm.Scope に変換する。
+func (m *TenantMembership) Scope() *gw_gorm.Scope {
+	tenantIds := m.TenantIds
+	if tenantIds == nil && m.TenantId != "" {
+		tenantIds = []string{m.TenantId}
+	}
+	return &gw_gorm.Scope{
+		TenantIds:  append([]string(nil), tenantIds...),
+		OrgIds:     append([]string(nil), m.OrgIds...),
+		AllTenants: m.AllTenants,
+	}
+}
+
+// TenantConfig は TenantResolver の設定。
+type TenantConfig struct {
+	// Sources は対象テナントの取り出し方。先頭から順に試し、最初に見つかった値を使う。
+	Sources []TenantSource
+	// UserId は認証済みユーザーIDを返す。nil なら gw_log の context の user_id（空なら未認証）。
+	UserId func(ctx *WebCtx) string
+	// Loader は userId の tenantId への所属を返す。tenantId が "" の場合（指定なし）は既定テナントを選んでよい。
+	// 所属していなければ nil を返す（403）。エラーはそのままエラーハンドラへ返す。
+	Loader func(ctx *WebCtx, userId string, tenantId string) (*TenantMembership, error)
+}
+
+type tenantMembershipKey struct{}
+
+// TenantMembershipOf は TenantResolver が確定した所属を返す。未解決なら nil。
+// gw_authz.Require は SetRoleResolver が無い場合これを使う。
+func TenantMembershipOf(ctx *WebCtx) *TenantMembership {
+	membership, _ := ctx.Locals(tenantMembershipKey{}).(*TenantMembership)
+	return membership
+}
+
+// TenantResolver はリクエストの対象テナントを特定して所属を確認し、gw_gorm.Scope を context に載せるミドルウェア。
+// 対象テナントIDは gw_log.WithTenantId でも context に載せる（gw_log.TenantIdFromContext で取り出せる）。
+//   - 未認証（UserId が空）・テナント指定の検証失敗 → 401（ErrTenantAuthRequired）
+//   - 所属していない（Loader が nil）・指定テナントが所属の範囲外 → 403（ErrTenantForbidden）
+//
+// 認証（user_id を context に載せる）ミドルウェアより後に登録すること。
+func TenantResolver(cfg TenantConfig) WebHandler {
+	return func(ctx *WebCtx) error {
+		if cfg.Loader == nil {
+			return gw_errors.New("tenant resolver: Loader is not configured")
+		}
+		userId := ""
+		if cfg.UserId != nil {
+			userId = cfg.UserId(ctx)
+		} else {
+			userId = gw_log.UserIdFromContext(ctx.Context())
+		}
+		if userId == "" {
+			return ErrTenantAuthRequired
+		}
+
+		tenantId := ""
+		for _, source := range cfg.Sources {
+			id, err := source(ctx)
+			if err != nil {
+				return ErrTenantAuthRequired
+			}
+			if id != "" {
+				tenantId = id
+				break
+			}
+		}
+
+		membership, err := cfg.Loader(ctx, userId, tenantId)
+		if err != nil {
+			return err
+		}
+		if membership == nil {
+			return ErrTenantForbidden
+		}
+		if membership.UserId == "" {
+			membership.UserId = userId
+		}
+		if membership.TenantId == "" {
+			membership.TenantId = tenantId
+		}
+		scope := membership.Scope()
+		// Loader が別テナントの所属を返しても、指定されたテナントが見えなければ通さない
+		if tenantId != "" && (membership.TenantId != tenantId || !scope.CanSeeTenant(tenantId)) {
+			return ErrTenantForbidden
+		}
+
+		ctx.Locals(tenantMembershipKey{}, membership)
+		// 機能フラグ・outbox などの振り分け用に、確定した対象テナントを gw_log の context にも載せる（Scope は渡さない）
+		ctx.SetContext(gw_log.WithTenantId(gw_gorm.WithScopeContext(ctx.Context(), scope), membership.TenantId))
+		return ctx.Next()
+	}
+}
@@ -0,0 +1,142 @@
+package gw_web
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"aidanwoods.dev/go-paseto"
+	gw_log "github.com/generalworksinc/goutil/logging"
+	"github.com/gofiber/fiber/v3"
+)
+
+// X-User ヘッダを認証済みユーザーとして context に載せる（認証ミドルウェアの代わり）
+func testAuthenticate(ctx *WebCtx) error {
+	if user := ctx.Get("X-User"); user != "" {
+		ctx.SetContext(gw_log.WithUserId(ctx.Context(), user))
+	}
+	return ctx.Next()
+}
+
+// u1 は acme（member）と globex（admin）に所属、u2 は acme のみ
+func testMembershipLoader(ctx *WebCtx, userId string, tenantId string) (*TenantMembership, error) {
+	memberships := map[string]map[string]string{
+		"u1": {"acme": "member", "globex": "admin"},
+		"u2": {"acme": "member"},
+	}
+	if userId == "broken" {
+		return nil, errors.New("membership store down")
+	}
+	if tenantId == "" {
+		tenantId = "acme" // 指定なしは既定テナント
+	}
+	role, ok := memberships[userId][tenantId]
+	if !ok {
+		return nil, nil
+	}
+	if userId == "u2" && tenantId == "acme" && ctx.Get("X-Confused") != "" {
+		// Loader の不具合で別テナントの所属を返すケース
+		return &TenantMembership{TenantId: "globex", Role: role}, nil
+	}
+	return &TenantMembership{TenantId: tenantId, Role: role, OrgIds: []string{tenantId + "-org"}}, nil
+}
+
+func newTenantTestApp(sources ...TenantSource) *WebApp {
+	app := newRouteTestApp()
+	app.Use(testAuthenticate, TenantResolver(TenantConfig{Sources: sources, Loader: testMembershipLoader}))
+	app.Get("/whoami", func(ctx *WebCtx) error {
+		membership := TenantMembershipOf(ctx)
+		tenantId := gw_log.TenantIdFromContext(ctx.Context())
+		return ctx.SendString(membership.UserId + "@" + tenantId + ":" + membership.Role)
+	})
+	return app
+}
+
+func tenantRequest(t *testing.T, app *WebApp, host string, headers map[string]string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "http://"+host+"/whoami", http.NoBody)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := app.App.(*fiber.App).Test(req)
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+func TestTenantResolverFromHeaderSetsScopeAndMembership(t *testing.T) {
+	app := newTenantTestApp(TenantFromHeader(""))
+
+	cases := []struct {
+		name    string
+		headers map[string]string
+		status  int
+		body    string
+	}{
+		{"unauthenticated", map[string]string{HeaderTenantId: "acme"}, http.StatusUnauthorized, ""},
+		{"member", map[string]string{"X-User": "u1", HeaderTenantId: "globex"}, http.StatusOK, "u1@globex:admin"},
+		{"default tenant", map[string]string{"X-User": "u2"}, http.StatusOK, "u2@acme:member"},
+		{"not a member", map[string]string{"X-User": "u2", HeaderTenantId: "globex"}, http.StatusForbidden, ""},
+		{"loader returned other tenant", map[string]string{"X-User": "u2", HeaderTenantId: "acme", "X-Confused": "1"}, http.StatusForbidden, ""},
+		{"loader error", map[string]string{"X-User": "broken"}, http.StatusInternalServerError, ""},
+	}
+	for _, c := range cases {
+		status, body := tenantRequest(t, app, "api.example.com", c.headers)
+		if status != c.status {
+			t.Fatalf("%s: status=%d want=%d body=%s", c.name, status, c.status, body)
+		}
+		if c.body != "" && body != c.body {
+			t.Fatalf("%s: body=%q want=%q", c.name, body, c.body)
+		}
+	}
+}
+
+func TestTenantResolverSourcesInOrder(t *testing.T) {
+	app := newTenantTestApp(TenantFromSubdomain("example.com"), TenantFromHeader("X-Org"))
+
+	if _, body := tenantRequest(t, app, "globex.example.com:8080", map[string]string{"X-User": "u1", "X-Org": "acme"}); body != "u1@globex:admin" {
+		t.Fatalf("subdomain must win over header: %q", body)
+	}
+	if _, body := tenantRequest(t, app, "example.com", map[string]string{"X-User": "u1", "X-Org": "globex"}); body != "u1@globex:admin" {
+		t.Fatalf("header must be used when no subdomain: %q", body)
+	}
+	if _, body := tenantRequest(t, app, "a.b.example.com", map[string]string{"X-User": "u1"}); body != "u1@acme:member" {
+		t.Fatalf("nested subdomain must be ignored: %q", body)
+	}
+}
+
+func TestTenantResolverFromTokenClaim(t *testing.T) {
+	app := newTenantTestApp(TenantFromTokenClaim(testPasetoV4KeyHex, "tenant"))
+
+	key, err := loadV4Key(testPasetoV4KeyHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := paseto.NewToken()
+	token.Set("tenant", "globex")
+	token.SetExpiration(time.Now().Add(time.Hour))
+	signed := token.V4Encrypt(key, nil)
+
+	if status, body := tenantRequest(t, app, "api.example.com", map[string]string{"X-User": "u1", HeaderAuthorization: "Bearer " + signed}); status != http.StatusOK || body != "u1@globex:admin" {
+		t.Fatalf("claim tenant: status=%d body=%q", status, body)
+	}
+	if status, _ := tenantRequest(t, app, "api.example.com", map[string]string{"X-User": "u1", HeaderAuthorization: "Bearer forged"}); status != http.StatusUnauthorized {
+		t.Fatalf("invalid token must be 401, got %d", status)
+	}
+}
+
+func TestTenantMembershipScope(t *testing.T) {
+	scope := (&TenantMembership{TenantId: "t1", OrgIds: []string{"o1"}}).Scope()
+	if !scope.CanSeeTenant("t1") || scope.CanSeeTenant("t2") || !scope.CanSeeOrg("o1") {
+		t.Fatalf("scope = %+v", scope)
+	}
+	multi := (&TenantMembership{TenantId: "t1", TenantIds: []string{"t1", "t2"}}).Scope()
+	if !multi.CanSeeTenant("t2") {
+		t.Fatalf("explicit TenantIds must be used: %+v", multi)
+	}
+}
@@ -0,0 +1,66 @@
+package gw_web
+
+// このファイルはリクエスト単位のタイムアウト（deadline 付き context の付与）を置く。
+// deadline は ctx.Context() に載るので、Databases で載せた DB（ctx.DB() / MongoDatabase[T] / gw_gorm.Repository）に自動で伝搬する。
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+)
+
+type timeoutStateKey struct{}
+
+// timeoutState は Timeout が context に載せる情報。内側の Timeout（ルート単位の上書き）が新しい値を載せる。
+type timeoutState struct {
+	// base は最も外側の Timeout が付与する前の context（キャンセルの連動元）
+	base context.Context
+}
+
+// Timeout はリクエストの context に d の deadline を付けるミドルウェア。
+// deadline を過ぎてハンドラがエラーを返した場合は status（既定 503 Service Unavailable、504 等も指定可）の
+// fiber.Error に置き換える。deadline を過ぎてもハンドラが正常に応答を書いた場合はそのまま返す。
+// ルート単位で上書きできる: app.Use(Timeout(5*time.Second)) の上で
+// app.With(Timeout(60*time.Second)).Get("/export", ...) とすると、そのルートは 60 秒になる（延長も可）。
+// ハンドラを強制的に中断はしないので、DB は Databases ミドルウェアで載せて ctx.DB() / MongoDatabase[T](ctx) で取り出す
+// （外部 API 等の呼び出しには ctx.Context() を渡す）。context を持たないグローバル変数の db には deadline は届かない。
+func Timeout(d time.Duration, status ...int) WebHandler {
+	code := fiber.StatusServiceUnavailable
+	if len(status) > 0 {
+		code = status[0]
+	}
+	return func(ctx *WebCtx) error {
+		current := ctx.Context()
+		outer, nested := current.Value(timeoutStateKey{}).(*timeoutState)
+		state := &timeoutState{base: current}
+		parent := current
+		if nested {
+			// 外側の Timeout の deadline を外し（値は引き継ぐ）、外側より前の context のキャンセルだけを連動させる
+			state.base = outer.base
+			parent = context.WithoutCancel(current)
+		}
+		timeoutCtx, cancel := context.WithTimeout(context.WithValue(parent, timeoutStateKey{}, state), d)
+		defer cancel()
+		if nested {
+			stop := context.AfterFunc(state.base, cancel)
+			defer stop()
+		}
+		ctx.SetContext(timeoutCtx)
+
+		err := ctx.Next()
+		// 内側の Timeout で上書きされていれば、判定はそちらに任せる
+		if effective, _ := ctx.Context().Value(timeoutStateKey{}).(*timeoutState); effective != state {
+			return err
+		}
+		if err != nil && timeoutCtx.Err() == context.DeadlineExceeded {
+			slog.WarnContext(timeoutCtx, "request timed out",
+				slog.Duration("timeout", d),
+				slog.String("error", err.Error()),
+			)
+			return fiber.NewError(code, "request timed out")
+		}
+		return err
+	}
+}
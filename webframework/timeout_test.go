@@ -0,0 +1,117 @@
+package gw_web
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v3"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 遅い DB 呼び出しの代わりに、context の deadline まで待ってそのエラーを返す
+func waitForDeadline(ctx *WebCtx) error {
+	select {
+	case <-ctx.Context().Done():
+		return ctx.Context().Err()
+	case <-time.After(2 * time.Second):
+		return ctx.SendString("slow but finished")
+	}
+}
+
+func TestTimeoutReturns503WhenDeadlineExceeded(t *testing.T) {
+	app := newRouteTestApp()
+	app.Use(Timeout(20 * time.Millisecond))
+	app.Get("/slow", waitForDeadline)
+	app.Get("/fast", func(ctx *WebCtx) error {
+		if _, ok := ctx.Context().Deadline(); !ok {
+			return errors.New("deadline must be attached")
+		}
+		return ctx.SendString("ok")
+	})
+
+	if got := routeTestStatus(t, app, http.MethodGet, "/slow"); got != http.StatusServiceUnavailable {
+		t.Fatalf("slow status = %d, want 503", got)
+	}
+	if got := routeTestStatus(t, app, http.MethodGet, "/fast"); got != http.StatusOK {
+		t.Fatalf("fast status = %d, want 200", got)
+	}
+}
+
+func TestTimeoutPerRouteOverrideCanExtendAndChangeStatus(t *testing.T) {
+	app := newRouteTestApp()
+	app.Use(Timeout(20 * time.Millisecond))
+	app.With(Timeout(time.Second)).Get("/export", func(ctx *WebCtx) error {
+		// 外側の 20ms を過ぎても、ルート単位の 1 秒が効いていること
+		time.Sleep(50 * time.Millisecond)
+		if err := ctx.Context().Err(); err != nil {
+			return err
+		}
+		deadline, _ := ctx.Context().Deadline()
+		if time.Until(deadline) < 500*time.Millisecond {
+			return errors.New("route deadline must replace the app deadline")
+		}
+		return errors.New("handler error unrelated to timeout")
+	})
+	app.With(Timeout(10*time.Millisecond, http.StatusGatewayTimeout)).Get("/upstream", waitForDeadline)
+
+	// 外側の deadline は過ぎているが、タイムアウトではないエラーはそのまま 500 になる
+	if got := routeTestStatus(t, app, http.MethodGet, "/export"); got != http.StatusInternalServerError {
+		t.Fatalf("export status = %d, want 500", got)
+	}
+	if got := routeTestStatus(t, app, http.MethodGet, "/upstream"); got != http.StatusGatewayTimeout {
+		t.Fatalf("upstream status = %d, want 504", got)
+	}
+}
+
+func TestTimeoutKeepsSuccessfulLateResponse(t *testing.T) {
+	app := newRouteTestApp()
+	app.Use(Timeout(10 * time.Millisecond))
+	app.Get("/late", func(ctx *WebCtx) error {
+		time.Sleep(30 * time.Millisecond)
+		return ctx.SendString("late")
+	})
+
+	resp, err := app.App.(*fiber.App).Test(httptest.NewRequest(http.MethodGet, "/late", http.NoBody))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+}
+
+func TestTimeoutCancelsQueryThroughDatabases(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { sqlDB.Close() })
+
+	app := newRouteTestApp()
+	app.Use(Databases(db, nil), Timeout(50*time.Millisecond))
+	var queryErr error
+	app.Get("/slow", func(ctx *WebCtx) error {
+		tx, err := ctx.DB()
+		if err != nil {
+			return err
+		}
+		// 終わらない再帰クエリ。deadline でドライバが中断する
+		var count int64
+		queryErr = tx.Raw("WITH RECURSIVE c(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM c) SELECT count(*) FROM c").Scan(&count).Error
+		return queryErr
+	})
+
+	start := time.Now()
+	if got := routeTestStatus(t, app, http.MethodGet, "/slow"); got != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", got)
+	}
+	if queryErr == nil || time.Since(start) > 5*time.Second {
+		t.Fatalf("query must be canceled by the request deadline: err=%v elapsed=%v", queryErr, time.Since(start))
+	}
+}
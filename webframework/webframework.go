@@ -3,7 +3,6 @@ package gw_web
 import (
 	"context"
 	"io"
-	"log"
 	"net"
 	"strings"
 	"time"
@@ -12,6 +11,7 @@ import (
 
 	"os"
 
+	"github.com/fxamacker/cbor/v2"
 	gw_errors "github.com/generalworksinc/goutil/errors"
 	"github.com/gofiber/contrib/v3/websocket"
 	"github.com/gofiber/fiber/v3"
@@ -20,6 +20,7 @@ import (
 	"github.com/gofiber/fiber/v3/middleware/logger"
 	"github.com/gofiber/fiber/v3/middleware/session"
 	"github.com/gofiber/fiber/v3/middleware/static"
+	"github.com/shamaton/msgpack/v3"
 )
 
 var store = session.NewStore() // v3: セッションのストア初期化は NewStore を使用
@@ -31,15 +32,17 @@ type WebCtx struct {
 	Ctx interface{}
 }
 type WebApp struct {
-	App        interface{}
-	docs       *docRegistry
-	webSockets *webSocketGate
+	App         interface{}
+	docs        *docRegistry
+	webSockets  *webSocketGate
+	middlewares []WebHandler
 }
 type WebGroup struct {
-	Group      interface{}
-	prefix     string
-	docs       *docRegistry
-	webSockets *webSocketGate
+	Group       interface{}
+	prefix      string
+	docs        *docRegistry
+	webSockets  *webSocketGate
+	middlewares []WebHandler
 }
 type WebRouter interface {
 	Get(key string, defaultValue ...string) string
@@ -98,11 +101,28 @@ func toFiberHandlerFromWs(wsHandler WsHandler, cfg *WebSocketConfig) fiber.Handl
 	return websocket.New(handler, fiberCfg)
 }
 
-func toFiberHandlersFromWs(webHandlerList []WsHandler, cfg *WebSocketConfig, gate *webSocketGate) []any {
+// routeHandlers はルート単位ミドルウェアをハンドラの前に連結する。
+// ハンドラが1つもなければ（ミドルウェアだけのルートは作らず）空を返す。
+func routeHandlers(middlewares []WebHandler, handlers []WebHandler) []any {
+	if len(handlers) == 0 {
+		return nil
+	}
+	return toFiberHandlers(appendMiddlewares(middlewares, handlers))
+}
+
+// appendMiddlewares は base を共有しない新しいスライスを返す（With の派生同士で干渉させない）。
+func appendMiddlewares(base []WebHandler, extra []WebHandler) []WebHandler {
+	out := make([]WebHandler, 0, len(base)+len(extra))
+	out = append(out, base...)
+	return append(out, extra...)
+}
+
+func toFiberHandlersFromWs(webHandlerList []WsHandler, cfg *WebSocketConfig, gate *webSocketGate, middlewares []WebHandler) []any {
 	hList := []any{}
 	if gate != nil {
 		hList = append(hList, toFiberHandler(gate.middleware))
 	}
+	hList = append(hList, toFiberHandlers(middlewares)...)
 	for _, handler := range webHandlerList {
 		if gate != nil {
 			handler = gate.wrap(handler)
@@ -171,12 +191,18 @@ func newAppInternal(errorHandler func(*WebCtx, error) error, settings *AppSettin
 		//ServerHeader:  "Fiber",
 		Immutable: true,               //安全側に倒す
 		BodyLimit: 1024 * 1024 * 1024, //1 GB
+		// Negotiate / BindBody 用。fiber のデフォルトは未実装エンコーダのため明示する
+		MsgPackEncoder: msgpack.Marshal,
+		MsgPackDecoder: msgpack.Unmarshal,
+		CBOREncoder:    cbor.Marshal,
+		CBORDecoder:    cbor.Unmarshal,
 		ErrorHandler: func(ctx fiber.Ctx, err error) error {
 			return errorHandler(&WebCtx{Ctx: ctx}, err)
 		},
 	}
 
 	app := fiber.New(fiberCfg)
+	app.RegisterCustomBinder(csvBinder{})
 	for _, opt := range opts {
 		if opt != nil {
 			opt(app)
@@ -233,60 +259,69 @@ func normalizeLoggerFormat(format string) string {
 }
 func (app WebApp) Group(prefix string, handlers ...WebHandler) WebGroup {
 	return WebGroup{
-		Group:      app.App.(*fiber.App).Group(prefix, toFiberHandlers(handlers)...),
-		prefix:     prefix,
-		docs:       app.docs,
-		webSockets: app.webSockets,
+		Group:       app.App.(*fiber.App).Group(prefix, toFiberHandlers(handlers)...),
+		prefix:      prefix,
+		docs:        app.docs,
+		webSockets:  app.webSockets,
+		middlewares: app.middlewares,
 	}
 }
+
+// With はルート単位のミドルウェアを追加した WebApp を返す（元の WebApp には影響しない）。
+// 返り値に登録したルートだけが、ルートハンドラの前に middlewares を登録順で実行する。
+// 実行順: app.Use → With の middlewares（With を重ねた場合は呼んだ順）→ ルートハンドラ。
+func (app WebApp) With(middlewares ...WebHandler) WebApp {
+	app.middlewares = appendMiddlewares(app.middlewares, middlewares)
+	return app
+}
 func (app WebApp) Get(path string, handlers ...WebHandler) {
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
-		return
-	}
-	app.App.(*fiber.App).Get(path, hs[0], hs[1:]...)
+	app.Match([]string{MethodGet}, path, handlers...)
+}
+func (app WebApp) Head(path string, handlers ...WebHandler) {
+	app.Match([]string{MethodHead}, path, handlers...)
 }
 func (app WebApp) Post(path string, handlers ...WebHandler) {
-	a := app.App.(*fiber.App)
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
-		return
-	}
-	a.Post(path, hs[0], hs[1:]...)
+	app.Match([]string{MethodPost}, path, handlers...)
 }
 func (app WebApp) Put(path string, handlers ...WebHandler) {
-	a := app.App.(*fiber.App)
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
-		return
-	}
-	a.Put(path, hs[0], hs[1:]...)
+	app.Match([]string{MethodPut}, path, handlers...)
 }
 func (app WebApp) Patch(path string, handlers ...WebHandler) {
-	a := app.App.(*fiber.App)
-	hs := toFiberHandlers(handlers)
+	app.Match([]string{MethodPatch}, path, handlers...)
+}
+func (app WebApp) Delete(path string, handlers ...WebHandler) {
+	app.Match([]string{MethodDelete}, path, handlers...)
+}
+func (app WebApp) Options(path string, handlers ...WebHandler) {
+	app.Match([]string{MethodOptions}, path, handlers...)
+}
+
+// Any は全 HTTP メソッドにルートを登録する。
+func (app WebApp) Any(path string, handlers ...WebHandler) {
+	hs := routeHandlers(app.middlewares, handlers)
 	if len(hs) == 0 {
 		return
 	}
-	a.Patch(path, hs[0], hs[1:]...)
+	app.App.(*fiber.App).All(path, hs[0], hs[1:]...)
 }
-func (app WebApp) Delete(path string, handlers ...WebHandler) {
-	a := app.App.(*fiber.App)
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
+
+// Match は指定した HTTP メソッド群に同じルートを登録する。
+func (app WebApp) Match(methods []string, path string, handlers ...WebHandler) {
+	hs := routeHandlers(app.middlewares, handlers)
+	if len(hs) == 0 || len(methods) == 0 {
 		return
 	}
-	a.Delete(path, hs[0], hs[1:]...)
+	app.App.(*fiber.App).Add(methods, path, hs[0], hs[1:]...)
 }
 func (app WebApp) WsGet(path string, handlers ...WsHandler) {
-	hs := toFiberHandlersFromWs(handlers, nil, app.webSockets)
+	hs := toFiberHandlersFromWs(handlers, nil, app.webSockets, app.middlewares)
 	if len(hs) == 0 {
 		return
 	}
 	app.App.(*fiber.App).Get(path, hs[0], hs[1:]...)
 }
 func (app WebApp) WsGetWithConfig(path string, cfg WebSocketConfig, handlers ...WsHandler) {
-	hs := toFiberHandlersFromWs(handlers, &cfg, app.webSockets)
+	hs := toFiberHandlersFromWs(handlers, &cfg, app.webSockets, app.middlewares)
 	if len(hs) == 0 {
 		return
 	}
@@ -321,65 +356,82 @@ func (app WebApp) shutdown(ctx context.Context) error {
 }
 
 // WebGroup ////////////////////////////////////////////////
-func (group WebGroup) Get(path string, handlers ...WebHandler) {
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
-		return
+
+// SubGroup はグループ配下にネストしたグループを作る。prefix は親グループの prefix に連結され、
+// 親の With で追加したルート単位ミドルウェアも引き継ぐ。
+// （フィールド WebGroup.Group と名前が衝突するため、メソッド名は SubGroup とする）
+func (group WebGroup) SubGroup(prefix string, handlers ...WebHandler) WebGroup {
+	return WebGroup{
+		Group:       group.Group.(*fiber.Group).Group(prefix, toFiberHandlers(handlers)...),
+		prefix:      group.fullPath(prefix),
+		docs:        group.docs,
+		webSockets:  group.webSockets,
+		middlewares: group.middlewares,
 	}
-	group.Group.(*fiber.Group).Get(path, hs[0], hs[1:]...)
+}
+
+// With はルート単位のミドルウェアを追加した WebGroup を返す（元の WebGroup には影響しない）。
+// 実行順: app.Use → Group 作成時の handlers / group.Use（登録順）→ With の middlewares → ルートハンドラ。
+func (group WebGroup) With(middlewares ...WebHandler) WebGroup {
+	group.middlewares = appendMiddlewares(group.middlewares, middlewares)
+	return group
+}
+func (group WebGroup) Get(path string, handlers ...WebHandler) {
+	group.Match([]string{MethodGet}, path, handlers...)
+}
+func (group WebGroup) Head(path string, handlers ...WebHandler) {
+	group.Match([]string{MethodHead}, path, handlers...)
 }
 func (group WebGroup) Post(path string, handlers ...WebHandler) {
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
-		return
-	}
-	group.Group.(*fiber.Group).Post(path, hs[0], hs[1:]...)
+	group.Match([]string{MethodPost}, path, handlers...)
 }
 func (group WebGroup) Put(path string, handlers ...WebHandler) {
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
-		return
-	}
-	group.Group.(*fiber.Group).Put(path, hs[0], hs[1:]...)
+	group.Match([]string{MethodPut}, path, handlers...)
 }
 func (group WebGroup) Patch(path string, handlers ...WebHandler) {
-	hs := toFiberHandlers(handlers)
+	group.Match([]string{MethodPatch}, path, handlers...)
+}
+func (group WebGroup) Delete(path string, handlers ...WebHandler) {
+	group.Match([]string{MethodDelete}, path, handlers...)
+}
+func (group WebGroup) Options(path string, handlers ...WebHandler) {
+	group.Match([]string{MethodOptions}, path, handlers...)
+}
+
+// Any は全 HTTP メソッドにルートを登録する。
+func (group WebGroup) Any(path string, handlers ...WebHandler) {
+	hs := routeHandlers(group.middlewares, handlers)
 	if len(hs) == 0 {
 		return
 	}
-	group.Group.(*fiber.Group).Patch(path, hs[0], hs[1:]...)
+	group.Group.(*fiber.Group).All(path, hs[0], hs[1:]...)
 }
-func (group WebGroup) Delete(path string, handlers ...WebHandler) {
-	hs := toFiberHandlers(handlers)
-	if len(hs) == 0 {
+
+// Match は指定した HTTP メソッド群に同じルートを登録する。
+func (group WebGroup) Match(methods []string, path string, handlers ...WebHandler) {
+	hs := routeHandlers(group.middlewares, handlers)
+	if len(hs) == 0 || len(methods) == 0 {
 		return
 	}
-	group.Group.(*fiber.Group).Delete(path, hs[0], hs[1:]...)
-}
-func (group WebGroup) Use(args ...interface{}) {
-	convertedArgs := []interface{}{}
-	for _, arg := range args {
-		switch argType := arg.(type) {
-		case WebHandler:
-			log.Println("webHandler:", argType)
-			convertedArgs = append(convertedArgs, toFiberHandler(arg.(WebHandler)))
-		default:
-			log.Println("not webHandler:", argType)
-			convertedArgs = append(convertedArgs, arg)
-		}
+	group.Group.(*fiber.Group).Add(methods, path, hs[0], hs[1:]...)
+}
+
+// Use はグループ配下の全ルートに効くミドルウェアを登録する（登録順に実行される）。
+func (group WebGroup) Use(handlers ...WebHandler) {
+	for _, h := range handlers {
+		group.Group.(*fiber.Group).Use(toFiberHandler(h))
 	}
-	group.Group.(*fiber.Group).Use(convertedArgs...)
 }
 
 func (group WebGroup) WsGet(path string, handlers ...WsHandler) {
-	hs := toFiberHandlersFromWs(handlers, nil, group.webSockets)
+	hs := toFiberHandlersFromWs(handlers, nil, group.webSockets, group.middlewares)
 	if len(hs) == 0 {
 		return
 	}
 	group.Group.(*fiber.Group).Get(path, hs[0], hs[1:]...)
 }
 func (group WebGroup) WsGetWithConfig(path string, cfg WebSocketConfig, handlers ...WsHandler) {
-	hs := toFiberHandlersFromWs(handlers, &cfg, group.webSockets)
+	hs := toFiberHandlersFromWs(handlers, &cfg, group.webSockets, group.middlewares)
 	if len(hs) == 0 {
 		return
 	}
@@ -507,9 +559,9 @@ func (ctx WebCtx) QueryParser(out interface{}) error {
 	return ctx.Ctx.(fiber.Ctx).Bind().Query(out)
 }
 
-// Deprecated: Use BindJSON/BindForm/BindQuery.
+// Deprecated: Use BindBody/BindJSON/BindForm/BindQuery.
 func (ctx WebCtx) BodyParser(out interface{}) error {
-	return ctx.Ctx.(fiber.Ctx).Bind().Body(out)
+	return ctx.BindBody(out)
 }
 
 func (ctx WebCtx) BindJSON(out interface{}) error {
@@ -97,3 +97,141 @@ func TestOpenAPIRegistersGroupDocWithPrefix(t *testing.T) {
 		t.Fatalf("unexpected summary: %#v", postDoc["summary"])
 	}
 }
+
+func newRouteTestApp() *WebApp {
+	return NewApp(func(ctx *WebCtx, err error) error {
+		return ctx.Status(errorStatusCode(err, ctx.StatusCode())).SendString(err.Error())
+	})
+}
+
+func routeTestStatus(t *testing.T, app *WebApp, method, path string) int {
+	t.Helper()
+	resp, err := app.App.(*fiber.App).Test(httptest.NewRequest(method, path, http.NoBody))
+	if err != nil {
+		t.Fatalf("app.Test error: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestRouteMethodsCoverHeadOptionsAnyAndMatch(t *testing.T) {
+	app := newRouteTestApp()
+	ok := func(ctx *WebCtx) error { return ctx.Status(http.StatusNoContent).SendString("") }
+	app.Head("/head", ok)
+	app.Options("/options", ok)
+	app.Any("/any", ok)
+	app.Match([]string{MethodPut, MethodPatch}, "/match", ok)
+	group := app.Group("/api")
+	group.Head("/head", ok)
+	group.Any("/any", ok)
+	group.Match([]string{MethodPost}, "/match", ok)
+
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{MethodHead, "/head", http.StatusNoContent},
+		{MethodOptions, "/options", http.StatusNoContent},
+		{MethodGet, "/any", http.StatusNoContent},
+		{MethodDelete, "/any", http.StatusNoContent},
+		{MethodPut, "/match", http.StatusNoContent},
+		{MethodPatch, "/match", http.StatusNoContent},
+		{MethodGet, "/match", http.StatusMethodNotAllowed},
+		{MethodHead, "/api/head", http.StatusNoContent},
+		{MethodPatch, "/api/any", http.StatusNoContent},
+		{MethodPost, "/api/match", http.StatusNoContent},
+		{MethodPut, "/api/match", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		if got := routeTestStatus(t, app, c.method, c.path); got != c.want {
+			t.Errorf("%s %s: status=%d want=%d", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+// ミドルウェアの実行順: app.Use → Group の handlers → group.Use → With（呼んだ順）→ ルートハンドラ。
+// With は派生元に影響しない。
+func TestWithMiddlewareOrderAndIsolation(t *testing.T) {
+	app := newRouteTestApp()
+	var trace []string
+	mark := func(name string) WebHandler {
+		return func(ctx *WebCtx) error {
+			trace = append(trace, name)
+			return ctx.Next()
+		}
+	}
+	handler := func(ctx *WebCtx) error {
+		trace = append(trace, "handler")
+		return ctx.SendString("ok")
+	}
+	app.Use(mark("app"))
+	group := app.Group("/api", mark("group"))
+	group.Use(mark("use"))
+	authed := group.With(mark("w1")).With(mark("w2"))
+	authed.Get("/private", mark("route"), handler)
+	group.Get("/public", handler)
+	authed.SubGroup("/admin").Post("/ops", handler)
+
+	cases := []struct {
+		method, path string
+		want         string
+	}{
+		{MethodGet, "/api/private", "app,group,use,w1,w2,route,handler"},
+		{MethodGet, "/api/public", "app,group,use,handler"},
+		{MethodPost, "/api/admin/ops", "app,group,use,w1,w2,handler"},
+	}
+	for _, c := range cases {
+		trace = nil
+		if got := routeTestStatus(t, app, c.method, c.path); got != http.StatusOK {
+			t.Fatalf("%s %s: status=%d", c.method, c.path, got)
+		}
+		if got := strings.Join(trace, ","); got != c.want {
+			t.Errorf("%s %s: order=%q want=%q", c.method, c.path, got, c.want)
+		}
+	}
+}
+
+func TestMiddlewareCanShortCircuitRoute(t *testing.T) {
+	app := newRouteTestApp()
+	deny := func(ctx *WebCtx) error { return ctx.Status(http.StatusForbidden).SendString("Forbidden") }
+	called := false
+	app.With(deny).Get("/guarded", func(ctx *WebCtx) error {
+		called = true
+		return ctx.SendString("ok")
+	})
+	if got := routeTestStatus(t, app, MethodGet, "/guarded"); got != http.StatusForbidden {
+		t.Fatalf("status=%d want=403", got)
+	}
+	if called {
+		t.Fatal("route handler must not run after middleware short-circuit")
+	}
+}
+
+func TestOpenAPIDocsForSubGroupMatchAndAny(t *testing.T) {
+	app := newRouteTestApp()
+	ok := func(ctx *WebCtx) error { return ctx.SendString("ok") }
+	v1 := app.Group("/api").SubGroup("/v1")
+	v1.MatchDoc([]string{MethodPut, MethodPatch}, "/items/:id", RouteDoc{Summary: "Replace item"}, ok)
+	v1.AnyDoc("/ping", RouteDoc{Summary: "Ping"}, ok)
+	v1.HeadDoc("/items", RouteDoc{Summary: "Probe items"}, ok)
+
+	paths := app.OpenAPI()["paths"].(map[string]any)
+	item, ok2 := paths["/api/v1/items/{id}"].(map[string]any)
+	if !ok2 {
+		t.Fatalf("expected nested group path, got %#v", paths)
+	}
+	for _, method := range []string{"put", "patch"} {
+		if _, found := item[method]; !found {
+			t.Errorf("missing %s operation: %#v", method, item)
+		}
+	}
+	if _, found := item["get"]; found {
+		t.Errorf("unexpected get operation: %#v", item)
+	}
+	ping := paths["/api/v1/ping"].(map[string]any)
+	if len(ping) != len(anyDocMethods) {
+		t.Errorf("AnyDoc should document %d methods, got %#v", len(anyDocMethods), ping)
+	}
+	if _, found := paths["/api/v1/items"].(map[string]any)["head"]; !found {
+		t.Errorf("missing head operation: %#v", paths["/api/v1/items"])
+	}
+}